@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerBreakpointRoutes 注册断点规则与挂起流量相关的接口
+func registerBreakpointRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/breakpoints", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"rules":       breakpoints.Rules(),
+			"timeout_sec": int(breakpoints.Timeout().Seconds()),
+		})
+	})
+
+	api.POST("/proxy/breakpoints", func(c *gin.Context) {
+		var rule pxy.BreakpointRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := breakpoints.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/breakpoints/:id", func(c *gin.Context) {
+		var rule pxy.BreakpointRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := breakpoints.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(breakpointErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/breakpoints/:id", func(c *gin.Context) {
+		if err := breakpoints.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(breakpointErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 自动放行超时时间
+	api.PUT("/proxy/breakpoints/timeout", func(c *gin.Context) {
+		var body struct {
+			TimeoutSec int `json:"timeout_sec"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil || body.TimeoutSec <= 0 {
+			c.JSON(400, gin.H{"error": "timeout_sec 必须为正整数"})
+			return
+		}
+		breakpoints.SetTimeout(time.Duration(body.TimeoutSec) * time.Second)
+		c.JSON(200, gin.H{"ok": true, "timeout_sec": body.TimeoutSec})
+	})
+
+	// 挂起中的请求/响应
+	api.GET("/proxy/breakpoints/pending", func(c *gin.Context) {
+		c.JSON(200, breakpoints.Pending())
+	})
+
+	api.GET("/proxy/breakpoints/pending/:id", func(c *gin.Context) {
+		p := breakpoints.GetPending(c.Param("id"))
+		if p == nil {
+			c.JSON(404, gin.H{"error": "not found"})
+			return
+		}
+		c.JSON(200, p)
+	})
+
+	api.POST("/proxy/breakpoints/pending/:id/resume", func(c *gin.Context) {
+		var d pxy.BreakpointDecision
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&d); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if d.Action == "" {
+			d.Action = pxy.BreakpointActionContinue
+		}
+		if err := breakpoints.Resolve(c.Param("id"), d); err != nil {
+			c.JSON(breakpointErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	api.POST("/proxy/breakpoints/pending/:id/abort", func(c *gin.Context) {
+		err := breakpoints.Resolve(c.Param("id"), pxy.BreakpointDecision{Action: pxy.BreakpointActionAbort})
+		if err != nil {
+			c.JSON(breakpointErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func breakpointErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrBreakpointNotFound) || errors.Is(err, pxy.ErrPendingNotFound) {
+		return 404
+	}
+	return 400
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newCAManager 根证书目录可通过 PROBE_CA_DIR 环境变量配置，默认为 ../certs
+func newCAManager() *pxy.CAManager {
+	return pxy.NewCAManager(os.Getenv("PROBE_CA_DIR"))
+}
+
+// readFormFile 读取 multipart 中的文件字段，字段不存在时返回 nil
+func readFormFile(c *gin.Context, field string) ([]byte, error) {
+	fh, err := c.FormFile(field)
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// registerCARoutes 注册根证书查看、导入、轮换与导出相关的接口
+func registerCARoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/ca/info", func(c *gin.Context) {
+		st, err := caManager.Info()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, st)
+	})
+
+	// 导出证书：format=pem|der|crt|cer|p12|android，previous=1 导出上一代根证书
+	exportCA := func(c *gin.Context) {
+		writeCAExport(c, pxy.CAExportOptions{
+			Format:   c.DefaultQuery("format", pxy.CAFormatPEM),
+			Previous: c.Query("previous") == "1",
+		})
+	}
+	api.GET("/proxy/ca", exportCA)
+	api.GET("/proxy/ca/export", exportCA)
+
+	// 导出私钥：仅接受本机请求，format=pem|p12，p12 的密码放在请求体中
+	api.POST("/proxy/ca/export/key", func(c *gin.Context) {
+		if !isLoopbackRequest(c.Request) {
+			c.JSON(403, gin.H{"error": "私钥仅允许从本机导出"})
+			return
+		}
+		var body struct {
+			Format   string `json:"format"`
+			Previous bool   `json:"previous"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Format == "" {
+			body.Format = pxy.CAFormatPEM
+		}
+		writeCAExport(c, pxy.CAExportOptions{Format: body.Format, Previous: body.Previous, IncludeKey: true, Password: body.Password})
+	})
+
+	// 导入已有 CA：cert 字段为 PEM 或 PKCS#12，PEM 私钥可在同一文件或 key 字段，password 用于 PKCS#12
+	api.POST("/proxy/ca/import", func(c *gin.Context) {
+		data, err := readFormFile(c, "cert")
+		if err == nil && len(data) == 0 {
+			err = errors.New("缺少证书文件")
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		keyData, err := readFormFile(c, "key")
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := caManager.Import(data, keyData, c.PostForm("password")); err != nil {
+			c.JSON(400, gin.H{"error": "导入根证书失败: " + err.Error()})
+			return
+		}
+		st, _ := caManager.Info()
+		c.JSON(200, gin.H{"ok": true, "ca": st, "message": "重启代理后生效"})
+	})
+
+	// 轮换：生成新的根证书，原证书移入 previous 目录；key_type=rsa|ecdsa
+	rotateCA := func(c *gin.Context) {
+		keyType := c.Query("key_type")
+		if err := (pxy.LeafCertConfig{KeyType: keyType}).Validate(); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := caManager.Rotate(keyType); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		st, _ := caManager.Info()
+		c.JSON(200, gin.H{"ok": true, "ca": st, "message": "重启代理后生效"})
+	}
+	api.POST("/proxy/ca/rotate", rotateCA)
+	api.POST("/proxy/ca/generate", rotateCA)
+
+	// 系统信任库（仅 Linux）：查看各信任库状态、安装与卸载当前根证书，卸载时同时移除轮换前的旧证书
+	api.GET("/proxy/ca/trust", trustStoreHandler((*pxy.LinuxTrustStore).Status))
+	api.POST("/proxy/ca/trust", trustStoreHandler((*pxy.LinuxTrustStore).Install))
+	api.DELETE("/proxy/ca/trust", trustStoreHandler((*pxy.LinuxTrustStore).Uninstall))
+}
+
+// trustStoreHandler 以当前根证书调用信任库操作并返回各信任库的状态
+func trustStoreHandler(op func(*pxy.LinuxTrustStore, *x509.Certificate) ([]pxy.TrustStoreStatus, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if runtime.GOOS != "linux" {
+			c.JSON(400, gin.H{"error": "系统信任库管理仅支持 Linux"})
+			return
+		}
+		cert, _, err := caManager.Load()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		statuses, err := op(pxy.NewLinuxTrustStore(), cert)
+		if err != nil {
+			status := 500
+			if errors.Is(err, pxy.ErrNoTrustStore) {
+				status = 404
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"stores": statuses})
+	}
+}
+
+// writeCAExport 导出根证书并作为附件返回
+func writeCAExport(c *gin.Context, opts pxy.CAExportOptions) {
+	exp, err := caManager.Export(opts)
+	if err != nil {
+		status := 400
+		if errors.Is(err, pxy.ErrCANotFound) {
+			status = 404
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", "attachment; filename="+exp.Filename)
+	c.Data(200, exp.ContentType, exp.Data)
+}
+
+// isLoopbackRequest 请求是否直接来自本机，不信任 X-Forwarded-For 等代理头
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
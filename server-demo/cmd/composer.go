@@ -0,0 +1,24 @@
+package main
+
+import (
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerComposerRoutes 注册构造请求相关的接口
+func registerComposerRoutes(api *gin.RouterGroup) {
+	api.POST("/compose", func(c *gin.Context) {
+		var req pxy.ComposeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		flow, err := flowSender().Compose(c.Request.Context(), &req)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, flow)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadFaultManager 加载持久化的故障注入规则
+func loadFaultManager() *pxy.FaultManager {
+	m, err := pxy.NewFaultManager(pxy.DefaultFaultRulesFile())
+	if err != nil {
+		log.Printf("加载故障注入规则失败: %v", err)
+	}
+	return m
+}
+
+// registerFaultRoutes 注册故障注入规则相关的接口
+func registerFaultRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/faults", func(c *gin.Context) {
+		c.JSON(200, faults.Rules())
+	})
+
+	api.POST("/proxy/faults", func(c *gin.Context) {
+		var rule pxy.FaultRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := faults.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/faults/:id", func(c *gin.Context) {
+		var rule pxy.FaultRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := faults.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(faultErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/faults/:id", func(c *gin.Context) {
+		if err := faults.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(faultErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func faultErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrFaultRuleNotFound) {
+		return 404
+	}
+	return 400
+}
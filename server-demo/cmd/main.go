@@ -23,6 +23,19 @@ var (
 	flowStore = storage.NewMemoryFlowStore()
 	proxyMu   sync.Mutex
 	proxyInst *pxy.EnhancedProxyServer
+
+	breakpoints = pxy.NewBreakpointManager()
+	rewriter    = loadRewriteEngine()
+	mapLocal    = loadMapLocalManager()
+	mapRemote   = loadMapRemoteManager()
+	mocks       = loadMockManager()
+	throttle    = loadThrottleManager()
+	faults      = loadFaultManager()
+	mitmPolicy  = loadMITMPolicy()
+	upstream    = loadUpstreamManager()
+	websockets  = loadWebSocketManager()
+	protos      = loadProtoManager()
+	caManager   = newCAManager()
 )
 
 // generateInstallScript 生成安装脚本和指引
@@ -55,6 +68,9 @@ func main() {
 	r.GET("/", func(c *gin.Context) {
 		c.Redirect(http.StatusFound, "/ui/")
 	})
+	// 设备接入页与证书下载只在独立的接入页端口提供，管理端口上的 /onboard 跳转过去
+	r.GET("/onboard", redirectOnboard)
+	go serveOnboard(onboardAddr())
 
 	api := r.Group("/api")
 	{
@@ -147,10 +163,30 @@ func main() {
 					limit = v
 				}
 			}
+			// 按应用层协议过滤（如 ?app_protocol=TLS），协议由载荷特征识别
+			if appProto := c.Query("app_protocol"); appProto != "" {
+				packets := st.GetPacketsByFilter(storage.Filter{AppProtocol: appProto})
+				if limit > 0 && len(packets) > limit {
+					packets = packets[len(packets)-limit:]
+				}
+				c.JSON(200, packets)
+				return
+			}
 			packets := st.GetPackets(limit)
 			c.JSON(200, packets)
 		})
 
+		api.GET("/conversations", func(c *gin.Context) {
+			capMu.Lock()
+			cp := capInst
+			capMu.Unlock()
+			if cp == nil {
+				c.JSON(200, []capture.Conversation{})
+				return
+			}
+			c.JSON(200, cp.Conversations())
+		})
+
 		api.GET("/stats", func(c *gin.Context) {
 			c.JSON(200, st.GetStats())
 		})
@@ -174,6 +210,33 @@ func main() {
 				addr = ":8899"
 			}
 			https := c.Query("https") == "1"
+			// 可选的 SOCKS5 监听，socks_user 非空时要求认证
+			socks := pxy.SOCKS5Config{Addr: c.Query("socks5"), Username: c.Query("socks_user"), Password: c.Query("socks_pass")}
+			// 可选的透明代理监听（仅 Linux），tproxy=1 时使用 TPROXY 模式
+			transparent := pxy.TransparentConfig{Addr: c.Query("transparent"), TProxy: c.Query("tproxy") == "1"}
+			// 可选的反向代理监听，将请求转发到 backend
+			reverse := pxy.ReverseConfig{
+				Addr:         c.Query("reverse"),
+				Backend:      c.Query("backend"),
+				TLS:          c.Query("reverse_tls") == "1",
+				PreserveHost: c.Query("preserve_host") == "1",
+			}
+			if err := reverse.Validate(); err != nil {
+				c.JSON(400, gin.H{"error": "反向代理配置无效: " + err.Error()})
+				return
+			}
+			// 流式响应的捕获上限
+			stream, err := streamConfigFromQuery(c)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "流式捕获配置无效: " + err.Error()})
+				return
+			}
+			// MITM 叶子证书私钥算法：ecdsa（默认）或 rsa；upstream_cert=0 时不复制上游证书
+			leaf := pxy.LeafCertConfig{KeyType: c.Query("leaf_key"), NoUpstream: c.Query("upstream_cert") == "0"}
+			if err := leaf.Validate(); err != nil {
+				c.JSON(400, gin.H{"error": "证书配置无效: " + err.Error()})
+				return
+			}
 			proxyMu.Lock()
 			if proxyInst != nil && proxyInst.IsRunning() {
 				proxyMu.Unlock()
@@ -181,10 +244,32 @@ func main() {
 				return
 			}
 			ps := pxy.NewEnhancedProxyServer(addr, https, flowStore)
+			ps.SetBreakpointManager(breakpoints)
+			ps.SetRewriteEngine(rewriter)
+			ps.SetMapLocalManager(mapLocal)
+			ps.SetMapRemoteManager(mapRemote)
+			ps.SetMockManager(mocks)
+			ps.SetThrottleManager(throttle)
+			ps.SetFaultManager(faults)
+			ps.SetMITMPolicy(mitmPolicy)
+			ps.SetUpstreamManager(upstream)
+			ps.SetWebSocketManager(websockets)
+			ps.SetSOCKS5(socks)
+			ps.SetTransparent(transparent)
+			ps.SetReverse(reverse)
+			ps.SetStreamConfig(stream)
+			ps.SetLeafCertConfig(leaf)
+			ps.SetCAManager(caManager)
+			// Start 完成监听后返回，端口占用、权限不足或证书初始化失败时直接报告
+			if err := ps.Start(); err != nil {
+				proxyInst = nil
+				proxyMu.Unlock()
+				c.JSON(500, gin.H{"error": "启动代理失败: " + err.Error()})
+				return
+			}
 			proxyInst = ps
 			proxyMu.Unlock()
-			go ps.Start()
-			c.JSON(200, gin.H{"ok": true, "addr": addr})
+			c.JSON(200, gin.H{"ok": true, "addr": addr, "socks5": socks.Addr, "transparent": transparent.Addr, "reverse": reverse.Addr})
 		})
 
 		api.POST("/proxy/stop", func(c *gin.Context) {
@@ -200,41 +285,14 @@ func main() {
 			c.JSON(200, gin.H{"ok": true})
 		})
 
-		// CA 证书：下载与（重新）生成
-		api.GET("/proxy/ca", func(c *gin.Context) {
-			_, _, files, err := pxy.LoadCAFromDisk()
-			if err != nil {
-				// 若不存在则尝试生成
-				_, _, files, err = pxy.GenerateCA()
-				if err != nil {
-					c.String(500, err.Error())
-					return
-				}
-			}
-			c.Header("Content-Disposition", "attachment; filename=proxy_root_ca.pem")
-			c.Header("Content-Type", "application/x-pem-file")
-			c.File(files.CertPath)
-		})
-		api.POST("/proxy/ca/generate", func(c *gin.Context) {
-			_, _, _, err := pxy.GenerateCA()
-			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return
-			}
-			c.JSON(200, gin.H{"ok": true})
-		})
-
 		// 新增：自动安装证书端点
 		api.POST("/proxy/ca/install", func(c *gin.Context) {
 			os := c.Query("os") // darwin/windows/linux
-			_, _, files, err := pxy.LoadCAFromDisk()
-			if err != nil {
-				_, _, files, err = pxy.GenerateCA()
-				if err != nil {
-					c.JSON(500, gin.H{"error": err.Error()})
-					return
-				}
+			if _, _, err := caManager.Ensure(); err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
 			}
+			files := caManager.Files()
 
 			// 根据操作系统返回安装脚本或执行命令
 			script, instructions := generateInstallScript(os, files.CertPath)
@@ -304,16 +362,34 @@ func main() {
 		})
 
 		api.DELETE("/flows", func(c *gin.Context) {
+			removeSpillFiles(flowStore.GetAll(0))
 			flowStore.Clear()
 			c.JSON(200, gin.H{"ok": true})
 		})
 
+		registerBreakpointRoutes(api)
+		registerRewriteRoutes(api)
+		registerMapLocalRoutes(api)
+		registerMapRemoteRoutes(api)
+		registerMockRoutes(api)
+		registerThrottleRoutes(api)
+		registerFaultRoutes(api)
+		registerMITMPolicyRoutes(api)
+		registerUpstreamRoutes(api)
+		registerTransparentRoutes(api)
+		registerWebSocketRoutes(api)
+		registerStreamRoutes(api)
+		registerProtobufRoutes(api)
+		registerCARoutes(api)
+		registerReplayRoutes(api)
+		registerComposerRoutes(api)
+
 		// 新增统计信息API
 		api.GET("/proxy/stats", func(c *gin.Context) {
 			proxyMu.Lock()
 			defer proxyMu.Unlock()
 			if proxyInst == nil {
-				c.JSON(200, gin.H{"network_stats": map[string]interface{}{}, "performance_stats": map[string]interface{}{}})
+				c.JSON(200, gin.H{"network_stats": map[string]interface{}{}, "performance_stats": map[string]interface{}{}, "cert_cache": nil})
 				return
 			}
 
@@ -323,6 +399,7 @@ func main() {
 			c.JSON(200, gin.H{
 				"network_stats":     networkStats,
 				"performance_stats": performanceStats,
+				"cert_cache":        proxyInst.GetCertCacheStats(),
 			})
 		})
 	}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadMapLocalManager 加载持久化的 Map Local 规则
+func loadMapLocalManager() *pxy.MapLocalManager {
+	m, err := pxy.NewMapLocalManager(pxy.DefaultMapLocalFile())
+	if err != nil {
+		log.Printf("加载 Map Local 规则失败: %v", err)
+	}
+	return m
+}
+
+// registerMapLocalRoutes 注册 Map Local 规则相关的接口
+func registerMapLocalRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/map-local", func(c *gin.Context) {
+		c.JSON(200, mapLocal.Rules())
+	})
+
+	api.POST("/proxy/map-local", func(c *gin.Context) {
+		var rule pxy.MapLocalRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mapLocal.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/map-local/:id", func(c *gin.Context) {
+		var rule pxy.MapLocalRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mapLocal.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(mapLocalErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/map-local/:id", func(c *gin.Context) {
+		if err := mapLocal.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(mapLocalErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func mapLocalErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrMapLocalRuleNotFound) {
+		return 404
+	}
+	return 400
+}
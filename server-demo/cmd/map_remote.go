@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadMapRemoteManager 加载持久化的 Map Remote 规则
+func loadMapRemoteManager() *pxy.MapRemoteManager {
+	m, err := pxy.NewMapRemoteManager(pxy.DefaultMapRemoteFile())
+	if err != nil {
+		log.Printf("加载 Map Remote 规则失败: %v", err)
+	}
+	return m
+}
+
+// registerMapRemoteRoutes 注册 Map Remote 规则相关的接口
+func registerMapRemoteRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/map-remote", func(c *gin.Context) {
+		c.JSON(200, mapRemote.Rules())
+	})
+
+	api.POST("/proxy/map-remote", func(c *gin.Context) {
+		var rule pxy.MapRemoteRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mapRemote.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/map-remote/:id", func(c *gin.Context) {
+		var rule pxy.MapRemoteRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mapRemote.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(mapRemoteErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/map-remote/:id", func(c *gin.Context) {
+		if err := mapRemote.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(mapRemoteErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func mapRemoteErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrMapRemoteRuleNotFound) {
+		return 404
+	}
+	return 400
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadMITMPolicy 加载持久化的 MITM 策略
+func loadMITMPolicy() *pxy.MITMPolicy {
+	m, err := pxy.NewMITMPolicy(pxy.DefaultMITMPolicyFile())
+	if err != nil {
+		log.Printf("加载MITM策略失败: %v", err)
+	}
+	return m
+}
+
+// registerMITMPolicyRoutes 注册 MITM 解密策略相关的接口
+func registerMITMPolicyRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/mitm", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"default_action":   mitmPolicy.DefaultAction(),
+			"auto_passthrough": mitmPolicy.AutoPassthrough(),
+			"rules":            mitmPolicy.Rules(),
+		})
+	})
+
+	// 未命中规则时的处理方式：mitm/passthrough/reject
+	api.PUT("/proxy/mitm/default", func(c *gin.Context) {
+		var body struct {
+			Action string `json:"action"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mitmPolicy.SetDefaultAction(body.Action); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "default_action": body.Action})
+	})
+
+	// 客户端反复拒绝代理证书时自动透传
+	api.PUT("/proxy/mitm/auto", func(c *gin.Context) {
+		var cfg pxy.AutoPassthroughConfig
+		if err := c.ShouldBindJSON(&cfg); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mitmPolicy.SetAutoPassthrough(cfg); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "auto_passthrough": mitmPolicy.AutoPassthrough()})
+	})
+
+	// 客户端握手失败（疑似证书固定）统计
+	api.GET("/proxy/mitm/failures", func(c *gin.Context) {
+		c.JSON(200, mitmPolicy.HandshakeFailures())
+	})
+
+	api.DELETE("/proxy/mitm/failures", func(c *gin.Context) {
+		mitmPolicy.ClearHandshakeFailures()
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	api.POST("/proxy/mitm/rules", func(c *gin.Context) {
+		var rule pxy.MITMRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mitmPolicy.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/mitm/rules/:id", func(c *gin.Context) {
+		var rule pxy.MITMRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mitmPolicy.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(mitmErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/mitm/rules/:id", func(c *gin.Context) {
+		if err := mitmPolicy.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(mitmErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func mitmErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrMITMRuleNotFound) {
+		return 404
+	}
+	return 400
+}
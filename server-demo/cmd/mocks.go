@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadMockManager 加载持久化的 Mock 与阻断规则
+func loadMockManager() *pxy.MockManager {
+	m, err := pxy.NewMockManager(pxy.DefaultMockRulesFile())
+	if err != nil {
+		log.Printf("加载 Mock 与阻断规则失败: %v", err)
+	}
+	return m
+}
+
+// registerMockRoutes 注册 Mock 与阻断规则相关的接口
+func registerMockRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/mocks", func(c *gin.Context) {
+		c.JSON(200, mocks.Rules())
+	})
+
+	api.POST("/proxy/mocks", func(c *gin.Context) {
+		var rule pxy.MockRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mocks.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/mocks/:id", func(c *gin.Context) {
+		var rule pxy.MockRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := mocks.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(mockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/mocks/:id", func(c *gin.Context) {
+		if err := mocks.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(mockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 清零命中次数
+	api.POST("/proxy/mocks/reset", func(c *gin.Context) {
+		_ = mocks.ResetHits("")
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	api.POST("/proxy/mocks/:id/reset", func(c *gin.Context) {
+		if err := mocks.ResetHits(c.Param("id")); err != nil {
+			c.JSON(mockErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func mockErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrMockRuleNotFound) {
+		return 404
+	}
+	return 400
+}
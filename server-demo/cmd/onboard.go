@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// onboardPlatform 接入页中单个平台的安装说明
+type onboardPlatform struct {
+	ID      string
+	Title   string
+	Steps   []string
+	Command string
+	Links   []onboardLink
+	Open    bool // 与访问设备匹配的平台默认展开
+}
+
+type onboardLink struct {
+	Name string
+	URL  string
+}
+
+// onboardEntry 一个局域网地址：接入页地址二维码与代理地址
+type onboardEntry struct {
+	PageURL   string
+	ProxyAddr string
+	QR        template.URL // 二维码 PNG 的 data URL
+}
+
+const caExportURL = "/onboard/ca?format="
+
+// onboardPlatforms 各平台的证书下载链接，安装说明来自 GetInstallInstructions
+var onboardPlatforms = []struct {
+	id    string
+	links []onboardLink
+}{
+	{"ios", []onboardLink{{"iOS 描述文件", caExportURL + pxy.CAFormatMobileConfig}}},
+	{"android", []onboardLink{{"证书 (.crt)", caExportURL + pxy.CAFormatCRT}, {"系统证书目录格式 (<hash>.0)", caExportURL + pxy.CAFormatAndroid}}},
+	{"darwin", []onboardLink{{"证书 (.pem)", caExportURL + pxy.CAFormatPEM}, {"描述文件", caExportURL + pxy.CAFormatMobileConfig}}},
+	{"windows", []onboardLink{{"证书 (.crt)", caExportURL + pxy.CAFormatCRT}}},
+	{"linux", []onboardLink{{"证书 (.pem)", caExportURL + pxy.CAFormatPEM}}},
+}
+
+// detectOS 根据 User-Agent 判断访问设备的平台
+func detectOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		return "ios"
+	case strings.Contains(ua, "Android"):
+		return "android"
+	case strings.Contains(ua, "Macintosh"):
+		return "darwin"
+	case strings.Contains(ua, "Windows"):
+		return "windows"
+	case strings.Contains(ua, "Linux"):
+		return "linux"
+	}
+	return ""
+}
+
+// proxyListenAddr 返回运行中代理的监听地址，未运行时为默认地址
+func proxyListenAddr() (addr string, running bool) {
+	proxyMu.Lock()
+	defer proxyMu.Unlock()
+	if proxyInst != nil && proxyInst.IsRunning() {
+		return proxyInst.Addr(), true
+	}
+	return ":8899", false
+}
+
+// onboardAddr 接入页监听地址，可通过 PROBE_ONBOARD_ADDR 环境变量配置，默认为 :8081
+func onboardAddr() string {
+	if addr := os.Getenv("PROBE_ONBOARD_ADDR"); addr != "" {
+		return addr
+	}
+	return ":8081"
+}
+
+// serveOnboard 在独立端口上只提供接入页与证书下载；管理接口仍在主端口上，需要另行限制访问
+func serveOnboard(addr string) {
+	r := gin.Default()
+	_ = r.SetTrustedProxies(nil)
+	r.GET("/", func(c *gin.Context) {
+		c.Redirect(http.StatusFound, "/onboard")
+	})
+	registerOnboardRoutes(r)
+	if err := r.Run(addr); err != nil {
+		log.Printf("接入页监听失败: %v", err)
+	}
+}
+
+// redirectOnboard 管理端口上的 /onboard 跳转到接入页监听，管理端口本身不提供接入页与证书下载
+func redirectOnboard(c *gin.Context) {
+	host, port, err := net.SplitHostPort(onboardAddr())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "接入页地址无效: " + err.Error()})
+		return
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = c.Request.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	c.Redirect(http.StatusFound, "http://"+net.JoinHostPort(host, port)+"/onboard")
+}
+
+// onboardEntries 为每个局域网地址生成指向接入页监听的地址与二维码；代理绑定了具体地址时只使用该地址
+func onboardEntries(proxyAddr string) []onboardEntry {
+	proxyHost, proxyPort, _ := net.SplitHostPort(proxyAddr)
+	_, webPort, _ := net.SplitHostPort(onboardAddr())
+	hosts := pxy.LANAddresses()
+	if ip := net.ParseIP(proxyHost); proxyHost != "" && (ip == nil || !ip.IsUnspecified()) {
+		hosts = []string{proxyHost}
+	}
+
+	entries := make([]onboardEntry, 0, len(hosts))
+	for _, host := range hosts {
+		pageHost := host
+		if webPort != "" {
+			pageHost = net.JoinHostPort(host, webPort)
+		}
+		e := onboardEntry{PageURL: "http://" + pageHost + "/onboard", ProxyAddr: net.JoinHostPort(host, proxyPort)}
+		if png, err := qrcode.Encode(e.PageURL, qrcode.Medium, 360); err == nil {
+			e.QR = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// registerOnboardRoutes 注册手机等设备的接入页：代理地址、接入页二维码与各平台证书下载（不含私钥）
+func registerOnboardRoutes(r gin.IRoutes) {
+	r.GET("/onboard/ca", func(c *gin.Context) {
+		writeCAExport(c, pxy.CAExportOptions{Format: c.DefaultQuery("format", pxy.CAFormatPEM)})
+	})
+	r.GET("/onboard", func(c *gin.Context) {
+		addr, running := proxyListenAddr()
+		st, err := caManager.Info()
+		if err != nil {
+			log.Printf("读取根证书失败: %v", err)
+		}
+
+		device := detectOS(c.Request.UserAgent())
+		platforms := make([]onboardPlatform, 0, len(onboardPlatforms))
+		for _, p := range onboardPlatforms {
+			inst := pxy.GetInstallInstructions(p.id)
+			title, _ := inst["title"].(string)
+			steps, _ := inst["steps"].([]string)
+			command, _ := inst["command"].(string)
+			platforms = append(platforms, onboardPlatform{
+				ID: p.id, Title: title, Steps: steps, Command: command, Links: p.links, Open: p.id == device,
+			})
+		}
+
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(200)
+		if err := onboardTemplate.Execute(c.Writer, gin.H{
+			"Entries":   onboardEntries(addr),
+			"Running":   running,
+			"CA":        st,
+			"Platforms": platforms,
+		}); err != nil {
+			log.Printf("渲染接入页失败: %v", err)
+		}
+	})
+}
+
+var onboardTemplate = template.Must(template.New("onboard").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>设备接入 - CetiProbe</title>
+<style>
+body{font-family:-apple-system,BlinkMacSystemFont,"Segoe UI",sans-serif;margin:0;padding:16px;background:#f5f6f8;color:#222;line-height:1.5}
+main{max-width:640px;margin:0 auto}
+section{background:#fff;border-radius:8px;padding:16px;margin-bottom:12px;box-shadow:0 1px 2px rgba(0,0,0,.06)}
+h1{font-size:20px;margin:0 0 12px}h2{font-size:16px;margin:0 0 8px}
+.entry{display:flex;flex-wrap:wrap;gap:16px;align-items:center}.entry img{width:180px;height:180px}
+code{background:#f0f1f3;padding:2px 6px;border-radius:4px;word-break:break-all}
+.warn{color:#b45309}.muted{color:#666;font-size:13px}
+a.btn{display:inline-block;margin:4px 8px 4px 0;padding:8px 12px;background:#4f46e5;color:#fff;border-radius:6px;text-decoration:none}
+summary{font-weight:600;cursor:pointer;padding:4px 0}.steps{white-space:pre-wrap;margin:8px 0}
+</style>
+</head>
+<body>
+<main>
+<h1>设备接入</h1>
+<section>
+<h2>代理地址</h2>
+{{if not .Running}}<p class="warn">代理尚未启动，以下为默认端口</p>{{end}}
+{{range .Entries}}
+<div class="entry">
+{{with .QR}}<img src="{{.}}" alt="接入页二维码">{{end}}
+<div>
+<div>代理：<code>{{.ProxyAddr}}</code></div>
+<div class="muted">手机扫码打开本页：<br><code>{{.PageURL}}</code></div>
+</div>
+</div>
+{{else}}
+<p class="warn">未检测到局域网地址</p>
+{{end}}
+</section>
+{{if .CA}}
+<section>
+<h2>根证书</h2>
+<div>{{.CA.Current.Subject}}</div>
+<div class="muted">有效期至 {{.CA.Current.NotAfter.Format "2006-01-02"}}（剩余 {{.CA.Current.DaysLeft}} 天）</div>
+<div class="muted">SHA-256 指纹：<code>{{.CA.Current.SHA256}}</code></div>
+</section>
+{{end}}
+{{range .Platforms}}
+<section>
+<details{{if .Open}} open{{end}}>
+<summary>{{.Title}}</summary>
+<div>{{range .Links}}<a class="btn" href="{{.URL}}">{{.Name}}</a>{{end}}</div>
+<div class="steps">{{range .Steps}}{{.}}
+{{end}}</div>
+{{if .Command}}<code>{{.Command}}</code>{{end}}
+</details>
+</section>
+{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadProtoManager 加载持久化的 protobuf schema
+func loadProtoManager() *pxy.ProtoManager {
+	m, err := pxy.NewProtoManager(pxy.DefaultProtoSchemaFile())
+	if err != nil {
+		log.Printf("加载protobuf schema失败: %v", err)
+	}
+	return m
+}
+
+// bindProtoSchema 读取上传的 schema：multipart 的 file 字段（.proto 按源码处理，其余按描述符集处理），或 JSON
+func bindProtoSchema(c *gin.Context) (*pxy.ProtoSchema, error) {
+	var schema pxy.ProtoSchema
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		err := c.ShouldBindJSON(&schema)
+		return &schema, err
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	schema.Name = c.PostForm("name")
+	if schema.Name == "" {
+		schema.Name = fh.Filename
+	}
+	if filepath.Ext(fh.Filename) == ".proto" {
+		schema.Source = string(data)
+	} else {
+		schema.DescriptorSet = data
+	}
+	return &schema, nil
+}
+
+// registerProtobufRoutes 注册 protobuf schema 管理与 gRPC/protobuf 消息体解码相关的接口
+func registerProtobufRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/protobuf/schemas", func(c *gin.Context) {
+		c.JSON(200, protos.Schemas())
+	})
+
+	api.POST("/proxy/protobuf/schemas", func(c *gin.Context) {
+		schema, err := bindProtoSchema(c)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := protos.Add(schema); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, schema)
+	})
+
+	api.DELETE("/proxy/protobuf/schemas/:id", func(c *gin.Context) {
+		if err := protos.Remove(c.Param("id")); err != nil {
+			status := 400
+			if errors.Is(err, pxy.ErrProtoSchemaNotFound) {
+				status = 404
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 按已上传的 schema 解码请求与响应，非 protobuf 的一侧为 null
+	api.GET("/flows/:id/protobuf", func(c *gin.Context) {
+		f := flowStore.GetByID(c.Param("id"))
+		if f == nil {
+			c.JSON(404, gin.H{"error": "not found"})
+			return
+		}
+		req, resp := protos.DecodeFlow(f)
+		c.JSON(200, gin.H{"request": req, "response": resp})
+	})
+}
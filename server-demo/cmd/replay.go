@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	senderOnce sync.Once
+	senderInst *pxy.EnhancedProxyServer
+)
+
+// flowSender 返回用于重放与构造请求的代理实例；代理未启动时使用独立实例，结果同样写入 flowStore
+func flowSender() *pxy.EnhancedProxyServer {
+	proxyMu.Lock()
+	ps := proxyInst
+	proxyMu.Unlock()
+	if ps != nil {
+		return ps
+	}
+	senderOnce.Do(func() {
+		senderInst = pxy.NewEnhancedProxyServer("", true, flowStore)
+		senderInst.SetUpstreamManager(upstream)
+	})
+	return senderInst
+}
+
+// registerReplayRoutes 注册重放相关的接口
+func registerReplayRoutes(api *gin.RouterGroup) {
+	api.POST("/flows/:id/replay", func(c *gin.Context) {
+		orig := flowStore.GetByID(c.Param("id"))
+		if orig == nil {
+			c.JSON(404, gin.H{"error": "not found"})
+			return
+		}
+		var opts pxy.ReplayOptions
+		if err := c.ShouldBindJSON(&opts); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		flows, err := flowSender().Replay(c.Request.Context(), orig, opts)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"original": orig.ID, "count": len(flows), "flows": flows})
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadRewriteEngine 加载持久化的改写规则，文件损坏时以空规则启动
+func loadRewriteEngine() *pxy.RewriteEngine {
+	e, err := pxy.NewRewriteEngine(pxy.DefaultRewriteRulesFile())
+	if err != nil {
+		log.Printf("加载改写规则失败: %v", err)
+	}
+	return e
+}
+
+// registerRewriteRoutes 注册改写规则相关的接口
+func registerRewriteRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/rules", func(c *gin.Context) {
+		c.JSON(200, rewriter.Rules())
+	})
+
+	api.POST("/proxy/rules", func(c *gin.Context) {
+		var rule pxy.RewriteRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := rewriter.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	// 整体替换规则列表，用于调整执行顺序
+	api.PUT("/proxy/rules", func(c *gin.Context) {
+		var rules []*pxy.RewriteRule
+		if err := c.ShouldBindJSON(&rules); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := rewriter.ReplaceRules(rules); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rewriter.Rules())
+	})
+
+	api.PUT("/proxy/rules/:id", func(c *gin.Context) {
+		var rule pxy.RewriteRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := rewriter.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(rewriteErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/rules/:id", func(c *gin.Context) {
+		if err := rewriter.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(rewriteErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func rewriteErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrRewriteRuleNotFound) {
+		return 404
+	}
+	return 400
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"probe/internal/models"
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamConfigFromQuery 读取 /proxy/start 的流式捕获参数：stream_memory、stream_disk（字节）与 stream_dir
+func streamConfigFromQuery(c *gin.Context) (pxy.StreamConfig, error) {
+	cfg := pxy.StreamConfig{Dir: c.Query("stream_dir")}
+	for name, dst := range map[string]*int64{"stream_memory": &cfg.MemoryLimit, "stream_disk": &cfg.DiskLimit} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("invalid %s: %q", name, v)
+		}
+		*dst = n
+	}
+	return cfg, nil
+}
+
+// removeSpillFiles 删除流式响应写入磁盘的文件；传输中的流结束时发现 Flow 已删除会自行删除文件
+func removeSpillFiles(flows []*models.Flow) {
+	for _, f := range flows {
+		if f.Stream != nil && f.Stream.SpillFile != "" && !f.InProgress {
+			os.Remove(f.Stream.SpillFile)
+		}
+	}
+}
+
+// registerStreamRoutes 注册流式响应相关的接口，并在 Flow 被淘汰时删除其磁盘文件
+func registerStreamRoutes(api *gin.RouterGroup) {
+	flowStore.OnEvict(func(f *models.Flow) {
+		removeSpillFiles([]*models.Flow{f})
+	})
+
+	// 下载完整的响应体，写入磁盘的流式响应从文件读取
+	api.GET("/flows/:id/body", func(c *gin.Context) {
+		f := flowStore.GetByID(c.Param("id"))
+		if f == nil || f.Response == nil {
+			c.JSON(404, gin.H{"error": "not found"})
+			return
+		}
+		contentType := f.Response.Headers["Content-Type"]
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if f.Stream != nil && f.Stream.SpillFile != "" {
+			c.Header("Content-Type", contentType)
+			c.File(f.Stream.SpillFile)
+			return
+		}
+		c.Data(200, contentType, f.Response.Body)
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadThrottleManager 加载持久化的网络模拟配置
+func loadThrottleManager() *pxy.ThrottleManager {
+	m, err := pxy.NewThrottleManager(pxy.DefaultThrottleFile())
+	if err != nil {
+		log.Printf("加载网络模拟配置失败: %v", err)
+	}
+	return m
+}
+
+// registerThrottleRoutes 注册网络条件模拟相关的接口
+func registerThrottleRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/throttle", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"global":  throttle.Global(),
+			"rules":   throttle.Rules(),
+			"presets": pxy.ThrottlePresets(),
+		})
+	})
+
+	api.GET("/proxy/throttle/presets", func(c *gin.Context) {
+		c.JSON(200, pxy.ThrottlePresets())
+	})
+
+	// 全局网络条件，提交空对象表示关闭
+	api.PUT("/proxy/throttle/global", func(c *gin.Context) {
+		var s pxy.ThrottleSetting
+		if err := c.ShouldBindJSON(&s); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := throttle.SetGlobal(&s); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "global": throttle.Global()})
+	})
+
+	api.DELETE("/proxy/throttle/global", func(c *gin.Context) {
+		if err := throttle.SetGlobal(nil); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	api.POST("/proxy/throttle/rules", func(c *gin.Context) {
+		var rule pxy.ThrottleRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := throttle.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/throttle/rules/:id", func(c *gin.Context) {
+		var rule pxy.ThrottleRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := throttle.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(throttleErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/throttle/rules/:id", func(c *gin.Context) {
+		if err := throttle.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(throttleErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func throttleErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrThrottleRuleNotFound) {
+		return 404
+	}
+	return 400
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerTransparentRoutes 注册透明代理 nftables 规则相关的接口
+func registerTransparentRoutes(api *gin.RouterGroup) {
+	// 生成规则，apply 为 true 时直接执行（需要 root，仅接受本机请求）
+	api.POST("/proxy/transparent/rules", func(c *gin.Context) {
+		var body struct {
+			pxy.TransparentRuleOptions
+			Apply bool `json:"apply"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		rules, err := pxy.BuildTransparentRules(body.TransparentRuleOptions)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Apply {
+			if !isLoopbackRequest(c.Request) {
+				c.JSON(403, gin.H{"error": "规则仅允许从本机应用"})
+				return
+			}
+			if err := rules.Apply(); err != nil {
+				c.JSON(500, gin.H{"error": "应用规则失败: " + err.Error()})
+				return
+			}
+		}
+		c.JSON(200, gin.H{"ok": true, "applied": body.Apply, "rules": rules, "shell": rules.String()})
+	})
+
+	// 删除规则，仅接受本机请求
+	api.DELETE("/proxy/transparent/rules", func(c *gin.Context) {
+		if !isLoopbackRequest(c.Request) {
+			c.JSON(403, gin.H{"error": "规则仅允许从本机删除"})
+			return
+		}
+		pxy.RemoveTransparentRules()
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadUpstreamManager 加载持久化的上游代理配置
+func loadUpstreamManager() *pxy.UpstreamManager {
+	m, err := pxy.NewUpstreamManager(pxy.DefaultUpstreamFile())
+	if err != nil {
+		log.Printf("加载上游代理配置失败: %v", err)
+	}
+	return m
+}
+
+// registerUpstreamRoutes 注册上游代理相关的接口
+func registerUpstreamRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/upstream", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"default": upstream.Default(),
+			"proxies": upstream.Proxies(),
+			"rules":   upstream.Rules(),
+		})
+	})
+
+	// 默认路由：上游代理ID、direct 或 env
+	api.PUT("/proxy/upstream/default", func(c *gin.Context) {
+		var body struct {
+			Upstream string `json:"upstream"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstream.SetDefault(body.Upstream); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "default": body.Upstream})
+	})
+
+	api.POST("/proxy/upstream/proxies", func(c *gin.Context) {
+		var u pxy.UpstreamProxy
+		if err := c.ShouldBindJSON(&u); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstream.AddProxy(&u); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "id": u.ID})
+	})
+
+	api.PUT("/proxy/upstream/proxies/:id", func(c *gin.Context) {
+		var u pxy.UpstreamProxy
+		if err := c.ShouldBindJSON(&u); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstream.UpdateProxy(c.Param("id"), &u); err != nil {
+			c.JSON(upstreamErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true, "id": u.ID})
+	})
+
+	api.DELETE("/proxy/upstream/proxies/:id", func(c *gin.Context) {
+		if err := upstream.RemoveProxy(c.Param("id")); err != nil {
+			c.JSON(upstreamErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	api.POST("/proxy/upstream/rules", func(c *gin.Context) {
+		var rule pxy.UpstreamRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstream.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/upstream/rules/:id", func(c *gin.Context) {
+		var rule pxy.UpstreamRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := upstream.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(upstreamErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/upstream/rules/:id", func(c *gin.Context) {
+		if err := upstream.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(upstreamErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+}
+
+func upstreamErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, pxy.ErrUpstreamInUse):
+		return 409
+	case errors.Is(err, pxy.ErrUpstreamRuleNotFound), errors.Is(err, pxy.ErrUpstreamNotFound):
+		return 404
+	}
+	return 400
+}
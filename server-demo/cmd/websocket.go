@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+
+	pxy "probe/internal/proxy"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadWebSocketManager 加载持久化的 WebSocket 消息规则
+func loadWebSocketManager() *pxy.WebSocketManager {
+	m, err := pxy.NewWebSocketManager(pxy.DefaultWebSocketFile())
+	if err != nil {
+		log.Printf("加载WebSocket规则失败: %v", err)
+	}
+	return m
+}
+
+// registerWebSocketRoutes 注册 WebSocket 消息规则、断点、注入与实时推送相关的接口
+func registerWebSocketRoutes(api *gin.RouterGroup) {
+	api.GET("/proxy/websocket/rules", func(c *gin.Context) {
+		c.JSON(200, websockets.Rules())
+	})
+
+	api.POST("/proxy/websocket/rules", func(c *gin.Context) {
+		var rule pxy.WebSocketRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := websockets.AddRule(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.PUT("/proxy/websocket/rules/:id", func(c *gin.Context) {
+		var rule pxy.WebSocketRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if err := websockets.UpdateRule(c.Param("id"), &rule); err != nil {
+			c.JSON(websocketErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, rule)
+	})
+
+	api.DELETE("/proxy/websocket/rules/:id", func(c *gin.Context) {
+		if err := websockets.RemoveRule(c.Param("id")); err != nil {
+			c.JSON(websocketErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 活动连接
+	api.GET("/proxy/websocket/sessions", func(c *gin.Context) {
+		c.JSON(200, websockets.Sessions())
+	})
+
+	// 命中 break 规则挂起的消息
+	api.GET("/proxy/websocket/pending", func(c *gin.Context) {
+		c.JSON(200, websockets.Pending())
+	})
+
+	api.POST("/proxy/websocket/pending/:id/resume", func(c *gin.Context) {
+		var d pxy.WebSocketDecision
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&d); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if err := websockets.Resolve(c.Param("id"), d); err != nil {
+			c.JSON(websocketErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	api.POST("/proxy/websocket/pending/:id/drop", func(c *gin.Context) {
+		if err := websockets.Resolve(c.Param("id"), pxy.WebSocketDecision{Action: pxy.WSDecisionDrop}); err != nil {
+			c.JSON(websocketErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"ok": true})
+	})
+
+	// 向连接注入消息，direction 为模拟的发送方
+	api.POST("/flows/:id/ws/send", func(c *gin.Context) {
+		var body struct {
+			Direction     string  `json:"direction"`
+			Type          string  `json:"type"`
+			Payload       string  `json:"payload"`
+			PayloadBase64 *string `json:"payload_base64"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		payload := []byte(body.Payload)
+		if body.PayloadBase64 != nil {
+			var err error
+			if payload, err = base64.StdEncoding.DecodeString(*body.PayloadBase64); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		msg, err := websockets.Inject(c.Param("id"), body.Direction, body.Type, payload)
+		if err != nil {
+			c.JSON(websocketErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, msg)
+	})
+
+	// 消息记录：活动连接返回实时快照，已结束的连接返回 Flow 中保存的记录
+	api.GET("/flows/:id/ws/messages", func(c *gin.Context) {
+		if info, err := websockets.Info(c.Param("id")); err == nil {
+			c.JSON(200, info)
+			return
+		}
+		f := flowStore.GetByID(c.Param("id"))
+		if f == nil || f.WebSocket == nil {
+			c.JSON(404, gin.H{"error": "WebSocket连接不存在"})
+			return
+		}
+		c.JSON(200, f.WebSocket)
+	})
+
+	// 以 SSE 实时推送消息
+	api.GET("/flows/:id/ws/stream", func(c *gin.Context) {
+		streamWebSocketEvents(c, c.Param("id"))
+	})
+	api.GET("/proxy/websocket/stream", func(c *gin.Context) {
+		streamWebSocketEvents(c, "")
+	})
+}
+
+func streamWebSocketEvents(c *gin.Context, flowID string) {
+	events, cancel := websockets.Subscribe(flowID)
+	defer cancel()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case ev := <-events:
+			c.SSEvent("message", ev)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func websocketErrorStatus(err error) int {
+	if errors.Is(err, pxy.ErrWebSocketRuleNotFound) || errors.Is(err, pxy.ErrWebSocketSessionNotFound) || errors.Is(err, pxy.ErrPendingNotFound) {
+		return 404
+	}
+	return 400
+}
@@ -24,6 +24,7 @@ type Capturer struct {
 	mu            sync.RWMutex
 	domainMap     map[string]string // IP到域名的映射
 	domainMu      sync.RWMutex      // 保护domainMap的互斥锁
+	classifier    *ProtocolClassifier
 }
 
 func NewCapturer(interfaceName string, st storage.Storage) (*Capturer, error) {
@@ -32,8 +33,8 @@ func NewCapturer(interfaceName string, st storage.Storage) (*Capturer, error) {
 		return nil, fmt.Errorf("打开网络接口失败: %v", err)
 	}
 
-	// 设置过滤器，只捕获HTTP/HTTPS流量
-	err = handle.SetBPFFilter("tcp port 80 or tcp port 443 or tcp port 8080 or tcp port 3000 or udp port 53")
+	// 设置过滤器：捕获全部TCP/UDP流量，应用层协议由载荷特征识别而非端口决定
+	err = handle.SetBPFFilter("tcp or udp")
 	if err != nil {
 		return nil, fmt.Errorf("设置BPF过滤器失败: %v", err)
 	}
@@ -44,6 +45,7 @@ func NewCapturer(interfaceName string, st storage.Storage) (*Capturer, error) {
 		storage:       st,
 		running:       false,
 		domainMap:     make(map[string]string),
+		classifier:    NewProtocolClassifier(),
 	}, nil
 }
 
@@ -91,6 +93,11 @@ func (c *Capturer) IsRunning() bool {
 	return c.running
 }
 
+// Conversations 返回抓包过程中识别出的会话列表
+func (c *Capturer) Conversations() []Conversation {
+	return c.classifier.Conversations()
+}
+
 // processPacket 分层输出数据包的详细信息
 func (c *Capturer) processPacket(packet gopacket.Packet) {
 	// 解析网络层
@@ -107,11 +114,6 @@ func (c *Capturer) processPacket(packet gopacket.Packet) {
 		return
 	}
 
-	applicationLayer := packet.ApplicationLayer()
-	if applicationLayer == nil {
-		return
-	}
-
 	var packetInfo models.PacketInfo
 	// 输出数据包元信息
 	metaInfo := layer.ExtractPacketMetadataInfo(packet)
@@ -143,6 +145,17 @@ func (c *Capturer) processPacket(packet gopacket.Packet) {
 		packetInfo.ErrorLayer = layer.ExtractErrorLayerInfo(errLayer)
 	}
 
+	// 识别应用层协议：无载荷的数据包（SYN、纯 ACK 等）同样参与会话跟踪与方向判断
+	applicationLayer := packet.ApplicationLayer()
+	var payload []byte
+	if applicationLayer != nil {
+		payload = applicationLayer.Payload()
+	}
+	c.classifier.Classify(&packetInfo, payload)
+	if applicationLayer == nil {
+		return
+	}
+
 	if packetInfo.ApplicationLayer.Domain != "" && strings.Contains(packetInfo.ApplicationLayer.Domain, "code") {
 		savePacketInfoToJSON(&packetInfo)
 	}
@@ -10,7 +10,7 @@ func TestNewCapturer(t *testing.T) {
 	// 在实际环境中，可以使用mock或虚拟接口进行更完整的测试
 
 	// 测试使用无效接口名称的情况
-	_, err := NewCapturer("en0")
+	_, err := NewCapturer("en0", nil)
 	if err == nil {
 		t.Fatalf("Expected error when creating capturer with invalid interface name, but got nil")
 	}
@@ -0,0 +1,175 @@
+package capture
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"probe/internal/capture/layer"
+	"probe/internal/models"
+)
+
+const (
+	// maxSignatureAttempts 会话在放弃特征识别、改用端口推测前检查的载荷包数量
+	maxSignatureAttempts = 8
+	// conversationIdleTimeout 会话空闲超过该时间后被清理
+	conversationIdleTimeout = 2 * time.Minute
+	// sweepInterval 每处理多少个数据包清理一次空闲会话
+	sweepInterval = 1024
+)
+
+// Conversation 表示一条传输层会话（双向五元组）及其识别出的应用层协议
+type Conversation struct {
+	ID          string    `json:"id"`
+	Transport   string    `json:"transport"`
+	ClientAddr  string    `json:"client_addr"`
+	ServerAddr  string    `json:"server_addr"`
+	AppProtocol string    `json:"app_protocol"`
+	Method      string    `json:"method"` // 识别方式：signature/flow/port
+	Packets     int       `json:"packets"`
+	Bytes       int       `json:"bytes"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+
+	attempts int
+}
+
+// ProtocolClassifier 基于载荷特征与会话行为识别应用层协议，不依赖端口号
+type ProtocolClassifier struct {
+	mu            sync.Mutex
+	conversations map[string]*Conversation
+	processed     int
+}
+
+// NewProtocolClassifier 创建协议识别器
+func NewProtocolClassifier() *ProtocolClassifier {
+	return &ProtocolClassifier{
+		conversations: make(map[string]*Conversation),
+	}
+}
+
+// Classify 识别数据包所属会话与应用层协议，并写回 packet
+func (pc *ProtocolClassifier) Classify(packet *models.PacketInfo, payload []byte) {
+	if packet.NetworkLayer == nil || packet.TransportLayer == nil {
+		return
+	}
+	tl := packet.TransportLayer
+	src := fmt.Sprintf("%s:%d", packet.NetworkLayer.SrcIP, tl.SrcPort)
+	dst := fmt.Sprintf("%s:%d", packet.NetworkLayer.DstIP, tl.DstPort)
+	key := conversationKey(tl.Protocol, src, dst)
+
+	now := time.Now()
+	if packet.Metadata != nil && !packet.Metadata.CaptureTime.IsZero() {
+		now = packet.Metadata.CaptureTime
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	pc.processed++
+	if pc.processed%sweepInterval == 0 {
+		pc.sweepLocked(now)
+	}
+
+	conv, ok := pc.conversations[key]
+	if !ok {
+		// 默认把先发包的一方视为客户端，SYN 包可直接确定方向
+		client, server := src, dst
+		if tl.IsSYN && tl.IsACK {
+			client, server = dst, src
+		}
+		conv = &Conversation{
+			ID:         key,
+			Transport:  tl.Protocol,
+			ClientAddr: client,
+			ServerAddr: server,
+			FirstSeen:  now,
+		}
+		pc.conversations[key] = conv
+	}
+	conv.Packets++
+	conv.Bytes += len(payload)
+	conv.LastSeen = now
+
+	// 已通过特征识别的会话，后续数据包（如加密后的应用数据、QUIC 短包头）沿用该协议
+	if conv.Method == layer.DetectBySignature {
+		packet.ConversationID = conv.ID
+		packet.AppProtocol = conv.AppProtocol
+		packet.AppProtocolMethod = layer.DetectByFlow
+		return
+	}
+
+	if len(payload) > 0 {
+		conv.attempts++
+		if det, ok := layer.DetectAppProtocol(tl.Protocol, payload); ok {
+			conv.AppProtocol = det.Protocol
+			conv.Method = layer.DetectBySignature
+			if det.FromClient {
+				conv.ClientAddr, conv.ServerAddr = src, dst
+			} else if det.Protocol == layer.AppProtocolMySQL {
+				// MySQL 由服务端先发送握手包
+				conv.ClientAddr, conv.ServerAddr = dst, src
+			}
+			packet.ConversationID = conv.ID
+			packet.AppProtocol = det.Protocol
+			packet.AppProtocolMethod = layer.DetectBySignature
+			return
+		}
+	}
+
+	if conv.Method == "" && conv.attempts >= maxSignatureAttempts {
+		if p, ok := layer.GuessAppProtocolByPort(tl.Protocol, tl.SrcPort, tl.DstPort); ok {
+			conv.AppProtocol = p
+		} else {
+			conv.AppProtocol = layer.AppProtocolUnknown
+		}
+		conv.Method = layer.DetectByPort
+	}
+
+	packet.ConversationID = conv.ID
+	if conv.Method == layer.DetectByPort {
+		packet.AppProtocol = conv.AppProtocol
+		packet.AppProtocolMethod = layer.DetectByPort
+		return
+	}
+	// 仍在尝试识别阶段：单包先给出端口推测，会话状态保持未定
+	if p, ok := layer.GuessAppProtocolByPort(tl.Protocol, tl.SrcPort, tl.DstPort); ok {
+		packet.AppProtocol = p
+		packet.AppProtocolMethod = layer.DetectByPort
+	} else {
+		packet.AppProtocol = layer.AppProtocolUnknown
+	}
+}
+
+// Conversations 返回当前跟踪的会话，按最近活跃时间倒序
+func (pc *ProtocolClassifier) Conversations() []Conversation {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	list := make([]Conversation, 0, len(pc.conversations))
+	for _, c := range pc.conversations {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LastSeen.After(list[j].LastSeen)
+	})
+	return list
+}
+
+// sweepLocked 清理空闲会话，调用方需持有锁
+func (pc *ProtocolClassifier) sweepLocked(now time.Time) {
+	for k, c := range pc.conversations {
+		if now.Sub(c.LastSeen) > conversationIdleTimeout {
+			delete(pc.conversations, k)
+		}
+	}
+}
+
+// conversationKey 生成与方向无关的会话键
+func conversationKey(transport, a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return transport + " " + a + " <-> " + b
+}
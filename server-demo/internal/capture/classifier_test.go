@@ -0,0 +1,112 @@
+package capture
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"probe/internal/capture/layer"
+	"probe/internal/models"
+)
+
+// newTestPacket 构造一个只含网络层与传输层信息的数据包
+func newTestPacket(transport, src string, srcPort uint16, dst string, dstPort uint16) *models.PacketInfo {
+	return &models.PacketInfo{
+		Metadata:       &layer.PacketMetadataInfo{CaptureTime: time.Now()},
+		NetworkLayer:   &layer.NetworkLayerInfo{SrcIP: src, DstIP: dst},
+		TransportLayer: &layer.TransportLayerInfo{Protocol: transport, SrcPort: srcPort, DstPort: dstPort},
+	}
+}
+
+// TestClassifierConversation 测试双向数据包归入同一会话、SYN 确定方向以及特征识别后的沿用
+func TestClassifierConversation(t *testing.T) {
+	pc := NewProtocolClassifier()
+
+	// 服务端的 SYN-ACK 先被捕获：客户端应为对端
+	synAck := newTestPacket("TCP", "10.0.0.2", 8443, "10.0.0.1", 50000)
+	synAck.TransportLayer.IsSYN, synAck.TransportLayer.IsACK = true, true
+	pc.Classify(synAck, nil)
+
+	hello := newTestPacket("TCP", "10.0.0.1", 50000, "10.0.0.2", 8443)
+	pc.Classify(hello, []byte{0x16, 0x03, 0x01, 0x00, 0xc8, 0x01, 0x00, 0x00, 0xc4, 0x03, 0x03})
+	if hello.AppProtocol != layer.AppProtocolTLS || hello.AppProtocolMethod != layer.DetectBySignature {
+		t.Fatalf("client hello: got %s/%s", hello.AppProtocol, hello.AppProtocolMethod)
+	}
+	if hello.ConversationID != synAck.ConversationID {
+		t.Fatalf("both directions should share a conversation: %q vs %q", hello.ConversationID, synAck.ConversationID)
+	}
+
+	// 加密后的应用数据无法单独识别，沿用会话结果
+	data := newTestPacket("TCP", "10.0.0.2", 8443, "10.0.0.1", 50000)
+	pc.Classify(data, []byte{0xde, 0xad, 0xbe, 0xef})
+	if data.AppProtocol != layer.AppProtocolTLS || data.AppProtocolMethod != layer.DetectByFlow {
+		t.Fatalf("follow-up packet: got %s/%s", data.AppProtocol, data.AppProtocolMethod)
+	}
+
+	convs := pc.Conversations()
+	if len(convs) != 1 {
+		t.Fatalf("expected 1 conversation, got %d", len(convs))
+	}
+	c := convs[0]
+	if c.ClientAddr != "10.0.0.1:50000" || c.ServerAddr != "10.0.0.2:8443" || c.Packets != 3 {
+		t.Fatalf("unexpected conversation: %+v", c)
+	}
+
+	// MySQL 由服务端先发握手包，识别后客户端应为对端
+	greeting := newTestPacket("TCP", "10.0.0.3", 13306, "10.0.0.1", 40000)
+	pc.Classify(greeting, []byte{0x07, 0x00, 0x00, 0x00, 0x0a, 0x38, 0x2e, 0x30, 0x2e, 0x30, 0x00})
+	for _, c := range pc.Conversations() {
+		if c.ID == greeting.ConversationID && (c.AppProtocol != layer.AppProtocolMySQL || c.ClientAddr != "10.0.0.1:40000") {
+			t.Fatalf("unexpected mysql conversation: %+v", c)
+		}
+	}
+}
+
+// TestClassifierPortFallback 测试载荷始终无法识别时，超过尝试次数后改用端口推测并固定到会话
+func TestClassifierPortFallback(t *testing.T) {
+	pc := NewProtocolClassifier()
+	junk := bytes.Repeat([]byte{0xff}, 16)
+
+	var pkt *models.PacketInfo
+	for i := 0; i < maxSignatureAttempts-1; i++ {
+		pkt = newTestPacket("TCP", "10.0.0.1", 50001, "10.0.0.2", 22)
+		pc.Classify(pkt, junk)
+	}
+	// 尝试阶段单包给出端口推测，但会话尚未确定
+	if pkt.AppProtocol != layer.AppProtocolSSH || pkt.AppProtocolMethod != layer.DetectByPort {
+		t.Fatalf("pending packet: got %s/%s", pkt.AppProtocol, pkt.AppProtocolMethod)
+	}
+	if c := pc.Conversations()[0]; c.Method != "" {
+		t.Fatalf("conversation should still be undecided, got %q", c.Method)
+	}
+
+	pkt = newTestPacket("TCP", "10.0.0.2", 22, "10.0.0.1", 50001)
+	pc.Classify(pkt, junk)
+	c := pc.Conversations()[0]
+	if c.Method != layer.DetectByPort || c.AppProtocol != layer.AppProtocolSSH {
+		t.Fatalf("expected port fallback, got %+v", c)
+	}
+
+	// 之后出现可识别的载荷时，特征识别结果覆盖端口推测
+	pkt = newTestPacket("TCP", "10.0.0.1", 50001, "10.0.0.2", 22)
+	pc.Classify(pkt, []byte("GET / HTTP/1.1\r\n\r\n"))
+	if c := pc.Conversations()[0]; c.Method != layer.DetectBySignature || c.AppProtocol != layer.AppProtocolHTTP {
+		t.Fatalf("signature should override port guess, got %+v", c)
+	}
+
+	// 无载荷的数据包不计入尝试次数，未知端口回退为 unknown
+	other := NewProtocolClassifier()
+	for i := 0; i < maxSignatureAttempts; i++ {
+		pkt = newTestPacket("UDP", "10.0.0.1", 50002, "10.0.0.2", 40000)
+		other.Classify(pkt, nil)
+	}
+	if c := other.Conversations()[0]; c.Method != "" {
+		t.Fatalf("empty packets should not exhaust signature attempts: %+v", c)
+	}
+	for i := 0; i < maxSignatureAttempts; i++ {
+		other.Classify(pkt, junk)
+	}
+	if c := other.Conversations()[0]; c.Method != layer.DetectByPort || c.AppProtocol != layer.AppProtocolUnknown {
+		t.Fatalf("expected unknown port fallback, got %+v", c)
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func main() {
-	capturer, err := capture.NewCapturer("en1")
+	capturer, err := capture.NewCapturer("en1", nil)
 	if err != nil {
 		log.Fatalf("Error when creating capturer: %v", err)
 	}
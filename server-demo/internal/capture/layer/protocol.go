@@ -0,0 +1,289 @@
+package layer
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// 应用层协议名称
+const (
+	AppProtocolUnknown    = "UNKNOWN"
+	AppProtocolHTTP       = "HTTP"
+	AppProtocolHTTP2      = "HTTP2"
+	AppProtocolTLS        = "TLS"
+	AppProtocolSSH        = "SSH"
+	AppProtocolDNS        = "DNS"
+	AppProtocolQUIC       = "QUIC"
+	AppProtocolRDP        = "RDP"
+	AppProtocolSMB        = "SMB"
+	AppProtocolMySQL      = "MySQL"
+	AppProtocolPostgreSQL = "PostgreSQL"
+	AppProtocolRedis      = "Redis"
+	AppProtocolMongoDB    = "MongoDB"
+)
+
+// 协议识别方式
+const (
+	DetectBySignature = "signature" // 根据载荷特征识别
+	DetectByFlow      = "flow"      // 沿用所属会话已识别的协议
+	DetectByPort      = "port"      // 无法识别载荷时按知名端口推测
+)
+
+// ProtocolDetection 一次协议识别的结果
+type ProtocolDetection struct {
+	Protocol string `json:"protocol"` // 应用层协议
+	Method   string `json:"method"`   // 识别方式
+	// FromClient 为 true 表示当前载荷是会话发起方（客户端）发出的，
+	// 仅在能从特征判断方向时有意义（如 ClientHello、HTTP 请求）
+	FromClient bool `json:"from_client"`
+}
+
+var httpMethods = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("DELETE "), []byte("HEAD "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "), []byte("TRACE "),
+}
+
+var http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+
+// DetectAppProtocol 根据载荷特征识别应用层协议，不依赖端口号。
+// transport 为 "TCP" 或 "UDP"；无法识别时返回 ok=false。
+func DetectAppProtocol(transport string, payload []byte) (ProtocolDetection, bool) {
+	if len(payload) == 0 {
+		return ProtocolDetection{}, false
+	}
+	if transport == "UDP" {
+		if isQUICLongHeader(payload) {
+			return ProtocolDetection{Protocol: AppProtocolQUIC, Method: DetectBySignature}, true
+		}
+		if isDNSMessage(payload) {
+			return ProtocolDetection{Protocol: AppProtocolDNS, Method: DetectBySignature, FromClient: payload[2]&0x80 == 0}, true
+		}
+		return ProtocolDetection{}, false
+	}
+
+	switch {
+	case bytes.HasPrefix(payload, http2Preface):
+		return ProtocolDetection{Protocol: AppProtocolHTTP2, Method: DetectBySignature, FromClient: true}, true
+	case isHTTPRequest(payload):
+		return ProtocolDetection{Protocol: AppProtocolHTTP, Method: DetectBySignature, FromClient: true}, true
+	case bytes.HasPrefix(payload, []byte("HTTP/1.")):
+		return ProtocolDetection{Protocol: AppProtocolHTTP, Method: DetectBySignature}, true
+	case bytes.HasPrefix(payload, []byte("SSH-")):
+		return ProtocolDetection{Protocol: AppProtocolSSH, Method: DetectBySignature}, true
+	case isTLSRecord(payload):
+		// 握手类型 0x01 为 ClientHello
+		fromClient := payload[0] == 0x16 && len(payload) > 5 && payload[5] == 0x01
+		return ProtocolDetection{Protocol: AppProtocolTLS, Method: DetectBySignature, FromClient: fromClient}, true
+	case isRDPConnection(payload):
+		return ProtocolDetection{Protocol: AppProtocolRDP, Method: DetectBySignature, FromClient: payload[5]&0xf0 == 0xe0}, true
+	case isSMBMessage(payload):
+		return ProtocolDetection{Protocol: AppProtocolSMB, Method: DetectBySignature}, true
+	case isPostgreSQLStartup(payload):
+		return ProtocolDetection{Protocol: AppProtocolPostgreSQL, Method: DetectBySignature, FromClient: true}, true
+	case isMySQLGreeting(payload):
+		return ProtocolDetection{Protocol: AppProtocolMySQL, Method: DetectBySignature}, true
+	case isMongoDBMessage(payload):
+		return ProtocolDetection{Protocol: AppProtocolMongoDB, Method: DetectBySignature}, true
+	case isRedisCommand(payload):
+		return ProtocolDetection{Protocol: AppProtocolRedis, Method: DetectBySignature, FromClient: true}, true
+	case len(payload) > 2 && isDNSMessage(payload[2:]) && int(binary.BigEndian.Uint16(payload)) == len(payload)-2:
+		// TCP 上的 DNS 带 2 字节长度前缀
+		return ProtocolDetection{Protocol: AppProtocolDNS, Method: DetectBySignature, FromClient: payload[4]&0x80 == 0}, true
+	}
+	return ProtocolDetection{}, false
+}
+
+// wellKnownPorts 仅用于载荷无法识别时的兜底推测
+var wellKnownPorts = map[string]map[uint16]string{
+	"TCP": {
+		22: AppProtocolSSH, 53: AppProtocolDNS, 80: AppProtocolHTTP, 443: AppProtocolTLS,
+		445: AppProtocolSMB, 3306: AppProtocolMySQL, 3389: AppProtocolRDP, 5432: AppProtocolPostgreSQL,
+		6379: AppProtocolRedis, 27017: AppProtocolMongoDB,
+	},
+	"UDP": {
+		53: AppProtocolDNS, 443: AppProtocolQUIC, 5353: AppProtocolDNS,
+	},
+}
+
+// GuessAppProtocolByPort 按知名端口推测协议，优先使用目标端口
+func GuessAppProtocolByPort(transport string, srcPort, dstPort uint16) (string, bool) {
+	ports := wellKnownPorts[transport]
+	if p, ok := ports[dstPort]; ok {
+		return p, true
+	}
+	if p, ok := ports[srcPort]; ok {
+		return p, true
+	}
+	return "", false
+}
+
+func isHTTPRequest(payload []byte) bool {
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(payload, m) {
+			// 请求行中应包含 HTTP 版本号
+			line := payload
+			if i := bytes.IndexByte(payload, '\n'); i >= 0 {
+				line = payload[:i]
+			}
+			return bytes.Contains(line, []byte(" HTTP/"))
+		}
+	}
+	return false
+}
+
+// isTLSRecord 检查 TLS 记录层头部：类型(20-23) + 版本(3.x) + 合理的长度
+func isTLSRecord(payload []byte) bool {
+	if len(payload) < 5 {
+		return false
+	}
+	if payload[0] < 0x14 || payload[0] > 0x17 {
+		return false
+	}
+	if payload[1] != 0x03 || payload[2] > 0x04 {
+		return false
+	}
+	length := binary.BigEndian.Uint16(payload[3:5])
+	return length > 0 && length <= 16384+2048
+}
+
+// isQUICLongHeader 检查 QUIC 长包头：Header Form 与 Fixed Bit 置位且版本号已知
+func isQUICLongHeader(payload []byte) bool {
+	if len(payload) < 7 || payload[0]&0xc0 != 0xc0 {
+		return false
+	}
+	version := binary.BigEndian.Uint32(payload[1:5])
+	switch {
+	case version == 0x00000001, version == 0x6b3343cf: // QUIC v1 / v2
+	case version&0xffffff00 == 0xff000000: // IETF draft 版本
+	default:
+		return false
+	}
+	// 目标连接ID长度不超过20字节
+	return payload[5] <= 20
+}
+
+// isDNSMessage 校验DNS头部与第一个问题域的格式
+func isDNSMessage(payload []byte) bool {
+	if len(payload) < 17 {
+		return false
+	}
+	flags := binary.BigEndian.Uint16(payload[2:4])
+	opcode := (flags >> 11) & 0x0f
+	if opcode > 5 || flags&0x0040 != 0 { // Z 位必须为0
+		return false
+	}
+	qdCount := binary.BigEndian.Uint16(payload[4:6])
+	if qdCount == 0 || qdCount > 16 {
+		return false
+	}
+	// 解析第一个问题的域名标签
+	off := 12
+	for {
+		if off >= len(payload) {
+			return false
+		}
+		l := int(payload[off])
+		if l == 0 {
+			off++
+			break
+		}
+		if l > 63 {
+			return false
+		}
+		off += l + 1
+	}
+	// QTYPE + QCLASS
+	if off+4 > len(payload) {
+		return false
+	}
+	qclass := binary.BigEndian.Uint16(payload[off+2 : off+4])
+	return qclass&0x7fff == 1 || qclass == 255
+}
+
+// isRDPConnection 检查 TPKT + X.224 连接请求/确认
+func isRDPConnection(payload []byte) bool {
+	if len(payload) < 11 || payload[0] != 0x03 || payload[1] != 0x00 {
+		return false
+	}
+	if int(binary.BigEndian.Uint16(payload[2:4])) != len(payload) {
+		return false
+	}
+	code := payload[5] & 0xf0
+	return code == 0xe0 || code == 0xd0
+}
+
+// isSMBMessage 检查 NetBIOS 会话头后的 SMB1/SMB2 魔数
+func isSMBMessage(payload []byte) bool {
+	if len(payload) >= 8 && payload[0] == 0x00 {
+		magic := payload[4:8]
+		if bytes.Equal(magic, []byte("\xffSMB")) || bytes.Equal(magic, []byte("\xfeSMB")) || bytes.Equal(magic, []byte("\xfdSMB")) {
+			return true
+		}
+	}
+	return len(payload) >= 4 && bytes.Equal(payload[:4], []byte("\xfeSMB"))
+}
+
+// isPostgreSQLStartup 检查 StartupMessage（协议3.0）或 SSLRequest
+func isPostgreSQLStartup(payload []byte) bool {
+	if len(payload) < 8 {
+		return false
+	}
+	length := binary.BigEndian.Uint32(payload[0:4])
+	code := binary.BigEndian.Uint32(payload[4:8])
+	if int(length) != len(payload) {
+		return false
+	}
+	return code == 0x00030000 || code == 80877103 || code == 80877104
+}
+
+// isMySQLGreeting 检查服务端握手包：3字节长度 + 序号0 + 协议版本10 + 版本字符串
+func isMySQLGreeting(payload []byte) bool {
+	if len(payload) < 10 || payload[3] != 0x00 || payload[4] != 0x0a {
+		return false
+	}
+	length := int(payload[0]) | int(payload[1])<<8 | int(payload[2])<<16
+	if length+4 != len(payload) {
+		return false
+	}
+	end := bytes.IndexByte(payload[5:], 0x00)
+	if end <= 0 {
+		return false
+	}
+	for _, b := range payload[5 : 5+end] {
+		if b < 0x20 || b > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// isMongoDBMessage 检查 MongoDB 线协议头部：消息长度 + 已知 opCode
+func isMongoDBMessage(payload []byte) bool {
+	if len(payload) < 16 {
+		return false
+	}
+	length := binary.LittleEndian.Uint32(payload[0:4])
+	if int(length) != len(payload) {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(payload[12:16]) {
+	case 1, 2004, 2012, 2013: // OP_REPLY / OP_QUERY / OP_COMPRESSED / OP_MSG
+		return true
+	}
+	return false
+}
+
+// isRedisCommand 检查 RESP 数组形式的命令：*<n>\r\n$<len>\r\n
+func isRedisCommand(payload []byte) bool {
+	if len(payload) < 8 || payload[0] != '*' {
+		return false
+	}
+	i := 1
+	for i < len(payload) && payload[i] >= '0' && payload[i] <= '9' {
+		i++
+	}
+	if i == 1 || i+3 > len(payload) {
+		return false
+	}
+	return payload[i] == '\r' && payload[i+1] == '\n' && payload[i+2] == '$'
+}
@@ -0,0 +1,86 @@
+package layer
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("invalid hex %q: %v", s, err)
+	}
+	return b
+}
+
+// TestDetectAppProtocol 测试各协议的载荷特征识别（与端口无关）
+func TestDetectAppProtocol(t *testing.T) {
+	cases := []struct {
+		name      string
+		transport string
+		payload   []byte
+		want      string
+		client    bool
+	}{
+		{"http request", "TCP", []byte("GET /index.html HTTP/1.1\r\nHost: a\r\n\r\n"), AppProtocolHTTP, true},
+		{"http response", "TCP", []byte("HTTP/1.1 200 OK\r\n\r\n"), AppProtocolHTTP, false},
+		{"http2 preface", "TCP", []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"), AppProtocolHTTP2, true},
+		{"tls client hello", "TCP", mustHex(t, "16030100c8010000c40303"), AppProtocolTLS, true},
+		{"tls app data", "TCP", mustHex(t, "1703030020aabbcc"), AppProtocolTLS, false},
+		{"ssh banner", "TCP", []byte("SSH-2.0-OpenSSH_9.6\r\n"), AppProtocolSSH, false},
+		{"rdp connection request", "TCP", mustHex(t, "0300000b06e00000000000"), AppProtocolRDP, true},
+		{"smb2", "TCP", mustHex(t, "00000040fe534d4240000000"), AppProtocolSMB, false},
+		{"postgres ssl request", "TCP", mustHex(t, "0000000804d2162f"), AppProtocolPostgreSQL, true},
+		{"mysql greeting", "TCP", mustHex(t, "070000000a382e302e3000"), AppProtocolMySQL, false},
+		{"mongodb op_msg", "TCP", mustHex(t, "140000000100000000000000dd07000000000000"), AppProtocolMongoDB, false},
+		{"redis command", "TCP", []byte("*1\r\n$4\r\nPING\r\n"), AppProtocolRedis, true},
+		// example.com A 查询
+		{"dns query", "UDP", mustHex(t, "abcd01000001000000000000076578616d706c6503636f6d0000010001"), AppProtocolDNS, true},
+		{"quic initial", "UDP", mustHex(t, "c00000000108aabbccddeeff0011"), AppProtocolQUIC, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			det, ok := DetectAppProtocol(tc.transport, tc.payload)
+			if !ok {
+				t.Fatalf("expected %s to be detected", tc.want)
+			}
+			if det.Protocol != tc.want {
+				t.Fatalf("got %s, want %s", det.Protocol, tc.want)
+			}
+			if det.FromClient != tc.client {
+				t.Fatalf("from_client = %v, want %v", det.FromClient, tc.client)
+			}
+		})
+	}
+}
+
+// TestDetectAppProtocolUnknown 测试无法识别的载荷
+func TestDetectAppProtocolUnknown(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("hello world"),
+		mustHex(t, "00010203040506070809"),
+		[]byte("GETTER"),
+	}
+	for _, p := range payloads {
+		if det, ok := DetectAppProtocol("TCP", p); ok {
+			t.Fatalf("payload %q detected as %s", p, det.Protocol)
+		}
+	}
+	if _, ok := DetectAppProtocol("UDP", []byte("random udp")); ok {
+		t.Fatal("random udp payload should not be detected")
+	}
+}
+
+// TestGuessAppProtocolByPort 测试端口兜底推测
+func TestGuessAppProtocolByPort(t *testing.T) {
+	if p, ok := GuessAppProtocolByPort("TCP", 51000, 443); !ok || p != AppProtocolTLS {
+		t.Fatalf("got %s/%v", p, ok)
+	}
+	if p, ok := GuessAppProtocolByPort("UDP", 53, 51000); !ok || p != AppProtocolDNS {
+		t.Fatalf("got %s/%v", p, ok)
+	}
+	if _, ok := GuessAppProtocolByPort("TCP", 51000, 8443); ok {
+		t.Fatal("8443 should not be guessed")
+	}
+}
@@ -48,24 +48,34 @@ type PerformanceMetrics struct {
 
 // TLSInfo TLS信息
 type TLSInfo struct {
-	Version     string           `json:"version"`      // TLS版本
-	CipherSuite string           `json:"cipher_suite"` // 加密套件
-	Certificate *CertificateInfo `json:"certificate"`  // 证书信息
-	IsSecure    bool             `json:"is_secure"`    // 是否安全连接
-	Protocol    string           `json:"protocol"`     // 协议类型
+	Version          string             `json:"version"`                     // TLS版本
+	CipherSuite      string             `json:"cipher_suite"`                // 加密套件
+	Certificate      *CertificateInfo   `json:"certificate"`                 // 证书信息（叶子证书，IsValid 为完整校验结果）
+	Chain            []*CertificateInfo `json:"chain,omitempty"`             // 上游出示的证书链，第一个为叶子证书
+	ServerName       string             `json:"server_name,omitempty"`       // 校验证书使用的主机名
+	ALPN             string             `json:"alpn,omitempty"`              // 协商的应用层协议
+	OCSPStapled      bool               `json:"ocsp_stapled"`                // 上游是否装订了 OCSP 响应
+	OCSPStatus       string             `json:"ocsp_status,omitempty"`       // good/revoked/unknown，无法解析时为 invalid
+	InsecureUpstream bool               `json:"insecure_upstream,omitempty"` // 按 MITM 规则跳过了上游证书校验
+	IsSecure         bool               `json:"is_secure"`                   // 是否安全连接：证书校验通过且未被吊销
+	Protocol         string             `json:"protocol"`                    // 协议类型
 }
 
 // CertificateInfo 证书信息
 type CertificateInfo struct {
-	Subject         string    `json:"subject"`          // 证书主题
-	Issuer          string    `json:"issuer"`           // 证书颁发者
-	NotBefore       time.Time `json:"not_before"`       // 有效期开始
-	NotAfter        time.Time `json:"not_after"`        // 有效期结束
-	SerialNumber    string    `json:"serial_number"`    // 序列号
-	Fingerprint     string    `json:"fingerprint"`      // 指纹
-	IsSelfSigned    bool      `json:"is_self_signed"`   // 是否自签名
-	IsValid         bool      `json:"is_valid"`         // 是否有效
-	ValidationError string    `json:"validation_error"` // 验证错误
+	Subject          string    `json:"subject"`                     // 证书主题
+	Issuer           string    `json:"issuer"`                      // 证书颁发者
+	DNSNames         []string  `json:"dns_names,omitempty"`         // DNS SAN
+	IPAddresses      []string  `json:"ip_addresses,omitempty"`      // IP SAN
+	NotBefore        time.Time `json:"not_before"`                  // 有效期开始
+	NotAfter         time.Time `json:"not_after"`                   // 有效期结束
+	SerialNumber     string    `json:"serial_number"`               // 序列号
+	Fingerprint      string    `json:"fingerprint"`                 // SHA-256 指纹
+	IsCA             bool      `json:"is_ca"`                       // 是否为 CA 证书
+	IsSelfSigned     bool      `json:"is_self_signed"`              // 是否自签名
+	IsValid          bool      `json:"is_valid"`                    // 是否有效
+	ValidationError  string    `json:"validation_error"`            // 验证错误
+	ValidationReason string    `json:"validation_reason,omitempty"` // expired/not_yet_valid/unknown_authority/hostname_mismatch/invalid
 }
 
 // ErrorInfo 错误信息
@@ -113,6 +123,93 @@ type NetworkInfo struct {
 	ASN         string `json:"asn"`          // ASN
 }
 
+// BreakpointInfo 断点拦截记录
+type BreakpointInfo struct {
+	RuleID   string   `json:"rule_id"`  // 命中的断点规则
+	Phases   []string `json:"phases"`   // 被挂起的阶段：request/response
+	Action   string   `json:"action"`   // 处理结果：continue/abort/timeout
+	Modified bool     `json:"modified"` // 是否被用户修改
+	HeldMs   int64    `json:"held_ms"`  // 累计挂起时间(ms)
+}
+
+// InterceptInfo 由代理本地应答、未访问上游的记录
+type InterceptInfo struct {
+	Type   string `json:"type"`             // 拦截类型，如 map_local
+	RuleID string `json:"rule_id"`          // 命中的规则
+	Source string `json:"source,omitempty"` // 内容来源，如本地文件路径
+}
+
+// MapRemoteInfo Map Remote 改写记录
+type MapRemoteInfo struct {
+	RuleID      string `json:"rule_id"`      // 命中的规则
+	OriginalURL string `json:"original_url"` // 客户端请求的原始URL
+	MappedURL   string `json:"mapped_url"`   // 实际转发的URL
+}
+
+// ThrottleInfo 网络条件模拟记录
+type ThrottleInfo struct {
+	Profile string `json:"profile"` // 网络条件名称
+	Source  string `json:"source"`  // 来源：规则ID或 global
+}
+
+// WebSocketInfo WebSocket 连接记录
+type WebSocketInfo struct {
+	Messages    []*WebSocketMessage `json:"messages"`
+	Total       int                 `json:"total"`                  // 消息总数，超出保留上限的旧消息会被丢弃
+	Closed      bool                `json:"closed"`                 // 连接是否已关闭
+	CloseCode   int                 `json:"close_code,omitempty"`   // 首个 close 帧的状态码
+	CloseReason string              `json:"close_reason,omitempty"` // 首个 close 帧的原因
+	ClosedBy    string              `json:"closed_by,omitempty"`    // 首先发送 close 帧的一方
+}
+
+// WebSocketMessage 单条 WebSocket 消息
+type WebSocketMessage struct {
+	Seq         int       `json:"seq"`
+	Direction   string    `json:"direction"` // 发送方：client/server
+	Type        string    `json:"type"`      // text/binary/ping/pong/close
+	Timestamp   time.Time `json:"timestamp"`
+	Size        int       `json:"size"`                   // 实际转发的负载长度
+	Payload     []byte    `json:"payload"`                // 超过记录上限时截断
+	Truncated   bool      `json:"truncated,omitempty"`    // 负载是否被截断
+	CloseCode   int       `json:"close_code,omitempty"`   // close 帧的状态码
+	CloseReason string    `json:"close_reason,omitempty"` // close 帧的原因
+	Edited      bool      `json:"edited,omitempty"`       // 被规则或断点修改
+	Dropped     bool      `json:"dropped,omitempty"`      // 被规则或断点丢弃，未转发
+	Injected    bool      `json:"injected,omitempty"`     // 由用户注入
+	RuleID      string    `json:"rule_id,omitempty"`      // 命中的规则
+}
+
+// StreamInfo 流式转发的响应记录，消息体边转发边捕获
+type StreamInfo struct {
+	Size       int64       `json:"size"`                 // 已转发给客户端的字节数
+	Captured   int64       `json:"captured"`             // 已捕获的字节数，超出上限的部分不再记录
+	Truncated  bool        `json:"truncated,omitempty"`  // 是否超出捕获上限
+	SpillFile  string      `json:"spill_file,omitempty"` // 超出内存上限后写入的磁盘文件，包含完整的已捕获内容
+	Events     []*SSEEvent `json:"events,omitempty"`     // text/event-stream 解析出的事件
+	EventCount int         `json:"event_count"`          // 事件总数，超出保留上限的旧事件会被丢弃
+	DurationMs int64       `json:"duration_ms"`          // 从收到响应头到流结束的时间
+	Error      string      `json:"error,omitempty"`      // 流异常结束的原因
+}
+
+// SSEEvent 单个 Server-Sent Event
+type SSEEvent struct {
+	Seq       int       `json:"seq"`
+	ID        string    `json:"id,omitempty"`
+	Event     string    `json:"event,omitempty"` // 事件类型，未指定时为 message
+	Data      string    `json:"data"`
+	Retry     int       `json:"retry,omitempty"` // 重连间隔(ms)
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TunnelInfo 未解密的 CONNECT 隧道记录
+type TunnelInfo struct {
+	Mode          string `json:"mode"`              // passthrough/reject/udp
+	RuleID        string `json:"rule_id,omitempty"` // 命中的 MITM 规则
+	BytesSent     int64  `json:"bytes_sent"`        // 客户端发往上游的字节数
+	BytesReceived int64  `json:"bytes_received"`    // 上游返回的字节数
+	DurationMs    int64  `json:"duration_ms"`       // 隧道持续时间
+}
+
 // Flow 表示一次完整的请求-响应流
 type Flow struct {
 	ID         string        `json:"id"`
@@ -130,6 +227,19 @@ type Flow struct {
 	Error       *ErrorInfo          `json:"error,omitempty"`
 	Content     *ContentInfo        `json:"content,omitempty"`
 	Network     *NetworkInfo        `json:"network,omitempty"`
+	Breakpoint  *BreakpointInfo     `json:"breakpoint,omitempty"`
+
+	AppliedRules []string       `json:"applied_rules,omitempty"` // 命中的改写规则ID
+	Intercept    *InterceptInfo `json:"intercept,omitempty"`     // 本地应答信息
+	MapRemote    *MapRemoteInfo `json:"map_remote,omitempty"`    // Map Remote 改写信息
+	Throttle     *ThrottleInfo  `json:"throttle,omitempty"`      // 网络条件模拟
+	Source       string         `json:"source,omitempty"`        // 流量来源：空表示代理捕获，reverse 表示经反向代理进入，replay/composer 表示由服务端发出
+	ReplayOf     string         `json:"replay_of,omitempty"`     // 重放的原始 Flow ID
+	Tunnel       *TunnelInfo    `json:"tunnel,omitempty"`        // 未解密的 CONNECT 隧道
+	Upstream     string         `json:"upstream,omitempty"`      // 上游路由：上游代理ID、direct 或 env
+	WebSocket    *WebSocketInfo `json:"websocket,omitempty"`     // 升级为 WebSocket 后的消息
+	Stream       *StreamInfo    `json:"stream,omitempty"`        // 流式转发的响应
+	InProgress   bool           `json:"in_progress,omitempty"`   // 响应仍在传输中
 }
 
 // CopyHeaders 将http.Header转换为map[string]string（首值）
@@ -13,6 +13,11 @@ type PacketInfo struct {
 	TransportLayer   *layer.TransportLayerInfo   `json:"transportLayer"`
 	ApplicationLayer *layer.ApplicationLayerInfo `json:"applicationLayer"`
 	ErrorLayer       *layer.ErrorLayerInfo       `json:"errorLayer"`
+
+	// 应用层协议识别结果（基于载荷特征与会话行为，不依赖端口）
+	AppProtocol       string `json:"appProtocol"`       // 应用层协议，如 HTTP/TLS/SSH/DNS
+	AppProtocolMethod string `json:"appProtocolMethod"` // 识别方式：signature/flow/port
+	ConversationID    string `json:"conversationId"`    // 所属会话标识
 }
 
 // ToString 返回数据包的字符串表示，调用各层的打印方法
@@ -0,0 +1,439 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elazarl/goproxy"
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// 断点拦截阶段
+const (
+	BreakpointPhaseRequest  = "request"
+	BreakpointPhaseResponse = "response"
+	BreakpointPhaseBoth     = "both"
+)
+
+// 断点处理动作
+const (
+	BreakpointActionContinue = "continue"
+	BreakpointActionAbort    = "abort"
+	BreakpointActionTimeout  = "timeout"
+)
+
+// DefaultBreakpointTimeout 断点未处理时自动放行的默认等待时间
+const DefaultBreakpointTimeout = 60 * time.Second
+
+var (
+	ErrBreakpointNotFound = errors.New("breakpoint not found")
+	ErrPendingNotFound    = errors.New("pending flow not found")
+)
+
+// BreakpointRule 断点规则
+type BreakpointRule struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+	Phase   string `json:"phase"` // request/response/both
+	FlowMatcher
+}
+
+// BreakpointEdit 用户提交的修改内容，nil 字段表示保持原样
+type BreakpointEdit struct {
+	Method     *string           `json:"method,omitempty"`
+	URL        *string           `json:"url,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       *string           `json:"body,omitempty"`
+	BodyBase64 *string           `json:"body_base64,omitempty"` // 二进制内容以base64提交
+	StatusCode *int              `json:"status_code,omitempty"`
+}
+
+// BreakpointDecision 对挂起流量的处理结果
+type BreakpointDecision struct {
+	Action string `json:"action"` // continue/abort
+	BreakpointEdit
+}
+
+// DecodedBody 返回修改后的消息体，未修改时 ok=false
+func (e *BreakpointEdit) DecodedBody() (body []byte, ok bool, err error) {
+	if e.BodyBase64 != nil {
+		body, err = base64.StdEncoding.DecodeString(*e.BodyBase64)
+		return body, err == nil, err
+	}
+	if e.Body != nil {
+		return []byte(*e.Body), true, nil
+	}
+	return nil, false, nil
+}
+
+// PendingFlow 因命中断点而挂起等待处理的请求或响应
+type PendingFlow struct {
+	ID        string               `json:"id"`
+	FlowID    string               `json:"flow_id"`
+	RuleID    string               `json:"rule_id"`
+	Phase     string               `json:"phase"`
+	CreatedAt time.Time            `json:"created_at"`
+	ExpiresAt time.Time            `json:"expires_at"`
+	Request   *models.HTTPRequest  `json:"request"`
+	Response  *models.HTTPResponse `json:"response,omitempty"`
+
+	decision chan BreakpointDecision
+}
+
+// BreakpointManager 管理断点规则与挂起的流量
+type BreakpointManager struct {
+	mu      sync.RWMutex
+	rules   []*BreakpointRule
+	pending map[string]*PendingFlow
+	timeout time.Duration
+}
+
+// NewBreakpointManager 创建断点管理器
+func NewBreakpointManager() *BreakpointManager {
+	return &BreakpointManager{
+		rules:   make([]*BreakpointRule, 0),
+		pending: make(map[string]*PendingFlow),
+		timeout: DefaultBreakpointTimeout,
+	}
+}
+
+// Timeout 获取自动放行超时时间
+func (bm *BreakpointManager) Timeout() time.Duration {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return bm.timeout
+}
+
+// SetTimeout 设置自动放行超时时间
+func (bm *BreakpointManager) SetTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultBreakpointTimeout
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.timeout = d
+}
+
+// Rules 返回全部断点规则
+func (bm *BreakpointManager) Rules() []*BreakpointRule {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	result := make([]*BreakpointRule, len(bm.rules))
+	copy(result, bm.rules)
+	return result
+}
+
+// AddRule 添加断点规则
+func (bm *BreakpointManager) AddRule(rule *BreakpointRule) error {
+	if err := normalizeBreakpointRule(rule); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.rules = append(bm.rules, rule)
+	return nil
+}
+
+// UpdateRule 更新断点规则
+func (bm *BreakpointManager) UpdateRule(id string, rule *BreakpointRule) error {
+	if err := normalizeBreakpointRule(rule); err != nil {
+		return err
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	for i, r := range bm.rules {
+		if r.ID == id {
+			rule.ID = id
+			bm.rules[i] = rule
+			return nil
+		}
+	}
+	return ErrBreakpointNotFound
+}
+
+// RemoveRule 删除断点规则
+func (bm *BreakpointManager) RemoveRule(id string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	for i, r := range bm.rules {
+		if r.ID == id {
+			bm.rules = append(bm.rules[:i], bm.rules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrBreakpointNotFound
+}
+
+// Match 查找命中指定阶段的第一条规则
+func (bm *BreakpointManager) Match(phase, method, host, path string) *BreakpointRule {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	for _, r := range bm.rules {
+		if !r.Enabled {
+			continue
+		}
+		if r.Phase != BreakpointPhaseBoth && r.Phase != phase {
+			continue
+		}
+		if r.Match(method, host, path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Hold 挂起流量直到用户提交处理结果或超时，超时视为原样放行
+func (bm *BreakpointManager) Hold(p *PendingFlow) BreakpointDecision {
+	timeout := bm.Timeout()
+	p.ID = uuid.NewString()
+	p.CreatedAt = time.Now()
+	p.ExpiresAt = p.CreatedAt.Add(timeout)
+	p.decision = make(chan BreakpointDecision, 1)
+
+	bm.mu.Lock()
+	bm.pending[p.ID] = p
+	bm.mu.Unlock()
+
+	defer func() {
+		bm.mu.Lock()
+		delete(bm.pending, p.ID)
+		bm.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case d := <-p.decision:
+		return d
+	case <-timer.C:
+		return BreakpointDecision{Action: BreakpointActionTimeout}
+	}
+}
+
+// Pending 返回当前挂起的流量，按挂起时间排序
+func (bm *BreakpointManager) Pending() []*PendingFlow {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	result := make([]*PendingFlow, 0, len(bm.pending))
+	for _, p := range bm.pending {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// GetPending 获取指定的挂起流量
+func (bm *BreakpointManager) GetPending(id string) *PendingFlow {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return bm.pending[id]
+}
+
+// Resolve 提交对挂起流量的处理结果
+func (bm *BreakpointManager) Resolve(id string, d BreakpointDecision) error {
+	if d.Action == "" {
+		d.Action = BreakpointActionContinue
+	}
+	if d.Action != BreakpointActionContinue && d.Action != BreakpointActionAbort {
+		return errors.New("invalid action: " + d.Action)
+	}
+	if _, _, err := d.DecodedBody(); err != nil {
+		return err
+	}
+
+	bm.mu.Lock()
+	p, ok := bm.pending[id]
+	if ok {
+		// 先移出队列，避免重复提交
+		delete(bm.pending, id)
+	}
+	bm.mu.Unlock()
+	if !ok {
+		return ErrPendingNotFound
+	}
+	p.decision <- d
+	return nil
+}
+
+func normalizeBreakpointRule(rule *BreakpointRule) error {
+	switch rule.Phase {
+	case "":
+		rule.Phase = BreakpointPhaseRequest
+	case BreakpointPhaseRequest, BreakpointPhaseResponse, BreakpointPhaseBoth:
+	default:
+		return errors.New("invalid phase: " + rule.Phase)
+	}
+	return rule.Compile()
+}
+
+// applyRequestEdit 将用户修改应用到请求上
+func applyRequestEdit(req *http.Request, body []byte, edit BreakpointEdit) ([]byte, bool, error) {
+	modified := false
+	if edit.Method != nil && *edit.Method != "" && *edit.Method != req.Method {
+		req.Method = strings.ToUpper(*edit.Method)
+		modified = true
+	}
+	if edit.URL != nil && *edit.URL != "" && *edit.URL != req.URL.String() {
+		u, err := url.Parse(*edit.URL)
+		if err != nil {
+			return body, modified, err
+		}
+		req.URL = u
+		req.Host = u.Host
+		modified = true
+	}
+	if edit.Headers != nil {
+		req.Header = headersFromMap(edit.Headers)
+		modified = true
+	}
+	if newBody, ok, err := edit.DecodedBody(); err != nil {
+		return body, modified, err
+	} else if ok {
+		body = newBody
+		modified = true
+	}
+	if modified {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		if req.Header.Get("Content-Length") != "" {
+			req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		}
+	}
+	return body, modified, nil
+}
+
+// applyResponseEdit 将用户修改应用到响应上
+func applyResponseEdit(resp *http.Response, body []byte, edit BreakpointEdit) ([]byte, bool, error) {
+	modified := false
+	if edit.StatusCode != nil && *edit.StatusCode != resp.StatusCode {
+		resp.StatusCode = *edit.StatusCode
+		resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+		modified = true
+	}
+	if edit.Headers != nil {
+		resp.Header = headersFromMap(edit.Headers)
+		modified = true
+	}
+	if newBody, ok, err := edit.DecodedBody(); err != nil {
+		return body, modified, err
+	} else if ok {
+		body = newBody
+		modified = true
+	}
+	if modified {
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Del("Transfer-Encoding")
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	return body, modified, nil
+}
+
+// headersFromMap 将 map[string]string 转换为 http.Header
+func headersFromMap(m map[string]string) http.Header {
+	h := make(http.Header, len(m))
+	for k, v := range m {
+		h.Set(k, v)
+	}
+	return h
+}
+
+// holdRequest 挂起命中断点的请求；返回非 nil 响应表示请求被中止
+func (p *EnhancedProxyServer) holdRequest(flow *models.Flow, rule *BreakpointRule, req *http.Request, body []byte) *http.Response {
+	start := time.Now()
+	d := p.breakpoints.Hold(&PendingFlow{
+		FlowID:  flow.ID,
+		RuleID:  rule.ID,
+		Phase:   BreakpointPhaseRequest,
+		Request: flow.Request,
+	})
+	info := recordBreakpoint(flow, rule, BreakpointPhaseRequest, d.Action, time.Since(start))
+
+	if d.Action == BreakpointActionAbort {
+		flow.Error = &models.ErrorInfo{Type: "breakpoint", Message: "request aborted at breakpoint"}
+		return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusBadGateway, "Request aborted by CetiProbe breakpoint")
+	}
+	if d.Action != BreakpointActionContinue {
+		return nil
+	}
+
+	body, modified, err := applyRequestEdit(req, body, d.BreakpointEdit)
+	if err != nil {
+		p.errorCollector.RecordError(flow.ID, "breakpoint", err.Error(), 0, false, 0)
+	}
+	if modified {
+		info.Modified = true
+		flow.Request = p.buildHTTPRequest(req)
+		flow.Request.Body = body
+		flow.Scheme = req.URL.Scheme
+	}
+	return nil
+}
+
+// holdResponse 挂起命中断点的响应，返回处理后的响应及其消息体
+func (p *EnhancedProxyServer) holdResponse(flow *models.Flow, rule *BreakpointRule, resp *http.Response, body []byte) (*http.Response, []byte) {
+	start := time.Now()
+	d := p.breakpoints.Hold(&PendingFlow{
+		FlowID:  flow.ID,
+		RuleID:  rule.ID,
+		Phase:   BreakpointPhaseResponse,
+		Request: flow.Request,
+		Response: &models.HTTPResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Headers:    models.CopyHeaders(resp.Header),
+			Body:       body,
+			Proto:      resp.Proto,
+			Length:     int(resp.ContentLength),
+		},
+	})
+	info := recordBreakpoint(flow, rule, BreakpointPhaseResponse, d.Action, time.Since(start))
+
+	if d.Action == BreakpointActionAbort {
+		flow.Error = &models.ErrorInfo{Type: "breakpoint", Message: "response aborted at breakpoint"}
+		aborted := goproxy.NewResponse(resp.Request, goproxy.ContentTypeText, http.StatusBadGateway, "Response aborted by CetiProbe breakpoint")
+		abortedBody := []byte("Response aborted by CetiProbe breakpoint")
+		return aborted, abortedBody
+	}
+	if d.Action != BreakpointActionContinue {
+		return resp, body
+	}
+
+	body, modified, err := applyResponseEdit(resp, body, d.BreakpointEdit)
+	if err != nil {
+		p.errorCollector.RecordError(flow.ID, "breakpoint", err.Error(), 0, false, 0)
+	}
+	if modified {
+		info.Modified = true
+	}
+	return resp, body
+}
+
+// recordBreakpoint 在 Flow 上记录断点处理过程，已发布的断点信息不原地修改
+func recordBreakpoint(flow *models.Flow, rule *BreakpointRule, phase, action string, held time.Duration) *models.BreakpointInfo {
+	info := &models.BreakpointInfo{RuleID: rule.ID}
+	if flow.Breakpoint != nil {
+		*info = *flow.Breakpoint
+	}
+	info.Phases = append(append([]string(nil), info.Phases...), phase)
+	info.Action = action
+	info.HeldMs += held.Milliseconds()
+	flow.Breakpoint = info
+	return info
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// nextPending 等待出现一条挂起的流量，超时返回 nil
+func nextPending(bm *BreakpointManager) *PendingFlow {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending := bm.Pending(); len(pending) > 0 {
+			return pending[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+// resolveNext 在后台提交下一条挂起流量的处理结果
+func resolveNext(bm *BreakpointManager, d BreakpointDecision) {
+	go func() {
+		if p := nextPending(bm); p != nil {
+			bm.Resolve(p.ID, d)
+		}
+	}()
+}
+
+// TestBreakpointMatch 测试按阶段与匹配条件查找断点规则
+func TestBreakpointMatch(t *testing.T) {
+	bm := NewBreakpointManager()
+	if err := bm.AddRule(&BreakpointRule{Enabled: true, Phase: "invalid"}); err == nil {
+		t.Fatal("invalid phase should be rejected")
+	}
+	req := &BreakpointRule{Enabled: true, FlowMatcher: FlowMatcher{Host: "api.example.com"}}
+	resp := &BreakpointRule{Enabled: true, Phase: BreakpointPhaseResponse, FlowMatcher: FlowMatcher{Path: "^/login"}}
+	both := &BreakpointRule{Enabled: true, Phase: BreakpointPhaseBoth, FlowMatcher: FlowMatcher{Method: "DELETE"}}
+	disabled := &BreakpointRule{Phase: BreakpointPhaseBoth}
+	for _, r := range []*BreakpointRule{req, resp, both, disabled} {
+		if err := bm.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if req.Phase != BreakpointPhaseRequest {
+		t.Fatalf("default phase = %q", req.Phase)
+	}
+
+	if r := bm.Match(BreakpointPhaseRequest, "GET", "api.example.com:443", "/"); r != req {
+		t.Fatalf("request phase matched %+v", r)
+	}
+	if r := bm.Match(BreakpointPhaseResponse, "GET", "api.example.com", "/login"); r != resp {
+		t.Fatalf("response phase matched %+v", r)
+	}
+	if r := bm.Match(BreakpointPhaseResponse, "DELETE", "other.com", "/"); r != both {
+		t.Fatalf("both phase matched %+v", r)
+	}
+	if r := bm.Match(BreakpointPhaseRequest, "GET", "other.com", "/login"); r != nil {
+		t.Fatalf("unexpected match %+v", r)
+	}
+
+	if err := bm.RemoveRule(req.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := bm.RemoveRule(req.ID); err != ErrBreakpointNotFound {
+		t.Fatalf("remove twice: %v", err)
+	}
+}
+
+// TestBreakpointHoldResolve 测试挂起流量、提交处理结果以及重复提交与非法动作
+func TestBreakpointHoldResolve(t *testing.T) {
+	bm := NewBreakpointManager()
+	result := make(chan BreakpointDecision, 1)
+	go func() {
+		result <- bm.Hold(&PendingFlow{FlowID: "flow-1", Phase: BreakpointPhaseRequest})
+	}()
+
+	p := nextPending(bm)
+	if p == nil {
+		t.Fatal("no pending flow")
+	}
+	if p.FlowID != "flow-1" || bm.GetPending(p.ID) != p || !p.ExpiresAt.After(p.CreatedAt) {
+		t.Fatalf("unexpected pending flow: %+v", p)
+	}
+	if err := bm.Resolve(p.ID, BreakpointDecision{Action: "drop"}); err == nil {
+		t.Fatal("invalid action should be rejected")
+	}
+	bad := "%%%"
+	if err := bm.Resolve(p.ID, BreakpointDecision{BreakpointEdit: BreakpointEdit{BodyBase64: &bad}}); err == nil {
+		t.Fatal("invalid base64 body should be rejected")
+	}
+
+	body := "edited"
+	if err := bm.Resolve(p.ID, BreakpointDecision{BreakpointEdit: BreakpointEdit{Body: &body}}); err != nil {
+		t.Fatal(err)
+	}
+	d := <-result
+	if d.Action != BreakpointActionContinue || d.Body == nil || *d.Body != body {
+		t.Fatalf("unexpected decision: %+v", d)
+	}
+	if err := bm.Resolve(p.ID, BreakpointDecision{}); err != ErrPendingNotFound {
+		t.Fatalf("resolve twice: %v", err)
+	}
+	if len(bm.Pending()) != 0 {
+		t.Fatal("resolved flow should leave the queue")
+	}
+}
+
+// TestBreakpointTimeout 测试超时未处理时自动放行并移出队列
+func TestBreakpointTimeout(t *testing.T) {
+	bm := NewBreakpointManager()
+	bm.SetTimeout(20 * time.Millisecond)
+	start := time.Now()
+	d := bm.Hold(&PendingFlow{FlowID: "flow-1"})
+	if d.Action != BreakpointActionTimeout {
+		t.Fatalf("action = %s, want timeout", d.Action)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("hold returned before timeout")
+	}
+	if len(bm.Pending()) != 0 {
+		t.Fatal("timed out flow should leave the queue")
+	}
+
+	bm.SetTimeout(0)
+	if bm.Timeout() != DefaultBreakpointTimeout {
+		t.Fatalf("timeout = %v, want default", bm.Timeout())
+	}
+}
+
+// TestBreakpointApplyEdit 测试将修改后的方法、URL、头部、状态码与消息体应用到请求和响应
+func TestBreakpointApplyEdit(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/a", strings.NewReader("old"))
+	req.Header.Set("Content-Length", "3")
+	method, target := "post", "https://api.example.com/b?x=1"
+	body := base64.StdEncoding.EncodeToString([]byte{0x00, 0x01, 0x02, 0x03})
+	newBody, modified, err := applyRequestEdit(req, []byte("old"), BreakpointEdit{
+		Method:     &method,
+		URL:        &target,
+		Headers:    map[string]string{"X-Edited": "1", "Content-Length": "3"},
+		BodyBase64: &body,
+	})
+	if err != nil || !modified {
+		t.Fatalf("modified=%v err=%v", modified, err)
+	}
+	if req.Method != "POST" || req.URL.String() != target || req.Host != "api.example.com" {
+		t.Fatalf("unexpected request line: %s %s host=%s", req.Method, req.URL, req.Host)
+	}
+	got, _ := io.ReadAll(req.Body)
+	if string(got) != string(newBody) || len(got) != 4 || req.ContentLength != 4 || req.Header.Get("Content-Length") != "4" {
+		t.Fatalf("unexpected body %q length %d/%s", got, req.ContentLength, req.Header.Get("Content-Length"))
+	}
+	if req.Header.Get("X-Edited") != "1" {
+		t.Fatal("headers should be replaced")
+	}
+
+	same := "GET"
+	untouched := httptest.NewRequest("GET", "http://example.com/", nil)
+	if _, modified, _ := applyRequestEdit(untouched, nil, BreakpointEdit{Method: &same}); modified {
+		t.Fatal("unchanged method should not mark request modified")
+	}
+
+	resp := &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{"Transfer-Encoding": {"chunked"}}}
+	status, text := 404, `{"error":"gone"}`
+	newBody, modified, err = applyResponseEdit(resp, []byte("ok"), BreakpointEdit{StatusCode: &status, Body: &text})
+	if err != nil || !modified {
+		t.Fatalf("modified=%v err=%v", modified, err)
+	}
+	got, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != 404 || resp.Status != "404 Not Found" || string(got) != text || string(newBody) != text {
+		t.Fatalf("unexpected response: %s %q", resp.Status, got)
+	}
+	if resp.Header.Get("Transfer-Encoding") != "" || resp.Header.Get("Content-Length") != "16" {
+		t.Fatalf("unexpected headers: %v", resp.Header)
+	}
+}
+
+// TestBreakpointHoldRequest 测试代理挂起请求后应用修改并在 Flow 中记录断点信息，以及中止请求
+func TestBreakpointHoldRequest(t *testing.T) {
+	p := newTestProxy(t, "", true, storage.NewMemoryFlowStore())
+	p.breakpoints.SetTimeout(2 * time.Second)
+	rule := &BreakpointRule{ID: "bp-1", Enabled: true}
+
+	req := httptest.NewRequest("GET", "http://example.com/a", nil)
+	flow := &models.Flow{ID: "flow-1", Request: p.buildHTTPRequest(req)}
+	path := "http://example.com/b"
+	resolveNext(p.breakpoints, BreakpointDecision{BreakpointEdit: BreakpointEdit{URL: &path}})
+	if resp := p.holdRequest(flow, rule, req, nil); resp != nil {
+		t.Fatalf("continued request should not be answered locally: %d", resp.StatusCode)
+	}
+	if flow.Request.Path != "/b" || flow.Breakpoint == nil || !flow.Breakpoint.Modified || flow.Breakpoint.Action != BreakpointActionContinue {
+		t.Fatalf("unexpected flow: %+v %+v", flow.Request, flow.Breakpoint)
+	}
+
+	flow = &models.Flow{ID: "flow-2", Request: p.buildHTTPRequest(req)}
+	resolveNext(p.breakpoints, BreakpointDecision{Action: BreakpointActionAbort})
+	resp := p.holdRequest(flow, rule, req, nil)
+	if resp == nil || resp.StatusCode != http.StatusBadGateway || flow.Error == nil || flow.Breakpoint.Action != BreakpointActionAbort {
+		t.Fatalf("aborted request should get a local 502: %+v", flow.Error)
+	}
+}
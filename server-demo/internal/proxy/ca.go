@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -8,20 +10,28 @@ import (
 	"encoding/pem"
 	"errors"
 	"math/big"
-	"os"
+	"net"
 	"path/filepath"
 	"time"
 )
 
+// CAFiles 根证书与私钥的存放位置
 type CAFiles struct {
 	Dir      string
 	CertPath string
 	KeyPath  string
 }
 
+// DefaultCADir 默认的根证书目录，相对运行目录
+func DefaultCADir() string {
+	return filepath.Clean("../certs")
+}
+
 func DefaultCAFiles() CAFiles {
-	// 相对运行目录创建 certs 目录
-	dir := filepath.Clean("../certs")
+	return caFilesIn(DefaultCADir())
+}
+
+func caFilesIn(dir string) CAFiles {
 	return CAFiles{
 		Dir:      dir,
 		CertPath: filepath.Join(dir, "proxy_root_ca.pem"),
@@ -29,34 +39,33 @@ func DefaultCAFiles() CAFiles {
 	}
 }
 
+// EnsureCAExists 读取默认目录下的根证书，不存在时生成
 func EnsureCAExists() (certPEM, keyPEM []byte, files CAFiles, err error) {
-	files = DefaultCAFiles()
-	if err = os.MkdirAll(files.Dir, 0755); err != nil {
-		return nil, nil, files, err
-	}
-	certPEM, _ = os.ReadFile(files.CertPath)
-	keyPEM, _ = os.ReadFile(files.KeyPath)
-	if len(certPEM) > 0 && len(keyPEM) > 0 {
-		return certPEM, keyPEM, files, nil
-	}
-	return GenerateCA()
+	m := NewCAManager(DefaultCADir())
+	certPEM, keyPEM, err = m.Ensure()
+	return certPEM, keyPEM, m.Files(), err
 }
 
-func GenerateCA() (certPEM, keyPEM []byte, files CAFiles, err error) {
-	files = DefaultCAFiles()
-	if err = os.MkdirAll(files.Dir, 0755); err != nil {
-		return nil, nil, files, err
+// newRootCA 生成自签名根证书，keyType 取 LeafKeyRSA（默认）或 LeafKeyECDSA
+func newRootCA(keyType string) (certPEM, keyPEM []byte, err error) {
+	if keyType == "" {
+		keyType = LeafKeyRSA
 	}
-
-	// 生成 RSA 私钥
-	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err := (LeafCertConfig{KeyType: keyType}).Validate(); err != nil {
+		return nil, nil, err
+	}
+	priv, err := generateLeafKey(keyType)
 	if err != nil {
-		return nil, nil, files, err
+		return nil, nil, err
 	}
 
-	// 生成自签名根证书
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, _ := rand.Int(rand.Reader, serialNumberLimit)
+	usage := x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	if keyType == LeafKeyRSA {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
+	// SubjectKeyId 留空由标准库按公钥计算，轮换前后的根证书不会被客户端混淆
 	tmpl := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
@@ -66,51 +75,35 @@ func GenerateCA() (certPEM, keyPEM []byte, files CAFiles, err error) {
 		},
 		NotBefore:             time.Now().Add(-10 * time.Minute),
 		NotAfter:              time.Now().AddDate(5, 0, 0),
-		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		KeyUsage:              usage,
 		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 		MaxPathLen:            2,
-		// 添加更好的兼容性设置
-		SubjectKeyId:   []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
-		AuthorityKeyId: []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &priv.PublicKey, priv)
+	derBytes, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, priv.Public(), priv)
 	if err != nil {
-		return nil, nil, files, err
-	}
-
-	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
-	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
-
-	if err = os.WriteFile(files.CertPath, certPEM, 0644); err != nil {
-		return nil, nil, files, err
+		return nil, nil, err
 	}
-	if err = os.WriteFile(files.KeyPath, keyPEM, 0600); err != nil {
-		return nil, nil, files, err
+	keyPEM, err = marshalKeyPEM(priv)
+	if err != nil {
+		return nil, nil, err
 	}
-	return certPEM, keyPEM, files, nil
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), keyPEM, nil
 }
 
-func LoadCAFromDisk() (certPEM, keyPEM []byte, files CAFiles, err error) {
-	files = DefaultCAFiles()
-	certPEM, err = os.ReadFile(files.CertPath)
+// marshalKeyPEM 以 PKCS#8 编码私钥
+func marshalKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
 	if err != nil {
-		return nil, nil, files, err
+		return nil, err
 	}
-	keyPEM, err = os.ReadFile(files.KeyPath)
-	if err != nil {
-		return nil, nil, files, err
-	}
-	if len(certPEM) == 0 || len(keyPEM) == 0 {
-		return nil, nil, files, errors.New("empty CA files")
-	}
-	return certPEM, keyPEM, files, nil
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
 }
 
-// ParseCA 将PEM解析为x509根证书与私钥
-func ParseCA(certPEM, keyPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+// ParseCA 将PEM解析为x509根证书与私钥，私钥支持 RSA 与 ECDSA
+func ParseCA(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
 	block, _ := pem.Decode(certPEM)
 	if block == nil || block.Type != "CERTIFICATE" {
 		return nil, nil, errors.New("invalid ca cert pem")
@@ -120,57 +113,101 @@ func ParseCA(certPEM, keyPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error)
 		return nil, nil, err
 	}
 
-	kblk, _ := pem.Decode(keyPEM)
-	if kblk == nil {
-		return nil, nil, errors.New("invalid ca key pem")
-	}
-	var key *rsa.PrivateKey
-	if kblk.Type == "RSA PRIVATE KEY" {
-		key, err = x509.ParsePKCS1PrivateKey(kblk.Bytes)
-		if err != nil {
-			return nil, nil, err
+	for rest := keyPEM; ; {
+		var kblk *pem.Block
+		kblk, rest = pem.Decode(rest)
+		if kblk == nil {
+			return nil, nil, errors.New("invalid ca key pem")
 		}
-	} else if kblk.Type == "PRIVATE KEY" {
-		pk, err2 := x509.ParsePKCS8PrivateKey(kblk.Bytes)
-		if err2 != nil {
-			return nil, nil, err2
+		// openssl ecparam -genkey 会在私钥前输出 EC PARAMETERS
+		if kblk.Type == "EC PARAMETERS" {
+			continue
 		}
-		var ok bool
-		key, ok = pk.(*rsa.PrivateKey)
-		if !ok {
-			return nil, nil, errors.New("unsupported private key type")
+		key, err := parseKeyBlock(kblk)
+		if err != nil {
+			return nil, nil, err
 		}
-	} else {
-		return nil, nil, errors.New("unsupported key pem type")
+		return cert, key, nil
 	}
-	return cert, key, nil
+}
+
+// parseKeyBlock 解析 PKCS#1、SEC 1 或 PKCS#8 私钥
+func parseKeyBlock(block *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, errors.New("encrypted pem keys are not supported, import as PKCS#12 instead")
+	default:
+		return nil, errors.New("unsupported key pem type")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return caSigner(key)
+}
+
+// caSigner 仅接受可用于签发证书的 RSA 与 ECDSA 私钥
+func caSigner(key interface{}) (crypto.Signer, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	}
+	return nil, errors.New("unsupported private key type")
 }
 
 // SignHostCert 使用根CA为指定主机名签发叶子证书（含 SAN）
-func SignHostCert(caCert *x509.Certificate, caKey *rsa.PrivateKey, host string, validFor time.Duration) (tlsCertPEM, tlsKeyPEM []byte, err error) {
+func SignHostCert(caCert *x509.Certificate, caKey crypto.Signer, host string, validFor time.Duration) (tlsCertPEM, tlsKeyPEM []byte, err error) {
 	// 生成叶子私钥
 	leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	tmpl := newLeafTemplate(host, leafKey, validFor)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)})
+	return certPEM, keyPEM, nil
+}
+
+// newLeafTemplate 叶子证书模板，host 为 IP 时写入 IP SAN，RSA 私钥额外允许密钥加密用途
+func newLeafTemplate(host string, key crypto.Signer, validFor time.Duration) *x509.Certificate {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, _ := rand.Int(rand.Reader, serialNumberLimit)
+	usage := x509.KeyUsageDigitalSignature
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
 	tmpl := &x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject:      pkix.Name{CommonName: host, Organization: []string{"CetiProbe MITM"}},
 		NotBefore:    time.Now().Add(-5 * time.Minute),
 		NotAfter:     time.Now().Add(validFor),
-		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		KeyUsage:     usage,
 		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
-		DNSNames:     []string{host},
-	}
-	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &leafKey.PublicKey, caKey)
-	if err != nil {
-		return nil, nil, err
 	}
+	addSAN(tmpl, host)
+	return tmpl
+}
 
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(leafKey)})
-	return certPEM, keyPEM, nil
+// addSAN 将 host 加入证书的 IP 或 DNS SAN
+func addSAN(cert *x509.Certificate, host string) {
+	if ip := net.ParseIP(host); ip != nil {
+		cert.IPAddresses = append(cert.IPAddresses, ip)
+	} else {
+		cert.DNSNames = append(cert.DNSNames, host)
+	}
 }
@@ -0,0 +1,389 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/md5"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 根证书导出格式
+const (
+	CAFormatPEM     = "pem"
+	CAFormatDER     = "der"
+	CAFormatCRT     = "crt" // DER 编码，Windows 与 Android 可直接安装
+	CAFormatCER     = "cer"
+	CAFormatPKCS12  = "p12"
+	CAFormatAndroid = "android" // 以 <subject_hash_old>.0 命名的 PEM，用于放入 /system/etc/security/cacerts
+
+	CAFormatMobileConfig = "mobileconfig" // iOS/macOS 配置描述文件
+)
+
+// ErrCANotFound 根证书不存在
+var ErrCANotFound = errors.New("ca not found")
+
+// CAManager 管理根证书：目录可配置，支持导入已有 CA、轮换与多格式导出。
+// 轮换或导入时原证书移入 previous 子目录，仍可查看与导出
+type CAManager struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// CAInfo 根证书摘要
+type CAInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	KeyType      string    `json:"key_type"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	Expired      bool      `json:"expired"`
+	DaysLeft     int       `json:"days_left"`
+	SHA256       string    `json:"sha256_fingerprint"`
+	SHA1         string    `json:"sha1_fingerprint"`
+	AndroidName  string    `json:"android_name"`
+	CertPath     string    `json:"cert_path"`
+}
+
+// CAStatus 当前与上一代根证书
+type CAStatus struct {
+	Dir      string  `json:"dir"`
+	Current  *CAInfo `json:"current"`
+	Previous *CAInfo `json:"previous,omitempty"`
+}
+
+// CAExportOptions 导出参数，私钥仅在 IncludeKey 时导出（仅 PEM 与 PKCS#12）
+type CAExportOptions struct {
+	Format     string
+	Previous   bool // 导出上一代根证书
+	IncludeKey bool
+	Password   string // PKCS#12 密码，导出私钥时必填
+}
+
+// CAExport 导出结果
+type CAExport struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// NewCAManager 创建根证书管理器，dir 为空时使用 DefaultCADir
+func NewCAManager(dir string) *CAManager {
+	if dir == "" {
+		dir = DefaultCADir()
+	}
+	return &CAManager{dir: filepath.Clean(dir)}
+}
+
+// Files 当前根证书的文件位置
+func (m *CAManager) Files() CAFiles {
+	return caFilesIn(m.dir)
+}
+
+// PreviousFiles 上一代根证书的文件位置
+func (m *CAManager) PreviousFiles() CAFiles {
+	return caFilesIn(filepath.Join(m.dir, "previous"))
+}
+
+// Ensure 读取当前根证书，不存在时生成
+func (m *CAManager) Ensure() (certPEM, keyPEM []byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	certPEM, keyPEM, err = readCAFiles(m.Files())
+	if !errors.Is(err, ErrCANotFound) {
+		return certPEM, keyPEM, err
+	}
+	if certPEM, keyPEM, err = newRootCA(""); err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, m.install(certPEM, keyPEM)
+}
+
+// Load 解析当前根证书，不存在时生成
+func (m *CAManager) Load() (*x509.Certificate, crypto.Signer, error) {
+	certPEM, keyPEM, err := m.Ensure()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ParseCA(certPEM, keyPEM)
+}
+
+// Rotate 生成新的根证书，keyType 为 rsa（默认）或 ecdsa
+func (m *CAManager) Rotate(keyType string) error {
+	certPEM, keyPEM, err := newRootCA(keyType)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.install(certPEM, keyPEM)
+}
+
+// Import 导入已有 CA。data 为 PEM（证书与私钥可在同一文件，也可由 keyData 单独提供）
+// 或 PKCS#12，password 用于 PKCS#12
+func (m *CAManager) Import(data, keyData []byte, password string) error {
+	cert, key, err := parseCAImport(data, keyData, password)
+	if err != nil {
+		return err
+	}
+	if err := validateCA(cert, key); err != nil {
+		return err
+	}
+	keyPEM, err := marshalKeyPEM(key)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.install(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), keyPEM)
+}
+
+// Info 返回当前与上一代根证书的摘要，当前根证书不存在时生成
+func (m *CAManager) Info() (*CAStatus, error) {
+	cert, _, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+	st := &CAStatus{Dir: m.dir, Current: newCAInfo(cert, m.Files().CertPath)}
+	if prev, err := m.loadPrevious(); err == nil {
+		st.Previous = newCAInfo(prev, m.PreviousFiles().CertPath)
+	}
+	return st, nil
+}
+
+// Export 按格式导出根证书
+func (m *CAManager) Export(opts CAExportOptions) (*CAExport, error) {
+	if opts.IncludeKey && opts.Format != "" && opts.Format != CAFormatPEM && opts.Format != CAFormatPKCS12 {
+		return nil, fmt.Errorf("private key cannot be exported as %s", opts.Format)
+	}
+	var cert *x509.Certificate
+	var key crypto.Signer
+	var err error
+	if opts.Previous {
+		var certPEM, keyPEM []byte
+		if certPEM, keyPEM, err = readCAFiles(m.PreviousFiles()); err == nil {
+			cert, key, err = ParseCA(certPEM, keyPEM)
+		}
+	} else {
+		cert, key, err = m.Load()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := "proxy_root_ca"
+	if opts.Previous {
+		name += "_previous"
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	switch opts.Format {
+	case "", CAFormatPEM:
+		data := certPEM
+		if opts.IncludeKey {
+			keyPEM, err := marshalKeyPEM(key)
+			if err != nil {
+				return nil, err
+			}
+			data = append(data, keyPEM...)
+		}
+		return &CAExport{Filename: name + ".pem", ContentType: "application/x-pem-file", Data: data}, nil
+	case CAFormatDER, CAFormatCRT, CAFormatCER:
+		return &CAExport{Filename: name + "." + opts.Format, ContentType: "application/x-x509-ca-cert", Data: cert.Raw}, nil
+	case CAFormatPKCS12:
+		if !opts.IncludeKey {
+			key = nil
+		} else if opts.Password == "" {
+			return nil, errors.New("password is required when exporting the private key")
+		}
+		data, err := encodePKCS12(cert, key, opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		return &CAExport{Filename: name + ".p12", ContentType: "application/x-pkcs12", Data: data}, nil
+	case CAFormatAndroid:
+		return &CAExport{Filename: androidCAName(cert), ContentType: "application/x-pem-file", Data: certPEM}, nil
+	case CAFormatMobileConfig:
+		return &CAExport{Filename: name + ".mobileconfig", ContentType: "application/x-apple-aspen-config", Data: appleProfile(cert)}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format: %s", opts.Format)
+}
+
+func (m *CAManager) loadPrevious() (*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(m.PreviousFiles().CertPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, errors.New("invalid ca cert pem")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// install 写入新的根证书，已有的根证书先移入 previous 目录，调用方需持有锁。
+// 新文件先写入临时文件，写入失败时不影响原证书
+func (m *CAManager) install(certPEM, keyPEM []byte) error {
+	cur, prev := m.Files(), m.PreviousFiles()
+	if err := os.MkdirAll(cur.Dir, 0755); err != nil {
+		return err
+	}
+	tmpCert, tmpKey := cur.CertPath+".tmp", cur.KeyPath+".tmp"
+	if err := os.WriteFile(tmpCert, certPEM, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmpKey, keyPEM, 0600); err != nil {
+		os.Remove(tmpCert)
+		return err
+	}
+
+	if _, _, err := readCAFiles(cur); err == nil {
+		if err := os.MkdirAll(prev.Dir, 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(cur.CertPath, prev.CertPath); err != nil {
+			return err
+		}
+		if err := os.Rename(cur.KeyPath, prev.KeyPath); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpKey, cur.KeyPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpCert, cur.CertPath)
+}
+
+func readCAFiles(files CAFiles) (certPEM, keyPEM []byte, err error) {
+	certPEM, err = os.ReadFile(files.CertPath)
+	if err == nil {
+		keyPEM, err = os.ReadFile(files.KeyPath)
+	}
+	if errors.Is(err, os.ErrNotExist) || err == nil && (len(certPEM) == 0 || len(keyPEM) == 0) {
+		return nil, nil, ErrCANotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+// parseCAImport 解析导入的 PEM 或 PKCS#12，返回与私钥匹配的证书
+func parseCAImport(data, keyData []byte, password string) (*x509.Certificate, crypto.Signer, error) {
+	var key crypto.Signer
+	var certs []*x509.Certificate
+	if block, _ := pem.Decode(data); block != nil {
+		rest := append(append(append([]byte{}, data...), '\n'), keyData...)
+		for {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			switch block.Type {
+			case "CERTIFICATE":
+				cert, err := x509.ParseCertificate(block.Bytes)
+				if err != nil {
+					return nil, nil, err
+				}
+				certs = append(certs, cert)
+			case "EC PARAMETERS":
+				// openssl ecparam -genkey 的附加输出，忽略
+			default:
+				k, err := parseKeyBlock(block)
+				if err != nil {
+					return nil, nil, err
+				}
+				key = k
+			}
+		}
+	} else {
+		var err error
+		if key, certs, err = decodePKCS12(data, password); err != nil {
+			return nil, nil, err
+		}
+	}
+	if key == nil {
+		return nil, nil, errors.New("private key not found")
+	}
+	for _, cert := range certs {
+		if pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool }); ok && pub.Equal(cert.PublicKey) {
+			return cert, key, nil
+		}
+	}
+	return nil, nil, errors.New("no certificate matches the private key")
+}
+
+// validateCA 导入的证书必须是未过期、可签发证书的 CA
+func validateCA(cert *x509.Certificate, key crypto.Signer) error {
+	if !cert.BasicConstraintsValid || !cert.IsCA {
+		return errors.New("certificate is not a CA")
+	}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return errors.New("certificate is not allowed to sign certificates")
+	}
+	if time.Now().After(cert.NotAfter) {
+		return errors.New("certificate has expired")
+	}
+	_, err := caSigner(key)
+	return err
+}
+
+func newCAInfo(cert *x509.Certificate, path string) *CAInfo {
+	s256 := sha256.Sum256(cert.Raw)
+	s1 := sha1.Sum(cert.Raw)
+	left := time.Until(cert.NotAfter)
+	return &CAInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: fmt.Sprintf("%X", cert.SerialNumber),
+		KeyType:      caKeyType(cert.PublicKey),
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		Expired:      left <= 0,
+		DaysLeft:     int(left.Hours() / 24),
+		SHA256:       fingerprint(s256[:]),
+		SHA1:         fingerprint(s1[:]),
+		AndroidName:  androidCAName(cert),
+		CertPath:     path,
+	}
+}
+
+func caKeyType(pub crypto.PublicKey) string {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	}
+	return fmt.Sprintf("%T", pub)
+}
+
+// fingerprint 冒号分隔的大写十六进制
+func fingerprint(sum []byte) string {
+	var b bytes.Buffer
+	for i, c := range sum {
+		if i > 0 {
+			b.WriteByte(':')
+		}
+		fmt.Fprintf(&b, "%02X", c)
+	}
+	return b.String()
+}
+
+// androidCAName Android 系统证书目录使用 openssl x509 -subject_hash_old 的结果命名：
+// DER 编码主题的 MD5 前 4 字节按小端序输出
+func androidCAName(cert *x509.Certificate) string {
+	sum := md5.Sum(cert.RawSubject)
+	return fmt.Sprintf("%08x.0", binary.LittleEndian.Uint32(sum[:4]))
+}
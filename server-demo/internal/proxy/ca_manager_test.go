@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"regexp"
+	"testing"
+
+	xpkcs12 "golang.org/x/crypto/pkcs12"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// TestCAManager 测试生成、轮换保留上一代、PEM 与 PKCS#12 导入以及各格式导出
+func TestCAManager(t *testing.T) {
+	m := NewCAManager(t.TempDir())
+	st, err := m.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := st.Current
+	if st.Previous != nil || first.KeyType != "RSA 2048" || len(first.SHA256) != 95 {
+		t.Fatalf("unexpected initial status: %+v", st)
+	}
+
+	if err := m.Rotate(LeafKeyECDSA); err != nil {
+		t.Fatal(err)
+	}
+	st, _ = m.Info()
+	if st.Current.KeyType != "ECDSA P-256" || st.Previous == nil || st.Previous.SHA256 != first.SHA256 {
+		t.Fatalf("rotation should keep the previous CA: %+v", st)
+	}
+	if exp, err := m.Export(CAExportOptions{Format: CAFormatDER, Previous: true}); err != nil {
+		t.Fatal(err)
+	} else if cert, err := x509.ParseCertificate(exp.Data); err != nil || newCAInfo(cert, "").SHA256 != first.SHA256 {
+		t.Fatal("previous CA not exported")
+	}
+
+	// Android 命名：8 位十六进制哈希加 .0，内容为 PEM
+	exp, err := m.Export(CAExportOptions{Format: CAFormatAndroid})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{8}\.0$`).MatchString(exp.Filename) || exp.Filename != st.Current.AndroidName {
+		t.Fatalf("unexpected android name %q", exp.Filename)
+	}
+	if block, _ := pem.Decode(exp.Data); block == nil || block.Type != "CERTIFICATE" {
+		t.Fatal("android export should be PEM")
+	}
+
+	// PKCS#12 导出私钥必须设置密码，标准实现可以读回
+	if _, err := m.Export(CAExportOptions{Format: CAFormatPKCS12, IncludeKey: true}); err == nil {
+		t.Fatal("exporting the key without a password should fail")
+	}
+	exp, err = m.Export(CAExportOptions{Format: CAFormatPKCS12, IncludeKey: true, Password: "密码"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, err := xpkcs12.Decode(exp.Data, "密码")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := key.(*ecdsa.PrivateKey); !ok || newCAInfo(cert, "").SHA256 != st.Current.SHA256 {
+		t.Fatal("pkcs12 export does not round-trip")
+	}
+	if _, _, err := decodePKCS12(exp.Data, "wrong"); !errors.Is(err, ErrPKCS12Password) {
+		t.Fatalf("expected password error, got %v", err)
+	}
+
+	// 导入 PKCS#12 与分开提供的 PEM 证书和私钥
+	m2 := NewCAManager(t.TempDir())
+	if err := m2.Import(exp.Data, nil, "密码"); err != nil {
+		t.Fatal(err)
+	}
+	if st2, _ := m2.Info(); st2.Current.SHA256 != st.Current.SHA256 || st2.Previous != nil {
+		t.Fatalf("unexpected imported status: %+v", st2)
+	}
+	certPEM, _ := os.ReadFile(m.PreviousFiles().CertPath)
+	keyPEM, _ := os.ReadFile(m.PreviousFiles().KeyPath)
+	if err := m2.Import(certPEM, keyPEM, ""); err != nil {
+		t.Fatal(err)
+	}
+	if st2, _ := m2.Info(); st2.Current.SHA256 != first.SHA256 || st2.Previous.SHA256 != st.Current.SHA256 {
+		t.Fatalf("PEM import should rotate the imported CA: %+v", st2)
+	}
+	if err := m2.Import(certPEM, nil, ""); err == nil {
+		t.Fatal("import without a private key should fail")
+	}
+
+	// OpenSSL 3 默认的 PBES2/AES-256 与 SHA-256 MAC
+	caCert, caKey := newTestCA(t)
+	modern, err := pkcs12.Modern2023.Encode(caKey, caCert, nil, "pw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m2.Import(modern, nil, "pw"); err != nil {
+		t.Fatal(err)
+	}
+	if st2, _ := m2.Info(); st2.Current.SHA256 != newCAInfo(caCert, "").SHA256 {
+		t.Fatalf("modern PKCS#12 not imported: %+v", st2)
+	}
+	if _, err := m.Export(CAExportOptions{Format: CAFormatDER, IncludeKey: true}); err == nil {
+		t.Fatal("DER export cannot carry the private key")
+	}
+
+	// 非 CA 证书不能导入
+	leafPEM, leafKeyPEM, _ := SignHostCert(caCert, caKey, "leaf.test", 0)
+	if err := m2.Import(append(leafPEM, leafKeyPEM...), nil, ""); err == nil {
+		t.Fatal("leaf certificate should be rejected")
+	}
+}
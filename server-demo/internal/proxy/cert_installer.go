@@ -1,7 +1,11 @@
 package proxy
 
 import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 )
@@ -35,20 +39,30 @@ func installCertWindows(certPath string) error {
 	return cmd.Run()
 }
 
-// installCertLinux Linux复制到系统证书目录并更新
+// installCertLinux 安装到检测到的发行版信任库与 NSS 数据库，不经过 shell
 func installCertLinux(certPath string) error {
-	// Ubuntu/Debian
-	cmd := exec.Command("sh", "-c",
-		fmt.Sprintf("cp %s /usr/local/share/ca-certificates/probe-ca.crt && update-ca-certificates", certPath))
-	err := cmd.Run()
-	if err == nil {
-		return nil
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return err
 	}
-
-	// CentOS/RHEL
-	cmd = exec.Command("sh", "-c",
-		fmt.Sprintf("cp %s /etc/pki/ca-trust/source/anchors/probe-ca.crt && update-ca-trust", certPath))
-	return cmd.Run()
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("invalid cert pem")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+	statuses, err := NewLinuxTrustStore().Install(cert)
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		if st.Error != "" {
+			return fmt.Errorf("%s (%s): %s", st.Type, st.Path, st.Error)
+		}
+	}
+	return nil
 }
 
 // GetInstallInstructions 获取各平台手动安装指引
@@ -82,6 +96,29 @@ func GetInstallInstructions(osType string) map[string]interface{} {
 			},
 			"command": "certutil -addstore -f ROOT proxy_root_ca.pem",
 		},
+		"ios": {
+			"title": "iOS 安装步骤",
+			"steps": []string{
+				"1. 使用 Safari 打开接入页面，下载 iOS 描述文件",
+				"2. 打开\"设置\" → \"已下载描述文件\"，点击安装并输入锁屏密码",
+				"3. 打开\"设置\" → \"通用\" → \"关于本机\" → \"证书信任设置\"，对 CetiProbe Root CA 启用完全信任",
+				"4. 在\"无线局域网\"中点击当前网络 → \"配置代理\" → \"手动\"，填写代理地址与端口",
+			},
+			"command": "",
+		},
+		"android": {
+			"title": "Android 安装步骤",
+			"steps": []string{
+				"1. 下载 proxy_root_ca.crt",
+				"2. 打开\"设置\" → \"安全\" → \"加密与凭据\" → \"安装证书\" → \"CA 证书\"，选择下载的文件",
+				"3. 在 WLAN 设置中修改当前网络，代理选择\"手动\"，填写代理地址与端口",
+				"",
+				"注意：Android 7 起应用默认只信任系统证书，",
+				"  调试自己的应用需在 network_security_config 中信任用户证书；",
+				"  已 root 的设备可将 Android 格式（<hash>.0）的证书放入 /system/etc/security/cacerts",
+			},
+			"command": "",
+		},
 		"linux": {
 			"title": "Linux 手动安装步骤",
 			"steps": []string{
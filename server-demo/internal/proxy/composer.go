@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"probe/internal/models"
+)
+
+// 构造请求限制
+const (
+	DefaultComposeTimeout = 30 * time.Second
+	MaxComposeTimeout     = 5 * time.Minute
+	MaxComposeRedirects   = 10
+)
+
+// 构造请求可指定的 HTTP 版本
+const (
+	HTTPVersionAuto = ""
+	HTTPVersion11   = "1.1"
+	HTTPVersion2    = "2"
+)
+
+// ComposeRequest 手工构造的请求
+type ComposeRequest struct {
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Body            string            `json:"body,omitempty"`
+	BodyBase64      string            `json:"body_base64,omitempty"` // 二进制内容以base64提交，优先于 body
+	TimeoutMs       int               `json:"timeout_ms,omitempty"`  // 默认 30 秒
+	FollowRedirects bool              `json:"follow_redirects"`
+	HTTPVersion     string            `json:"http_version,omitempty"` // ""/1.1/2
+}
+
+// template 校验并转换为请求模板
+func (c *ComposeRequest) template() (*replayTemplate, error) {
+	orig := &models.HTTPRequest{Method: http.MethodGet, URL: c.URL, Headers: c.Headers, Body: []byte(c.Body)}
+	o := ReplayOverrides{Method: &c.Method}
+	if c.BodyBase64 != "" {
+		o.BodyBase64 = &c.BodyBase64
+	}
+	t, err := buildReplayTemplate(orig, o)
+	if err != nil {
+		return nil, err
+	}
+	if c.HTTPVersion == HTTPVersion2 && t.url.Scheme != "https" {
+		return nil, errors.New("http/2 requires an https url")
+	}
+	return t, nil
+}
+
+func (c *ComposeRequest) timeout() (time.Duration, error) {
+	if c.TimeoutMs < 0 {
+		return 0, errors.New("timeout must not be negative")
+	}
+	if c.TimeoutMs == 0 {
+		return DefaultComposeTimeout, nil
+	}
+	d := time.Duration(c.TimeoutMs) * time.Millisecond
+	if d > MaxComposeTimeout {
+		return 0, errors.New("timeout exceeds limit")
+	}
+	return d, nil
+}
+
+// composeTransport 按主机与 HTTP 版本选择传输层，指定版本时使用只协商该版本的副本
+func (p *EnhancedProxyServer) composeTransport(host, version string) (*http.Transport, bool, error) {
+	base := p.transportFor(host)
+	switch version {
+	case HTTPVersionAuto:
+		return base, false, nil
+	case HTTPVersion2:
+		tr := base.Clone()
+		tr.ForceAttemptHTTP2 = true
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		tr.TLSClientConfig.NextProtos = []string{"h2"}
+		return tr, true, nil
+	case HTTPVersion11:
+		tr := base.Clone()
+		tr.ForceAttemptHTTP2 = false
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		if tr.TLSClientConfig != nil {
+			tr.TLSClientConfig.NextProtos = []string{"http/1.1"}
+		}
+		return tr, true, nil
+	}
+	return nil, false, errors.New("invalid http version: " + version)
+}
+
+// requireHTTP2 拒绝未使用 HTTP/2 的响应，服务端未协商 ALPN 时不会静默降级为 HTTP/1.1
+type requireHTTP2 struct {
+	rt http.RoundTripper
+}
+
+func (r requireHTTP2) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if err == nil && resp.ProtoMajor != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("server responded with %s instead of HTTP/2", resp.Proto)
+	}
+	return resp, err
+}
+
+// Compose 由服务端发送手工构造的请求，并作为 Flow 记录
+func (p *EnhancedProxyServer) Compose(ctx context.Context, c *ComposeRequest) (*models.Flow, error) {
+	tmpl, err := c.template()
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := c.timeout()
+	if err != nil {
+		return nil, err
+	}
+	tr, private, err := p.composeTransport(tmpl.url.Hostname(), c.HTTPVersion)
+	if err != nil {
+		return nil, err
+	}
+	if private {
+		defer tr.CloseIdleConnections()
+	}
+
+	var rt http.RoundTripper = tr
+	if c.HTTPVersion == HTTPVersion2 {
+		rt = requireHTTP2{tr}
+	}
+	client := &http.Client{Transport: rt, Timeout: timeout}
+	if c.FollowRedirects {
+		client.CheckRedirect = func(_ *http.Request, via []*http.Request) error {
+			if len(via) >= MaxComposeRedirects {
+				return errors.New("stopped after too many redirects")
+			}
+			return nil
+		}
+	} else {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+
+	req, err := tmpl.newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.sendFlow(client, req, tmpl.body, FlowSourceComposer, ""), nil
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"probe/pkg/storage"
+)
+
+func newComposeTestServer(t *testing.T) (*EnhancedProxyServer, *httptest.Server) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/proto", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/proto", http.StatusFound)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	ts := httptest.NewUnstartedServer(mux)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+
+	p := newTestProxy(t, "", true, storage.NewMemoryFlowStore())
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	p.transport.TLSClientConfig.RootCAs = pool
+	return p, ts
+}
+
+// TestComposeHTTPVersion 测试指定 HTTP 版本并记录 TLS 信息
+func TestComposeHTTPVersion(t *testing.T) {
+	p, ts := newComposeTestServer(t)
+	for version, want := range map[string]string{HTTPVersion11: "HTTP/1.1", HTTPVersion2: "HTTP/2.0"} {
+		flow, err := p.Compose(context.Background(), &ComposeRequest{URL: ts.URL + "/proto", HTTPVersion: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flow.Error != nil || flow.Response == nil {
+			t.Fatalf("version %s: request failed: %+v", version, flow.Error)
+		}
+		if string(flow.Response.Body) != want || flow.Response.Proto != want {
+			t.Fatalf("version %s: got %s", version, flow.Response.Body)
+		}
+		if flow.Source != FlowSourceComposer || flow.TLS == nil || flow.Performance == nil || flow.Content == nil {
+			t.Fatalf("flow details missing: %+v", flow)
+		}
+	}
+	if _, err := p.Compose(context.Background(), &ComposeRequest{URL: "http://example.com/", HTTPVersion: HTTPVersion2}); err == nil {
+		t.Fatal("http/2 over plain http should be rejected")
+	}
+
+	// 仅支持 HTTP/1.1 的服务端：无论是否声明 ALPN，都不应静默降级
+	h1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer h1.Close()
+	noALPN := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	noALPN.Listener = tls.NewListener(noALPN.Listener, &tls.Config{Certificates: h1.TLS.Certificates})
+	noALPN.Start()
+	defer noALPN.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	pool.AddCert(h1.Certificate())
+	p.transport.TLSClientConfig.RootCAs = pool
+	for _, u := range []string{h1.URL, strings.Replace(noALPN.URL, "http://", "https://", 1)} {
+		flow, err := p.Compose(context.Background(), &ComposeRequest{URL: u, HTTPVersion: HTTPVersion2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if flow.Error == nil || flow.Response != nil {
+			t.Fatalf("%s: http/1.1-only server should fail in http/2 mode, got %+v", u, flow.Response)
+		}
+	}
+}
+
+// TestComposeRedirectAndTimeout 测试重定向与超时
+func TestComposeRedirectAndTimeout(t *testing.T) {
+	p, ts := newComposeTestServer(t)
+	flow, err := p.Compose(context.Background(), &ComposeRequest{URL: ts.URL + "/redirect"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flow.Response.StatusCode != http.StatusFound {
+		t.Fatalf("redirect followed without follow_redirects: %d", flow.Response.StatusCode)
+	}
+	flow, err = p.Compose(context.Background(), &ComposeRequest{URL: ts.URL + "/redirect", FollowRedirects: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flow.Response.StatusCode != http.StatusOK {
+		t.Fatalf("redirect not followed: %d", flow.Response.StatusCode)
+	}
+
+	flow, err = p.Compose(context.Background(), &ComposeRequest{URL: ts.URL + "/slow", TimeoutMs: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flow.Error == nil || !flow.Error.IsTimeout {
+		t.Fatalf("expected timeout error, got %+v", flow.Error)
+	}
+}
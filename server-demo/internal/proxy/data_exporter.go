@@ -23,7 +23,7 @@ func NewDataExporter(store storage.FlowStorage) *DataExporter {
 
 // ExportToJSON 导出为JSON格式
 func (de *DataExporter) ExportToJSON(filename string) error {
-	flows := de.store.GetAll()
+	flows := de.store.GetAll(0)
 
 	file, err := os.Create(filename)
 	if err != nil {
@@ -38,7 +38,7 @@ func (de *DataExporter) ExportToJSON(filename string) error {
 
 // ExportToCSV 导出为CSV格式
 func (de *DataExporter) ExportToCSV(filename string) error {
-	flows := de.store.GetAll()
+	flows := de.store.GetAll(0)
 
 	file, err := os.Create(filename)
 	if err != nil {
@@ -153,7 +153,7 @@ func (de *DataExporter) flowToCSVRecord(flow *models.Flow) []string {
 
 // ExportPerformanceReport 导出性能报告
 func (de *DataExporter) ExportPerformanceReport(filename string) error {
-	flows := de.store.GetAll()
+	flows := de.store.GetAll(0)
 
 	// 计算性能统计
 	stats := de.calculatePerformanceStats(flows)
@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -33,11 +35,71 @@ type EnhancedProxyServer struct {
 	errorCollector *ErrorCollector
 	geoService     *GeoLocationService
 	dnsResolver    *DNSResolver
+	breakpoints    *BreakpointManager
+	rewriter       *RewriteEngine
+	mapLocal       *MapLocalManager
+	mapRemote      *MapRemoteManager
+	mocks          *MockManager
+	throttle       *ThrottleManager
+	faults         *FaultManager
+	mitmPolicy     *MITMPolicy
+	websocket      *WebSocketManager
+	upstream       *UpstreamManager
+	transport      *http.Transport // 访问上游使用的传输层，重放与构造请求共用
+	insecureOnce   sync.Once
+	insecureTr     *http.Transport                              // 不校验上游证书的 transport 副本，MITM 规则允许不安全上游时使用
+	envDial        func(network, addr string) (net.Conn, error) // goproxy 按环境变量选择上游代理的拨号函数
+	socks          SOCKS5Config
+	socksLn        net.Listener
+	transparent    TransparentConfig
+	transparentLn  net.Listener
+	reverse        ReverseConfig
+	reverseSrv     *http.Server
+	stream         StreamConfig
+	leafConfig     LeafCertConfig
+	ca             *CAManager
+	leafCerts      *LeafCertCache // 需要签发证书时在 Start 中创建
+}
+
+// proxyCtxData 保存在 goproxy ProxyCtx.UserData 中的单个请求状态
+type proxyCtxData struct {
+	flowID     string
+	flow       *models.Flow     // 处理中的 Flow，存储中保存的是它发布时的副本
+	viaConnect bool             // 经 CONNECT 隧道解密的请求
+	throttle   *ThrottleProfile // 生效的网络条件
+	throttleBy string           // 网络条件来源：规则ID或 global
+	fault      *FaultRule       // 本次请求要注入的响应阶段故障
+	connect    *connectCtxData  // 所属的 CONNECT 隧道
+}
+
+// connectCtxData CONNECT 请求的 UserData，goproxy 会将其复制给隧道内解密出的请求
+type connectCtxData struct {
+	host      string
+	handshake *mitmHandshake
+	dst       string // 透明代理的原始目标，隧道内的请求固定连到该地址
+
+	trOnce sync.Once
+	tr     *http.Transport
+}
+
+// transport 返回固定连到原始目标的传输层，隧道内的请求共用其连接池；
+// 按主机名选择上游路由与是否校验证书，SNI 与证书校验仍使用请求的主机名
+func (cd *connectCtxData) transport(p *EnhancedProxyServer, host string) *http.Transport {
+	cd.trOnce.Do(func() {
+		tr := p.transportFor(host).Clone()
+		tr.Proxy = nil
+		tr.IdleConnTimeout = 90 * time.Second
+		tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return p.dialUpstream(withOriginalDst(ctx, cd.dst), network, addr, p.envDial)
+		}
+		cd.tr = tr
+	})
+	return cd.tr
 }
 
 // NewEnhancedProxyServer 创建增强版代理服务器
 func NewEnhancedProxyServer(addr string, https bool, store storage.FlowStorage) *EnhancedProxyServer {
-	return &EnhancedProxyServer{
+	p := &EnhancedProxyServer{
 		addr:           addr,
 		https:          https,
 		store:          store,
@@ -46,10 +108,139 @@ func NewEnhancedProxyServer(addr string, https bool, store storage.FlowStorage)
 		errorCollector: NewErrorCollector(),
 		geoService:     NewGeoLocationService(),
 		dnsResolver:    NewDNSResolver(),
+		breakpoints:    NewBreakpointManager(),
+		stream:         DefaultStreamConfig(),
+		ca:             NewCAManager(DefaultCADir()),
+	}
+	p.websocket, _ = NewWebSocketManager("")
+	p.transport = newUpstreamTransport(p.proxyForRequest)
+	return p
+}
+
+// newUpstreamTransport 创建访问上游的传输层，proxy 选择上游代理
+func newUpstreamTransport(proxy func(*http.Request) (*url.URL, error)) *http.Transport {
+	return &http.Transport{
+		TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+		Proxy:             proxy,
+		DialContext:       (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2: true,
+	}
+}
+
+// SetBreakpointManager 使用外部的断点管理器，使规则在代理重启后仍然保留
+func (p *EnhancedProxyServer) SetBreakpointManager(bm *BreakpointManager) {
+	if bm != nil {
+		p.breakpoints = bm
+	}
+}
+
+// SetRewriteEngine 设置改写规则引擎，为 nil 时不做改写
+func (p *EnhancedProxyServer) SetRewriteEngine(e *RewriteEngine) {
+	p.rewriter = e
+}
+
+// SetMapLocalManager 设置 Map Local 规则
+func (p *EnhancedProxyServer) SetMapLocalManager(m *MapLocalManager) {
+	p.mapLocal = m
+}
+
+// SetMapRemoteManager 设置 Map Remote 规则
+func (p *EnhancedProxyServer) SetMapRemoteManager(m *MapRemoteManager) {
+	p.mapRemote = m
+}
+
+// SetMockManager 设置 Mock 与阻断规则
+func (p *EnhancedProxyServer) SetMockManager(m *MockManager) {
+	p.mocks = m
+}
+
+// SetThrottleManager 设置网络条件模拟
+func (p *EnhancedProxyServer) SetThrottleManager(m *ThrottleManager) {
+	p.throttle = m
+}
+
+// SetFaultManager 设置故障注入规则
+func (p *EnhancedProxyServer) SetFaultManager(m *FaultManager) {
+	p.faults = m
+}
+
+// SetWebSocketManager 设置 WebSocket 消息规则与订阅
+func (p *EnhancedProxyServer) SetWebSocketManager(m *WebSocketManager) {
+	if m != nil {
+		p.websocket = m
+	}
+}
+
+// SetMITMPolicy 设置 CONNECT 隧道的解密策略，为 nil 时全部解密
+func (p *EnhancedProxyServer) SetMITMPolicy(m *MITMPolicy) {
+	p.mitmPolicy = m
+}
+
+// SetUpstreamManager 设置上游代理路由，为 nil 时按环境变量选择
+func (p *EnhancedProxyServer) SetUpstreamManager(m *UpstreamManager) {
+	p.upstream = m
+}
+
+// SetSOCKS5 设置 SOCKS5 监听，在下次启动时生效
+func (p *EnhancedProxyServer) SetSOCKS5(cfg SOCKS5Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.socks = cfg
+}
+
+// SetTransparent 设置透明代理监听，在下次启动时生效
+func (p *EnhancedProxyServer) SetTransparent(cfg TransparentConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transparent = cfg
+}
+
+// SetReverse 设置反向代理监听，在下次启动时生效
+func (p *EnhancedProxyServer) SetReverse(cfg ReverseConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reverse = cfg
+}
+
+// SetStreamConfig 设置流式响应的捕获上限，未设置的字段使用默认值
+func (p *EnhancedProxyServer) SetStreamConfig(cfg StreamConfig) {
+	p.stream = cfg.withDefaults()
+}
+
+// SetLeafCertConfig 设置 MITM 叶子证书的私钥算法与缓存参数
+func (p *EnhancedProxyServer) SetLeafCertConfig(cfg LeafCertConfig) {
+	p.leafConfig = cfg
+}
+
+// SetCAManager 使用外部的根证书管理器，使证书目录可配置
+func (p *EnhancedProxyServer) SetCAManager(m *CAManager) {
+	p.ca = m
+}
+
+// initLeafCerts 解密 HTTPS 或反向代理启用 TLS 时加载 CA 并创建叶子证书缓存
+func (p *EnhancedProxyServer) initLeafCerts() error {
+	if !p.https && !(p.reverse.Addr != "" && p.reverse.TLS) {
+		return nil
+	}
+	caCert, caKey, err := p.ca.Load()
+	if err != nil {
+		return err
 	}
+	p.leafCerts = NewLeafCertCache(caCert, caKey, p.leafConfig)
+	return nil
 }
 
-// Start 启动增强版代理服务器
+// GetCertCacheStats 返回叶子证书缓存统计，未签发证书时返回 nil
+func (p *EnhancedProxyServer) GetCertCacheStats() *LeafCertStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.leafCerts == nil {
+		return nil
+	}
+	return p.leafCerts.Stats()
+}
+
+// Start 启动增强版代理服务器，全部入口监听成功后返回，请求在后台处理；任一入口失败时关闭已建立的监听并返回错误
 func (p *EnhancedProxyServer) Start() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -63,7 +254,35 @@ func (p *EnhancedProxyServer) Start() error {
 	// 捕获请求
 	gp.OnRequest().DoFunc(func(req *http.Request, ctx *goproxy.ProxyCtx) (*http.Request, *http.Response) {
 		flowID := uuid.NewString()
-		ctx.UserData = flowID
+		cd, viaConnect := ctx.UserData.(*connectCtxData)
+		if prev, ok := ctx.UserData.(*proxyCtxData); ok && prev.connect != nil {
+			// 明文 HTTP 隧道内的后续请求复用同一个 ProxyCtx
+			cd, viaConnect = prev.connect, true
+		}
+		if viaConnect && cd.handshake != nil {
+			cd.handshake.requests.Add(1)
+		}
+		if viaConnect && req.URL.Host == "" {
+			// 明文 HTTP 隧道内的请求只有路径，按 Host 补全地址
+			req.URL.Scheme, req.URL.Host = "http", req.Host
+			if req.URL.Host == "" {
+				req.URL.Host = cd.host
+			}
+		}
+		// 部分客户端经代理发送 ws:// 地址，转为对应的 http(s) 地址
+		switch req.URL.Scheme {
+		case "ws":
+			req.URL.Scheme = "http"
+		case "wss":
+			req.URL.Scheme = "https"
+		}
+		state := &proxyCtxData{flowID: flowID, viaConnect: viaConnect, connect: cd}
+		// 透明代理隧道内的请求在目标未被改写时连到原始目标
+		pinnedHost := ""
+		if viaConnect && cd.dst != "" {
+			pinnedHost = req.URL.Host
+		}
+		ctx.UserData = state
 
 		start := time.Now()
 
@@ -80,6 +299,14 @@ func (p *EnhancedProxyServer) Start() error {
 			Performance: perfMetrics,
 			Network:     p.buildNetworkInfo(req),
 		}
+		if isReverseRequest(req) {
+			flow.Source = FlowSourceReverse
+		}
+
+		// 不协商 permessage-deflate，消息以明文帧传输以便记录与修改
+		if isWebSocketUpgrade(req.Header) {
+			req.Header.Del("Sec-WebSocket-Extensions")
+		}
 
 		// 读取请求体
 		var reqBody []byte
@@ -90,6 +317,35 @@ func (p *EnhancedProxyServer) Start() error {
 			flow.Request.Body = reqBody
 		}
 
+		// 改写规则
+		if p.rewriter != nil {
+			newBody, applied, err := p.rewriter.ApplyRequest(req, reqBody)
+			if err != nil {
+				p.errorCollector.RecordError(flowID, "rewrite", err.Error(), 0, false, 0)
+			}
+			if len(applied) > 0 {
+				reqBody = newBody
+				flow.AppliedRules = append(flow.AppliedRules, applied...)
+				flow.Scheme = req.URL.Scheme
+				flow.Request = p.buildHTTPRequest(req)
+				flow.Request.Body = reqBody
+			}
+		}
+
+		// Map Remote：改写上游地址
+		p.applyMapRemote(flow, req)
+		// 按改写后的主机选择是否校验上游证书，并记录发送失败的原因
+		ctx.RoundTripper = goproxy.RoundTripperFunc(func(req *http.Request, _ *goproxy.ProxyCtx) (*http.Response, error) {
+			var tr http.RoundTripper
+			if pinnedHost != "" && req.URL.Host == pinnedHost {
+				tr = cd.transport(p, req.URL.Hostname())
+			}
+			return p.upstreamRoundTrip(flow, req, tr)
+		})
+		if p.upstream != nil {
+			flow.Upstream = p.upstreamRoute(req.URL.Host)
+		}
+
 		// 分析请求内容
 		flow.Content = p.analyzeContent(reqBody, req.Header)
 
@@ -99,18 +355,60 @@ func (p *EnhancedProxyServer) Start() error {
 		// 记录网络统计
 		p.networkMonitor.RecordRequest(req.Host, true, 0, int64(len(reqBody)))
 
+		state.flow = flow
 		p.store.Add(flow)
+		// 之后的修改都在 flow 上进行，请求阶段结束时写回存储
+		defer p.publishFlow(flow)
+
+		// 网络条件模拟：选定配置，上下行消息体在转发时限速
+		p.selectThrottle(state, flow, req)
+
+		// Map Local：直接返回本地文件，不访问上游
+		if resp := p.serveMapLocal(flow, req); resp != nil {
+			return req, resp
+		}
+
+		// Mock/阻断：返回合成的响应
+		if resp := p.serveMock(flow, req, reqBody); resp != nil {
+			return req, resp
+		}
+		if flow.Intercept != nil && flow.Intercept.Type == InterceptBlockDrop {
+			ctx.RoundTripper = p.dropRoundTripper(flow)
+			return req, nil
+		}
+
+		// 故障注入：错误响应与挂起在请求阶段应答，其余故障在响应阶段注入
+		if p.faults != nil {
+			if rule := p.faults.Pick(req); rule != nil {
+				if rule.IsRequestFault() {
+					return req, p.injectRequestFault(flow, rule, req)
+				}
+				state.fault = rule
+			}
+		}
+
+		// 断点：挂起请求，等待用户编辑后放行或中止
+		if rule := p.breakpoints.Match(BreakpointPhaseRequest, req.Method, req.URL.Host, req.URL.Path); rule != nil {
+			if resp := p.holdRequest(flow, rule, req, reqBody); resp != nil {
+				return req, resp
+			}
+		}
+
+		if state.throttle != nil && req.Body != nil && req.Body != http.NoBody {
+			req.Body = p.throttle.WrapUpload(req.Context(), req.Body, state.throttle, state.throttleBy, clientIPOf(req))
+		}
 		return req, nil
 	})
 
 	// 捕获响应
 	gp.OnResponse().DoFunc(func(resp *http.Response, ctx *goproxy.ProxyCtx) *http.Response {
-		flowID, _ := ctx.UserData.(string)
-		if flowID == "" {
+		state, _ := ctx.UserData.(*proxyCtxData)
+		if state == nil {
 			return resp
 		}
+		flowID := state.flowID
 
-		flow := p.store.GetByID(flowID)
+		flow := state.flow
 		if flow == nil {
 			return resp
 		}
@@ -119,14 +417,50 @@ func (p *EnhancedProxyServer) Start() error {
 		flow.EndAt = end
 		flow.LatencyMs = end.Sub(flow.StartAt).Milliseconds()
 
-		// 更新性能指标
+		// 更新性能指标，从性能收集器获取最新的指标
 		if flow.Performance != nil {
-			flow.Performance.TotalTime = flow.LatencyMs
-			// 从性能收集器获取最新的指标
+			perf := *flow.Performance
 			if latestPerf := p.perfCollector.GetMetrics(flowID); latestPerf != nil {
-				flow.Performance = latestPerf
-				flow.Performance.TotalTime = flow.LatencyMs
+				perf = *latestPerf
+			}
+			perf.TotalTime = flow.LatencyMs
+			flow.Performance = &perf
+		}
+
+		// 阻断规则要求断开连接：在写出响应前中断（MITM 隧道不会执行到这里）
+		if flow.Intercept != nil && flow.Intercept.Type == InterceptBlockDrop {
+			p.publishFlow(flow)
+			abortClientStream(!state.viaConnect, errConnDropped)
+			return resp
+		}
+
+		// WebSocket 升级：消息体即升级后的连接，不读取，改为逐条记录消息
+		if resp != nil && resp.StatusCode == http.StatusSwitchingProtocols && isWebSocketUpgrade(resp.Header) {
+			if rw, ok := resp.Body.(io.ReadWriteCloser); ok && state.throttle != nil {
+				resp.Body = p.throttle.WrapStream(rw, state.throttle, state.throttleBy, clientIPOf(ctx.Req))
 			}
+			p.startWebSocket(flow, ctx.Req, resp)
+			p.CleanupFlow(flowID)
+			return resp
+		}
+
+		// 流式响应：边转发边捕获，消息体读完前 Flow 标记为传输中
+		if resp != nil && p.shouldStream(flow, ctx.Req, resp, state) {
+			if flow.Scheme == "https" {
+				flow.TLS = p.collectTLSInfo(resp)
+			}
+			if state.fault != nil {
+				p.injectStreamFault(flow, state.fault, resp)
+			}
+			p.startStream(flow, resp)
+			p.CleanupFlow(flowID)
+			if state.fault != nil && state.fault.Fault == FaultReset {
+				resp.Body = streamResetReader(state.fault, resp, !state.viaConnect)
+			}
+			if state.throttle != nil {
+				resp.Body = p.throttle.WrapDownload(ctx.Req.Context(), resp.Body, state.throttle, state.throttleBy, clientIPOf(ctx.Req), !state.viaConnect)
+			}
+			return resp
 		}
 
 		// 读取响应体
@@ -137,6 +471,29 @@ func (p *EnhancedProxyServer) Start() error {
 			resp.Body = io.NopCloser(bytes.NewReader(body))
 		}
 
+		// 改写规则
+		if resp != nil && p.rewriter != nil {
+			newBody, applied, err := p.rewriter.ApplyResponse(ctx.Req, resp, body)
+			if err != nil {
+				p.errorCollector.RecordError(flowID, "rewrite", err.Error(), 0, false, 0)
+			}
+			if len(applied) > 0 {
+				body = newBody
+				flow.AppliedRules = append(flow.AppliedRules, applied...)
+			}
+		}
+
+		// 断点：挂起响应，等待用户编辑后放行或中止
+		if resp != nil && flow.Request != nil {
+			if rule := p.breakpoints.Match(BreakpointPhaseResponse, flow.Request.Method, ctx.Req.URL.Host, flow.Request.Path); rule != nil {
+				resp, body = p.holdResponse(flow, rule, resp, body)
+			}
+		}
+
+		if resp != nil && state.fault != nil {
+			body = p.injectResponseFault(flow, state.fault, resp, body)
+		}
+
 		// 构建响应
 		if resp != nil {
 			flow.Response = &models.HTTPResponse{
@@ -152,8 +509,8 @@ func (p *EnhancedProxyServer) Start() error {
 			flow.Content = p.analyzeContent(body, resp.Header)
 		}
 
-		// 收集TLS信息
-		if flow.Scheme == "https" {
+		// 收集TLS信息，请求失败时保留 upstreamRoundTrip 记录的证书信息
+		if flow.Scheme == "https" && resp != nil {
 			flow.TLS = p.collectTLSInfo(resp)
 		}
 
@@ -163,56 +520,162 @@ func (p *EnhancedProxyServer) Start() error {
 
 		// 清理性能数据
 		p.CleanupFlow(flowID)
+		p.publishFlow(flow)
 
+		if resp != nil && state.fault != nil && state.fault.Fault == FaultReset {
+			resp.Body = &resetReader{r: resp.Body, remaining: state.fault.cutOffset(len(body)), abortHandler: !state.viaConnect}
+		}
+		if resp != nil && state.throttle != nil {
+			resp.Body = p.throttle.WrapDownload(ctx.Req.Context(), resp.Body, state.throttle, state.throttleBy, clientIPOf(ctx.Req), !state.viaConnect)
+		}
 		return resp
 	})
 
-	// HTTPS MITM（自签证书）
-	if p.https {
-		certPEM, keyPEM, _, err := EnsureCAExists()
+	// 透传隧道与读取上游证书经 dialUpstream 按上游路由建立连接，env 路由保留 goproxy 按环境变量选择的上游代理
+	envDial := gp.ConnectDial
+	p.envDial = envDial
+	gp.ConnectDial = nil
+	gp.ConnectDialWithReq = func(req *http.Request, network, addr string) (net.Conn, error) {
+		return p.dialTunnel(req, network, addr, envDial)
+	}
+
+	// HTTPS MITM（自签证书），叶子证书仿照上游证书签发并按地址缓存
+	if err := p.initLeafCerts(); err != nil {
+		return err
+	}
+	if p.leafCerts != nil && !p.leafConfig.NoUpstream {
+		p.leafCerts.SetUpstreamCert(func(addr, dialAddr string) (*x509.Certificate, error) {
+			return p.fetchUpstreamCert(addr, dialAddr, envDial)
+		})
+	}
+	tlsConfigForHost := func(host string, ctx *goproxy.ProxyCtx) (*tls.Config, error) {
+		h := stripHostPort(host)
+		cert, err := p.leafCerts.GetUpstreamVia(withDefaultPort(host, "443"), originalDstOf(ctx.Req.Context()))
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			MinVersion:   tls.VersionTLS12,
+			ServerName:   h,
+		}, nil
+	}
+
+	// 普通请求与解密后的请求均经由 transport 按上游路由转发
+	gp.Tr = p.transport
+
+	// 按 MITM 策略决定解密、透传或拒绝
+	gp.OnRequest().HandleConnect(goproxy.FuncHttpsHandler(func(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
+		mode := tunnelModeOf(ctx.Req)
+		action, ruleID := p.decideTunnel(stripHostPort(host), mode == tunnelModeHTTP)
+		if action == TunnelMitm && mode == tunnelModeRaw {
+			action = TunnelPassthrough
+		}
+		switch {
+		case action == TunnelMitm && mode == tunnelModeHTTP:
+			// SOCKS5/透明代理隧道内的明文 HTTP 直接解析请求
+			ctx.UserData = &connectCtxData{host: host, dst: originalDstOf(ctx.Req.Context())}
+			return &goproxy.ConnectAction{Action: goproxy.ConnectHTTPMitm}, host
+		case action == TunnelMitm:
+			// 跟踪客户端握手，识别拒绝代理证书（证书固定）的客户端
+			hs := &mitmHandshake{connectReq: ctx.Req, host: host}
+			ctx.UserData = &connectCtxData{host: host, handshake: hs, dst: originalDstOf(ctx.Req.Context())}
+			return &goproxy.ConnectAction{Action: goproxy.ConnectMitm, TLSConfig: func(host string, ctx *goproxy.ProxyCtx) (*tls.Config, error) {
+				cfg, err := tlsConfigForHost(host, ctx)
+				if err != nil {
+					return nil, err
+				}
+				return trackHandshake(cfg, hs), nil
+			}}, host
+		case action == TunnelReject:
+			flow := p.newTunnelFlow(ctx.Req, host, action, ruleID)
+			p.finishTunnelFlow(flow, 0, 0, nil)
+			ctx.Resp = goproxy.NewResponse(ctx.Req, goproxy.ContentTypeText, http.StatusForbidden, "CONNECT rejected by MITM policy")
+			return goproxy.RejectConnect, host
+		}
+		flow := p.newTunnelFlow(ctx.Req, host, action, ruleID)
+		ctx.Req = withTunnelFlow(ctx.Req, flow)
+		return goproxy.OkConnect, host
+	}))
+
+	ln, err := net.Listen("tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	if err := p.startListeners(gp); err != nil {
+		ln.Close()
+		p.closeListeners()
+		return err
+	}
+	p.srv = &http.Server{Addr: ln.Addr().String(), Handler: gp}
+	go p.srv.Serve(&clientListener{Listener: ln, onClose: p.checkHandshake})
+	return nil
+}
+
+// startListeners 启动 SOCKS5、透明代理与反向代理等附加入口，流量均交给 gp 处理
+func (p *EnhancedProxyServer) startListeners(gp *goproxy.ProxyHttpServer) error {
+	if p.socks.Addr != "" {
+		ln, err := net.Listen("tcp", p.socks.Addr)
 		if err != nil {
 			return err
 		}
-		caCert, caKey, err := ParseCA(certPEM, keyPEM)
+		p.socksLn = ln
+		go p.serveSOCKS5(ln, p.socks, gp)
+	}
+	if p.transparent.Addr != "" {
+		ln, err := listenTransparent(p.transparent.Addr, p.transparent.TProxy)
 		if err != nil {
 			return err
 		}
-
-		tlsConfigForHost := func(host string, ctx *goproxy.ProxyCtx) (*tls.Config, error) {
-			h := host
-			if i := strings.IndexByte(h, ':'); i >= 0 {
-				h = h[:i]
-			}
-			leafCertPEM, leafKeyPEM, err := SignHostCert(caCert, caKey, h, 24*time.Hour)
-			if err != nil {
-				return nil, err
-			}
-			pair, err := tls.X509KeyPair(leafCertPEM, leafKeyPEM)
-			if err != nil {
-				return nil, err
-			}
-			return &tls.Config{
-				Certificates: []tls.Certificate{pair},
-				MinVersion:   tls.VersionTLS12,
-				ServerName:   h,
-			}, nil
+		p.transparentLn = ln
+		go p.serveTransparent(ln, p.transparent, gp)
+	}
+	if p.reverse.Addr != "" {
+		if err := p.startReverse(gp); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		gp.Tr = &http.Transport{
-			TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
-			Proxy:             http.ProxyFromEnvironment,
-			DialContext:       (&net.Dialer{Timeout: 30 * time.Second}).DialContext,
-			ForceAttemptHTTP2: true,
-		}
+// closeListeners 关闭附加入口
+func (p *EnhancedProxyServer) closeListeners() {
+	if p.socksLn != nil {
+		p.socksLn.Close()
+		p.socksLn = nil
+	}
+	if p.transparentLn != nil {
+		p.transparentLn.Close()
+		p.transparentLn = nil
+	}
+	if p.reverseSrv != nil {
+		p.reverseSrv.Close()
+		p.reverseSrv = nil
+	}
+}
 
-		gp.OnRequest().HandleConnect(goproxy.FuncHttpsHandler(func(host string, ctx *goproxy.ProxyCtx) (*goproxy.ConnectAction, string) {
-			return &goproxy.ConnectAction{Action: goproxy.ConnectMitm, TLSConfig: tlsConfigForHost}, host
-		}))
+// selectThrottle 为请求选择网络条件并记录在 Flow 上
+func (p *EnhancedProxyServer) selectThrottle(state *proxyCtxData, flow *models.Flow, req *http.Request) {
+	if p.throttle == nil {
+		return
 	}
+	profile, source := p.throttle.Select(stripHostPort(req.URL.Host), clientIPOf(req))
+	if profile == nil {
+		return
+	}
+	state.throttle, state.throttleBy = profile, source
+	flow.Throttle = &models.ThrottleInfo{Profile: profile.Name, Source: source}
+}
 
-	p.srv = &http.Server{Addr: p.addr, Handler: gp}
-	go p.srv.ListenAndServe()
-	return nil
+// clientIPOf 返回客户端IP
+func clientIPOf(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return h
+	}
+	return req.RemoteAddr
 }
 
 // buildHTTPRequest 构建HTTP请求
@@ -302,37 +765,6 @@ func (p *EnhancedProxyServer) analyzeContent(body []byte, headers http.Header) *
 	return contentInfo
 }
 
-// collectTLSInfo 收集TLS信息
-func (p *EnhancedProxyServer) collectTLSInfo(resp *http.Response) *models.TLSInfo {
-	if resp == nil || resp.TLS == nil {
-		return nil
-	}
-
-	tlsInfo := &models.TLSInfo{
-		Version:     p.getTLSVersion(resp.TLS.Version),
-		CipherSuite: p.getCipherSuite(resp.TLS.CipherSuite),
-		IsSecure:    true,
-		Protocol:    "TLS",
-	}
-
-	// 收集证书信息
-	if len(resp.TLS.PeerCertificates) > 0 {
-		cert := resp.TLS.PeerCertificates[0]
-		tlsInfo.Certificate = &models.CertificateInfo{
-			Subject:      cert.Subject.String(),
-			Issuer:       cert.Issuer.String(),
-			NotBefore:    cert.NotBefore,
-			NotAfter:     cert.NotAfter,
-			SerialNumber: cert.SerialNumber.String(),
-			Fingerprint:  fmt.Sprintf("%x", cert.Signature),
-			IsSelfSigned: cert.Issuer.String() == cert.Subject.String(),
-			IsValid:      time.Now().After(cert.NotBefore) && time.Now().Before(cert.NotAfter),
-		}
-	}
-
-	return tlsInfo
-}
-
 // 辅助方法
 func (p *EnhancedProxyServer) isPrivateIP(ip string) bool {
 	parsedIP := net.ParseIP(ip)
@@ -460,7 +892,8 @@ func (p *EnhancedProxyServer) getCipherSuite(suite uint16) string {
 	case 0xCCA9:
 		return "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305"
 	default:
-		return fmt.Sprintf("Unknown (0x%04x)", suite)
+		// TLS 1.3 及 GCM 等套件使用标准库的名称
+		return tls.CipherSuiteName(suite)
 	}
 }
 
@@ -471,6 +904,7 @@ func (p *EnhancedProxyServer) Stop() error {
 	if p.srv == nil {
 		return nil
 	}
+	p.closeListeners()
 	err := p.srv.Close()
 	p.srv = nil
 	return err
@@ -483,6 +917,11 @@ func (p *EnhancedProxyServer) IsRunning() bool {
 	return p.srv != nil
 }
 
+// Addr 返回 HTTP 代理的监听地址
+func (p *EnhancedProxyServer) Addr() string {
+	return p.addr
+}
+
 // collectDNSMetrics 收集DNS指标
 func (p *EnhancedProxyServer) collectDNSMetrics(flowID, host string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -511,3 +950,9 @@ func (p *EnhancedProxyServer) CleanupFlow(flowID string) {
 	p.perfCollector.Cleanup(flowID)
 	p.errorCollector.Cleanup(flowID)
 }
+
+// publishFlow 将处理中的 Flow 写回存储，替换之前保存的副本
+func (p *EnhancedProxyServer) publishFlow(flow *models.Flow) {
+	cp := *flow
+	p.store.Update(flow.ID, func(f *models.Flow) { *f = cp })
+}
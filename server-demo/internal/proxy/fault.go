@@ -0,0 +1,395 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// 故障类型
+const (
+	FaultStatus   = "status"   // 返回 5xx/429 等错误响应，可带 Retry-After
+	FaultHang     = "hang"     // 挂起请求直到超时
+	FaultReset    = "reset"    // 传输消息体途中断开连接
+	FaultTruncate = "truncate" // 截断响应消息体
+	FaultCorrupt  = "corrupt"  // 随机篡改响应字节
+)
+
+// ErrorInfo.Type 中记录的故障注入类型
+const FaultErrorType = "fault_injection"
+
+// DefaultFaultHang hang 故障未指定时长时的最长挂起时间
+const DefaultFaultHang = 2 * time.Minute
+
+// DefaultFaultStreamBytes 长度未知的流式响应未指定 after_bytes 时，截断、断开与篡改作用的字节范围
+const DefaultFaultStreamBytes = 64 << 10
+
+// DefaultFaultRulesFile 故障注入规则默认持久化文件
+func DefaultFaultRulesFile() string {
+	return filepath.Join(DefaultRulesDir(), "fault_rules.json")
+}
+
+var (
+	ErrFaultRuleNotFound = errors.New("fault rule not found")
+	errFaultReset        = errors.New("connection reset by fault injection")
+)
+
+// FaultRule 故障注入规则
+type FaultRule struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Enabled      bool    `json:"enabled"`
+	Fault        string  `json:"fault"`                   // status/hang/reset/truncate/corrupt
+	Probability  float64 `json:"probability"`             // 触发概率 (0,1]，0 视为 1
+	StatusCode   int     `json:"status_code,omitempty"`   // status：默认 503
+	RetryAfter   int     `json:"retry_after,omitempty"`   // status：Retry-After 秒数
+	HangMs       int     `json:"hang_ms,omitempty"`       // hang：挂起时长，默认 2 分钟，之后返回 504
+	AfterBytes   int     `json:"after_bytes,omitempty"`   // reset/truncate：保留的字节数，默认为消息体的一半
+	CorruptBytes int     `json:"corrupt_bytes,omitempty"` // corrupt：篡改的字节数，默认 8
+	FlowMatcher
+}
+
+// FaultManager 管理故障注入规则
+type FaultManager struct {
+	mu    sync.RWMutex
+	rules []*FaultRule
+	path  string
+}
+
+// NewFaultManager 创建故障注入管理器，path 非空时从文件加载规则并在修改后自动保存
+func NewFaultManager(path string) (*FaultManager, error) {
+	m := &FaultManager{rules: make([]*FaultRule, 0), path: path}
+	var rules []*FaultRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return m, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	m.rules = append(m.rules, rules...)
+	return m, nil
+}
+
+// Rules 返回全部规则
+func (m *FaultManager) Rules() []*FaultRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*FaultRule, len(m.rules))
+	copy(result, m.rules)
+	return result
+}
+
+// AddRule 添加规则
+func (m *FaultManager) AddRule(rule *FaultRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则
+func (m *FaultManager) UpdateRule(id string, rule *FaultRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*FaultRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrFaultRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *FaultManager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrFaultRuleNotFound
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (m *FaultManager) setRulesLocked(rules []*FaultRule) error {
+	if err := saveJSONFile(m.path, rules); err != nil {
+		return err
+	}
+	m.rules = rules
+	return nil
+}
+
+// Pick 按顺序检查命中的规则并按概率决定是否注入，返回要注入的规则
+func (m *FaultManager) Pick(req *http.Request) *FaultRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if !r.Enabled || !r.MatchRequest(req) {
+			continue
+		}
+		if r.Probability >= 1 || rand.Float64() < r.Probability {
+			return r
+		}
+	}
+	return nil
+}
+
+func (r *FaultRule) compile() error {
+	switch r.Fault {
+	case FaultStatus:
+		if r.StatusCode == 0 {
+			r.StatusCode = http.StatusServiceUnavailable
+		}
+		if r.StatusCode < 400 || r.StatusCode > 599 {
+			return errors.New("status fault requires a 4xx/5xx status code")
+		}
+	case FaultHang, FaultReset, FaultTruncate, FaultCorrupt:
+	default:
+		return errors.New("invalid fault: " + r.Fault)
+	}
+	if r.Probability == 0 {
+		r.Probability = 1
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return errors.New("probability must be in (0,1]")
+	}
+	if r.RetryAfter < 0 || r.HangMs < 0 || r.AfterBytes < 0 || r.CorruptBytes < 0 {
+		return errors.New("fault parameters must not be negative")
+	}
+	return r.Compile()
+}
+
+// IsRequestFault 是否在请求阶段直接应答，不访问上游
+func (r *FaultRule) IsRequestFault() bool {
+	return r.Fault == FaultStatus || r.Fault == FaultHang
+}
+
+// cutOffset 计算 reset/truncate 保留的字节数
+func (r *FaultRule) cutOffset(size int) int {
+	if r.AfterBytes > 0 {
+		if r.AfterBytes < size {
+			return r.AfterBytes
+		}
+		return size
+	}
+	return size / 2
+}
+
+// streamCutOffset 计算流式响应 reset/truncate 保留的字节数，长度未知时取 after_bytes 或 DefaultFaultStreamBytes
+func (r *FaultRule) streamCutOffset(length int64) int64 {
+	if length >= 0 {
+		return int64(r.cutOffset(int(length)))
+	}
+	if r.AfterBytes > 0 {
+		return int64(r.AfterBytes)
+	}
+	return DefaultFaultStreamBytes
+}
+
+// corrupt 随机翻转消息体中的若干字节，返回被篡改的字节数
+func (r *FaultRule) corrupt(body []byte) int {
+	if len(body) == 0 {
+		return 0
+	}
+	n := r.CorruptBytes
+	if n == 0 {
+		n = 8
+	}
+	if n > len(body) {
+		n = len(body)
+	}
+	for i := 0; i < n; i++ {
+		pos := rand.Intn(len(body))
+		body[pos] ^= byte(rand.Intn(255) + 1)
+	}
+	return n
+}
+
+// resetReader 读取指定字节后中断连接
+type resetReader struct {
+	r            io.ReadCloser
+	remaining    int
+	abortHandler bool
+}
+
+func (c *resetReader) Read(p []byte) (int, error) {
+	if c.remaining <= 0 {
+		c.r.Close()
+		return 0, abortClientStream(c.abortHandler, errFaultReset)
+	}
+	if len(p) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= n
+	if err == io.EOF {
+		return n, abortClientStream(c.abortHandler, errFaultReset)
+	}
+	return n, err
+}
+
+func (c *resetReader) Close() error {
+	return c.r.Close()
+}
+
+// corruptReader 转发消息体时翻转预先选定位置的字节
+type corruptReader struct {
+	r         io.ReadCloser
+	read      int64
+	positions map[int64]bool
+}
+
+// newCorruptReader 在消息体前 span 字节内随机选取 n 个位置
+func newCorruptReader(r io.ReadCloser, n int, span int64) *corruptReader {
+	c := &corruptReader{r: r, positions: make(map[int64]bool, n)}
+	for i := 0; i < n && span > 0; i++ {
+		c.positions[rand.Int63n(span)] = true
+	}
+	return c
+}
+
+func (c *corruptReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	for i := 0; i < n; i++ {
+		if c.positions[c.read+int64(i)] {
+			p[i] ^= byte(rand.Intn(255) + 1)
+		}
+	}
+	c.read += int64(n)
+	return n, err
+}
+
+func (c *corruptReader) Close() error {
+	return c.r.Close()
+}
+
+// abortClientStream 中断正在写给客户端的响应。运行在 net/http 处理函数中时通过
+// http.ErrAbortHandler 让服务器直接关闭连接；MITM 隧道中返回错误，goproxy 会关闭隧道
+func abortClientStream(abortHandler bool, err error) error {
+	if abortHandler {
+		panic(http.ErrAbortHandler)
+	}
+	return err
+}
+
+// recordFault 在 Flow 的 ErrorInfo 中记录注入的故障
+func (p *EnhancedProxyServer) recordFault(flow *models.Flow, rule *FaultRule, msg string, code int) {
+	info := &models.ErrorInfo{
+		Type:      FaultErrorType,
+		Message:   fmt.Sprintf("fault %s injected by rule %s: %s", rule.Fault, rule.ID, msg),
+		Code:      code,
+		IsTimeout: rule.Fault == FaultHang,
+		IsNetwork: rule.Fault == FaultReset || rule.Fault == FaultTruncate,
+	}
+	flow.Error = info
+	p.errorCollector.RecordError(flow.ID, info.Type, info.Message, code, info.IsTimeout, 0)
+}
+
+// injectRequestFault 请求阶段的故障：返回错误响应或挂起后超时
+func (p *EnhancedProxyServer) injectRequestFault(flow *models.Flow, rule *FaultRule, req *http.Request) *http.Response {
+	switch rule.Fault {
+	case FaultStatus:
+		header := http.Header{"Content-Type": {"text/plain; charset=utf-8"}}
+		if rule.RetryAfter > 0 {
+			header.Set("Retry-After", strconv.Itoa(rule.RetryAfter))
+		}
+		p.recordFault(flow, rule, fmt.Sprintf("status %d", rule.StatusCode), rule.StatusCode)
+		return newSyntheticResponse(req, rule.StatusCode, header, []byte(http.StatusText(rule.StatusCode)))
+	case FaultHang:
+		hang := time.Duration(rule.HangMs) * time.Millisecond
+		if hang <= 0 {
+			hang = DefaultFaultHang
+		}
+		start := time.Now()
+		t := time.NewTimer(hang)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+		}
+		p.recordFault(flow, rule, fmt.Sprintf("hung for %dms", time.Since(start).Milliseconds()), http.StatusGatewayTimeout)
+		return newSyntheticResponse(req, http.StatusGatewayTimeout, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(http.StatusText(http.StatusGatewayTimeout)))
+	}
+	return nil
+}
+
+// injectResponseFault 响应阶段的故障：截断或篡改消息体，返回客户端将收到的消息体
+func (p *EnhancedProxyServer) injectResponseFault(flow *models.Flow, rule *FaultRule, resp *http.Response, body []byte) []byte {
+	switch rule.Fault {
+	case FaultTruncate:
+		cut := rule.cutOffset(len(body))
+		p.recordFault(flow, rule, fmt.Sprintf("truncated body from %d to %d bytes", len(body), cut), resp.StatusCode)
+		body = body[:cut]
+	case FaultCorrupt:
+		body = append([]byte(nil), body...)
+		n := rule.corrupt(body)
+		p.recordFault(flow, rule, fmt.Sprintf("corrupted %d bytes", n), resp.StatusCode)
+	case FaultReset:
+		p.recordFault(flow, rule, fmt.Sprintf("reset after %d of %d bytes", rule.cutOffset(len(body)), len(body)), resp.StatusCode)
+		return body
+	default:
+		return body
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return body
+}
+
+// injectStreamFault 流式响应的故障：截断与篡改在捕获之前作用于消息体，Flow 记录的是客户端收到的内容；
+// reset 只记录，由调用方在捕获之后以 streamResetReader 包装
+func (p *EnhancedProxyServer) injectStreamFault(flow *models.Flow, rule *FaultRule, resp *http.Response) {
+	switch rule.Fault {
+	case FaultTruncate:
+		cut := rule.streamCutOffset(resp.ContentLength)
+		p.recordFault(flow, rule, fmt.Sprintf("truncated streamed body after %d bytes", cut), resp.StatusCode)
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, cut), resp.Body}
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	case FaultCorrupt:
+		n := rule.CorruptBytes
+		if n == 0 {
+			n = 8
+		}
+		span := resp.ContentLength
+		if span < 0 {
+			span = DefaultFaultStreamBytes
+		}
+		p.recordFault(flow, rule, fmt.Sprintf("corrupting up to %d bytes within the first %d bytes of the stream", n, span), resp.StatusCode)
+		resp.Body = newCorruptReader(resp.Body, n, span)
+	case FaultReset:
+		p.recordFault(flow, rule, fmt.Sprintf("reset streamed body after %d bytes", rule.streamCutOffset(resp.ContentLength)), resp.StatusCode)
+	}
+}
+
+// streamResetReader 返回在 reset 位置中断流式响应的读取器
+func streamResetReader(rule *FaultRule, resp *http.Response, abortHandler bool) io.ReadCloser {
+	return &resetReader{r: resp.Body, remaining: int(rule.streamCutOffset(resp.ContentLength)), abortHandler: abortHandler}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestFaultRuleCompile 测试规则默认值与校验
+func TestFaultRuleCompile(t *testing.T) {
+	r := &FaultRule{Fault: FaultStatus}
+	if err := r.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if r.StatusCode != 503 || r.Probability != 1 {
+		t.Fatalf("defaults not applied: %+v", r)
+	}
+	for _, bad := range []*FaultRule{
+		{Fault: "explode"},
+		{Fault: FaultStatus, StatusCode: 200},
+		{Fault: FaultReset, Probability: 1.5},
+		{Fault: FaultTruncate, AfterBytes: -1},
+	} {
+		if err := bad.compile(); err == nil {
+			t.Fatalf("rule %+v should be rejected", bad)
+		}
+	}
+}
+
+// TestFaultPickProbability 测试触发概率
+func TestFaultPickProbability(t *testing.T) {
+	m, _ := NewFaultManager("")
+	if err := m.AddRule(&FaultRule{Enabled: true, Fault: FaultHang, Probability: 0.3, FlowMatcher: FlowMatcher{Host: "api.example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "https://api.example.com/", nil)
+	hits := 0
+	for i := 0; i < 2000; i++ {
+		if m.Pick(req) != nil {
+			hits++
+		}
+	}
+	if hits < 450 || hits > 750 {
+		t.Fatalf("hits = %d, want about 600", hits)
+	}
+	if m.Pick(httptest.NewRequest("GET", "https://other.example.com/", nil)) != nil {
+		t.Fatal("other host should not match")
+	}
+}
+
+// TestFaultBodyHelpers 测试截断位置、篡改与中途断开
+func TestFaultBodyHelpers(t *testing.T) {
+	r := &FaultRule{Fault: FaultTruncate}
+	if got := r.cutOffset(100); got != 50 {
+		t.Fatalf("cut = %d", got)
+	}
+	r.AfterBytes = 500
+	if got := r.cutOffset(100); got != 100 {
+		t.Fatalf("cut = %d", got)
+	}
+
+	body := bytes.Repeat([]byte("a"), 64)
+	orig := append([]byte(nil), body...)
+	if n := (&FaultRule{CorruptBytes: 4}).corrupt(body); n != 4 || bytes.Equal(body, orig) {
+		t.Fatalf("corrupt n=%d changed=%v", n, !bytes.Equal(body, orig))
+	}
+
+	rr := &resetReader{r: io.NopCloser(bytes.NewReader(orig)), remaining: 10}
+	got, err := io.ReadAll(rr)
+	if len(got) != 10 || !errors.Is(err, errFaultReset) {
+		t.Fatalf("read %d bytes, err %v", len(got), err)
+	}
+}
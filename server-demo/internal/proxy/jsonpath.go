@@ -0,0 +1,302 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonObject 保留键顺序的JSON对象，改写后按原顺序输出
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]interface{})}
+}
+
+func (o *jsonObject) get(key string) (interface{}, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// set 设置字段，新键追加到末尾，已有键保持原位置
+func (o *jsonObject) set(key string, v interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *jsonObject) delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// decodeJSON 按 token 解码JSON文档：对象解码为 *jsonObject 以保留键顺序，
+// 数字保留为 json.Number 以免超过 2^53 的整数丢失精度
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after json value")
+	}
+	return v, nil
+}
+
+func decodeJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		obj := newJSONObject()
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, ok := tok.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected object key %v", tok)
+			}
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.set(key, v)
+		}
+		_, err = dec.Token()
+		return obj, err
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			v, err := decodeJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err = dec.Token()
+		return arr, err
+	}
+	return nil, fmt.Errorf("unexpected delimiter %v", delim)
+}
+
+// encodeJSON 编码 decodeJSON 得到的文档，不转义 <>& 等 HTML 字符
+func encodeJSON(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeJSONValue(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeJSONValue(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case *jsonObject:
+		buf.WriteByte('{')
+		for i, k := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSONValue(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeJSONValue(buf, v.values[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSONValue(buf, e); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		enc := json.NewEncoder(buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		// Encode 会追加换行
+		buf.Truncate(buf.Len() - 1)
+	}
+	return nil
+}
+
+// jsonPathToken JSONPath 中的一段：对象键或数组下标
+type jsonPathToken struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath 解析简化的 JSONPath，支持 $.a.b、$.a[0].b、$['a.b'] 形式
+func parseJSONPath(path string) ([]jsonPathToken, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.New("jsonpath must start with $")
+	}
+	rest := path[1:]
+	tokens := make([]jsonPathToken, 0)
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in jsonpath %q", path)
+			}
+			tokens = append(tokens, jsonPathToken{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed bracket in jsonpath %q", path)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				tokens = append(tokens, jsonPathToken{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			idx, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("invalid index %q in jsonpath", inner)
+			}
+			tokens = append(tokens, jsonPathToken{index: idx, isIndex: true})
+		default:
+			return nil, fmt.Errorf("unexpected %q in jsonpath %q", rest[0], path)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("jsonpath must reference a field")
+	}
+	return tokens, nil
+}
+
+// jsonPathSet 在 decodeJSON 解码的文档中设置值，缺失的中间对象会自动创建；
+// 负下标从数组末尾计数，下标等于数组长度时追加元素
+func jsonPathSet(doc interface{}, tokens []jsonPathToken, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	tok := tokens[0]
+	if tok.isIndex {
+		arr, ok := doc.([]interface{})
+		if !ok {
+			if doc != nil {
+				return nil, fmt.Errorf("cannot index non-array with [%d]", tok.index)
+			}
+			arr = []interface{}{}
+		}
+		idx := tok.index
+		if idx < 0 {
+			idx += len(arr)
+		}
+		switch {
+		case idx >= 0 && idx < len(arr):
+			v, err := jsonPathSet(arr[idx], tokens[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			arr[idx] = v
+		case idx == len(arr):
+			v, err := jsonPathSet(nil, tokens[1:], value)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		default:
+			return nil, fmt.Errorf("index %d out of range", tok.index)
+		}
+		return arr, nil
+	}
+
+	obj, ok := doc.(*jsonObject)
+	if !ok {
+		if doc != nil {
+			return nil, fmt.Errorf("cannot set key %q on non-object", tok.key)
+		}
+		obj = newJSONObject()
+	}
+	child, _ := obj.get(tok.key)
+	v, err := jsonPathSet(child, tokens[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	obj.set(tok.key, v)
+	return obj, nil
+}
+
+// jsonPathDelete 删除JSON文档中的字段或数组元素，路径不存在时不做处理
+func jsonPathDelete(doc interface{}, tokens []jsonPathToken) interface{} {
+	if len(tokens) == 0 {
+		return doc
+	}
+	tok := tokens[0]
+	last := len(tokens) == 1
+	if tok.isIndex {
+		arr, ok := doc.([]interface{})
+		if !ok {
+			return doc
+		}
+		idx := tok.index
+		if idx < 0 {
+			idx += len(arr)
+		}
+		if idx < 0 || idx >= len(arr) {
+			return doc
+		}
+		if last {
+			return append(arr[:idx], arr[idx+1:]...)
+		}
+		arr[idx] = jsonPathDelete(arr[idx], tokens[1:])
+		return arr
+	}
+	obj, ok := doc.(*jsonObject)
+	if !ok {
+		return doc
+	}
+	if last {
+		obj.delete(tok.key)
+		return obj
+	}
+	if child, exists := obj.get(tok.key); exists {
+		obj.set(tok.key, jsonPathDelete(child, tokens[1:]))
+	}
+	return obj
+}
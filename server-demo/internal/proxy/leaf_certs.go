@@ -0,0 +1,304 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+// 叶子证书私钥算法
+const (
+	LeafKeyECDSA = "ecdsa" // ECDSA P-256，生成与握手都远快于 RSA
+	LeafKeyRSA   = "rsa"   // RSA 2048，兼容不支持 ECDSA 的旧客户端
+)
+
+// LeafCertConfig 叶子证书的签发与缓存参数，零值字段使用默认值
+type LeafCertConfig struct {
+	KeyType     string        // ecdsa（默认）或 rsa
+	Validity    time.Duration // 证书有效期，默认 24h
+	RenewBefore time.Duration // 距过期不足该时长时重新签发，默认 1h
+	CacheSize   int           // 缓存的主机数，默认 1024
+	PoolSize    int           // 预生成的私钥数，默认 8，负数表示不预生成
+	NoUpstream  bool          // 不读取上游证书，只按主机名签发
+}
+
+// Validate 校验私钥算法
+func (c LeafCertConfig) Validate() error {
+	switch c.KeyType {
+	case "", LeafKeyECDSA, LeafKeyRSA:
+		return nil
+	}
+	return errors.New("unsupported leaf key type: " + c.KeyType)
+}
+
+func (c LeafCertConfig) withDefaults() LeafCertConfig {
+	if c.KeyType == "" {
+		c.KeyType = LeafKeyECDSA
+	}
+	if c.Validity <= 0 {
+		c.Validity = 24 * time.Hour
+	}
+	if c.RenewBefore <= 0 {
+		c.RenewBefore = time.Hour
+	}
+	if c.RenewBefore >= c.Validity {
+		c.RenewBefore = c.Validity / 2
+	}
+	if c.CacheSize <= 0 {
+		c.CacheSize = 1024
+	}
+	if c.PoolSize == 0 {
+		c.PoolSize = 8
+	}
+	return c
+}
+
+// LeafCertStats 叶子证书缓存统计
+type LeafCertStats struct {
+	KeyType    string `json:"key_type"`
+	Cached     int    `json:"cached"`      // 缓存中的主机数
+	Hits       uint64 `json:"hits"`        // 命中缓存的次数
+	Misses     uint64 `json:"misses"`      // 未命中或已临近过期的次数
+	Shared     uint64 `json:"shared"`      // 并发请求复用同一次签发的次数
+	Signed     uint64 `json:"signed"`      // 实际签发的证书数
+	Mimicked   uint64 `json:"mimicked"`    // 其中复制了上游证书的数量
+	PooledKeys int    `json:"pooled_keys"` // 池中可用的私钥数
+}
+
+// UpstreamCertFunc 获取 addr（host:port）上游服务器出示的叶子证书，dialAddr 非空时连接该地址
+type UpstreamCertFunc func(addr, dialAddr string) (*x509.Certificate, error)
+
+// LeafCertCache 按主机缓存 MITM 叶子证书：LRU 淘汰，临近过期时重新签发，
+// 并发请求同一主机时只签发一次，私钥由后台预先生成
+type LeafCertCache struct {
+	caCert   *x509.Certificate
+	caKey    crypto.Signer
+	cfg      LeafCertConfig
+	upstream UpstreamCertFunc
+
+	certs   *lru.Cache[string, *tls.Certificate]
+	failed  *lru.Cache[string, time.Time] // 上游证书获取失败的地址与失败时间
+	failTTL time.Duration
+	group   singleflight.Group
+	keys    chan crypto.Signer
+	filling atomic.Bool
+
+	hits, misses, shared, signed, mimicked atomic.Uint64
+}
+
+// NewLeafCertCache 创建叶子证书缓存并开始预生成私钥
+func NewLeafCertCache(caCert *x509.Certificate, caKey crypto.Signer, cfg LeafCertConfig) *LeafCertCache {
+	cfg = cfg.withDefaults()
+	certs, _ := lru.New[string, *tls.Certificate](cfg.CacheSize)
+	failed, _ := lru.New[string, time.Time](cfg.CacheSize)
+	c := &LeafCertCache{
+		caCert:  caCert,
+		caKey:   caKey,
+		cfg:     cfg,
+		certs:   certs,
+		failed:  failed,
+		failTTL: upstreamRetryAfter,
+		keys:    make(chan crypto.Signer, max(cfg.PoolSize, 0)),
+	}
+	c.refill()
+	return c
+}
+
+// SetUpstreamCert 设置上游证书的获取方式，之后 GetUpstream 签发的证书复制上游证书的主题、SAN 与有效期。
+// 需在开始签发前设置
+func (c *LeafCertCache) SetUpstreamCert(f UpstreamCertFunc) {
+	c.upstream = f
+}
+
+// Get 返回 host 的叶子证书
+func (c *LeafCertCache) Get(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(host)
+	return c.get(host, func() (*tls.Certificate, error) {
+		return c.sign(host, nil)
+	})
+}
+
+// upstreamRetryAfter 上游证书获取失败后，在此期间内直接按主机名签发，避免每次握手都等待获取超时
+const upstreamRetryAfter = 30 * time.Second
+
+// GetUpstream 返回仿照 addr（host:port）上游证书签发的叶子证书，按地址缓存。
+// 未设置上游证书获取方式或获取失败时退回 Get(host)，失败后 upstreamRetryAfter 内不再重新获取
+func (c *LeafCertCache) GetUpstream(addr string) (*tls.Certificate, error) {
+	return c.GetUpstreamVia(addr, "")
+}
+
+// GetUpstreamVia 与 GetUpstream 相同，但连接 dialAddr（透明代理的原始目标）获取上游证书，
+// addr 仍用作 SNI、证书主机名与缓存键
+func (c *LeafCertCache) GetUpstreamVia(addr, dialAddr string) (*tls.Certificate, error) {
+	addr = strings.ToLower(addr)
+	host := stripHostPort(addr)
+	if c.upstream == nil {
+		return c.Get(host)
+	}
+	if at, ok := c.failed.Get(addr); ok && time.Since(at) < c.failTTL {
+		return c.Get(host)
+	}
+	cert, err := c.get(addr, func() (*tls.Certificate, error) {
+		upstream, err := c.upstream(addr, dialAddr)
+		if err != nil {
+			return nil, err
+		}
+		return c.sign(host, upstream)
+	})
+	if err != nil {
+		c.failed.Add(addr, time.Now())
+		return c.Get(host)
+	}
+	c.failed.Remove(addr)
+	return cert, nil
+}
+
+// get 返回 key 对应的缓存证书，不存在或临近过期时调用 sign 签发，签发失败不缓存
+func (c *LeafCertCache) get(key string, sign func() (*tls.Certificate, error)) (*tls.Certificate, error) {
+	if cert, ok := c.certs.Get(key); ok && c.fresh(cert) {
+		c.hits.Add(1)
+		return cert, nil
+	}
+	c.misses.Add(1)
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		// 排队期间其他调用可能已签发完成
+		if cert, ok := c.certs.Get(key); ok && c.fresh(cert) {
+			return cert, nil
+		}
+		cert, err := sign()
+		if err != nil {
+			return nil, err
+		}
+		c.certs.Add(key, cert)
+		return cert, nil
+	})
+	if shared {
+		c.shared.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*tls.Certificate), nil
+}
+
+// Stats 返回缓存统计
+func (c *LeafCertCache) Stats() *LeafCertStats {
+	return &LeafCertStats{
+		KeyType:    c.cfg.KeyType,
+		Cached:     c.certs.Len(),
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Shared:     c.shared.Load(),
+		Signed:     c.signed.Load(),
+		Mimicked:   c.mimicked.Load(),
+		PooledKeys: len(c.keys),
+	}
+}
+
+func (c *LeafCertCache) fresh(cert *tls.Certificate) bool {
+	return time.Now().Add(c.cfg.RenewBefore).Before(cert.Leaf.NotAfter)
+}
+
+// sign 为 host 签发证书，upstream 不为空时复制其主题、SAN 与有效期
+func (c *LeafCertCache) sign(host string, upstream *x509.Certificate) (*tls.Certificate, error) {
+	key, err := c.takeKey()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := newLeafTemplate(host, key, c.cfg.Validity)
+	if upstream != nil {
+		mimicUpstream(tmpl, host, upstream, c.cfg.RenewBefore)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, c.caCert, key.Public(), c.caKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	c.signed.Add(1)
+	if upstream != nil {
+		c.mimicked.Add(1)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// maxMimicValidity Apple 平台对 TLS 服务器证书（包括用户安装的根证书签发的）要求的最长有效期
+const maxMimicValidity = 825 * 24 * time.Hour
+
+// mimicUpstream 用上游证书的主题与 SAN（DNS、IP、邮箱、URI）替换模板中的默认值，SAN 未覆盖 host 时补充 host。
+// 上游证书有效时沿用其有效期；已过期、尚未生效、即将过期或有效期超过 maxMimicValidity 时保留默认有效期
+func mimicUpstream(tmpl *x509.Certificate, host string, upstream *x509.Certificate, renewBefore time.Duration) {
+	tmpl.Subject = upstream.Subject
+	tmpl.RawSubject = upstream.RawSubject
+	tmpl.DNSNames = append([]string(nil), upstream.DNSNames...)
+	tmpl.IPAddresses = append([]net.IP(nil), upstream.IPAddresses...)
+	tmpl.EmailAddresses = append([]string(nil), upstream.EmailAddresses...)
+	tmpl.URIs = append([]*url.URL(nil), upstream.URIs...)
+	// 只有 CN 的旧证书：客户端已不再认可 CN，改为写入 SAN
+	if len(tmpl.DNSNames) == 0 && len(tmpl.IPAddresses) == 0 && upstream.Subject.CommonName != "" {
+		addSAN(tmpl, upstream.Subject.CommonName)
+	}
+	if (&x509.Certificate{DNSNames: tmpl.DNSNames, IPAddresses: tmpl.IPAddresses}).VerifyHostname(host) != nil {
+		addSAN(tmpl, host)
+	}
+
+	now := time.Now()
+	if upstream.NotBefore.Before(now) && now.Add(renewBefore).Before(upstream.NotAfter) &&
+		upstream.NotAfter.Sub(upstream.NotBefore) <= maxMimicValidity {
+		tmpl.NotBefore, tmpl.NotAfter = upstream.NotBefore, upstream.NotAfter
+	}
+}
+
+// takeKey 优先使用池中预生成的私钥，池空时当场生成，取用后在后台补充
+func (c *LeafCertCache) takeKey() (crypto.Signer, error) {
+	defer c.refill()
+	select {
+	case key := <-c.keys:
+		return key, nil
+	default:
+		return generateLeafKey(c.cfg.KeyType)
+	}
+}
+
+// refill 在后台补满私钥池，同一时间只有一个补充协程
+func (c *LeafCertCache) refill() {
+	if cap(c.keys) == 0 || !c.filling.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.filling.Store(false)
+		for len(c.keys) < cap(c.keys) {
+			key, err := generateLeafKey(c.cfg.KeyType)
+			if err != nil {
+				return
+			}
+			select {
+			case c.keys <- key:
+			default:
+				return
+			}
+		}
+	}()
+}
+
+func generateLeafKey(keyType string) (crypto.Signer, error) {
+	if keyType == LeafKeyRSA {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
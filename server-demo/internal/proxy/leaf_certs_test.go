@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestCA 生成仅用于测试的根证书
+func newTestCA(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+// TestLeafCertCache 测试 ECDSA 签发、并发去重、临近过期重签、LRU 淘汰与 RSA 选项
+func TestLeafCertCache(t *testing.T) {
+	caCert, caKey := newTestCA(t)
+	c := NewLeafCertCache(caCert, caKey, LeafCertConfig{CacheSize: 2})
+
+	var wg sync.WaitGroup
+	certs := make(chan interface{}, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cert, err := c.Get("Example.com")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			certs <- cert
+		}()
+	}
+	wg.Wait()
+	close(certs)
+	first := <-certs
+	for cert := range certs {
+		if cert != first {
+			t.Fatal("concurrent requests should share one certificate")
+		}
+	}
+	if st := c.Stats(); st.Signed != 1 || st.KeyType != LeafKeyECDSA {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+
+	cert, _ := c.Get("example.com")
+	if _, ok := cert.PrivateKey.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("expected ECDSA leaf key, got %T", cert.PrivateKey)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 临近过期时重新签发
+	cert.Leaf.NotAfter = time.Now()
+	if renewed, _ := c.Get("example.com"); renewed == cert || c.Stats().Signed != 2 {
+		t.Fatal("expiring certificate should be re-signed")
+	}
+
+	c.Get("a.test")
+	c.Get("b.test")
+	if st := c.Stats(); st.Cached != 2 || st.Hits == 0 {
+		t.Fatalf("unexpected stats after eviction: %+v", st)
+	}
+
+	r := NewLeafCertCache(caCert, caKey, LeafCertConfig{KeyType: LeafKeyRSA, PoolSize: -1})
+	if cert, err := r.Get("rsa.test"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := cert.PrivateKey.(*rsa.PrivateKey); !ok {
+		t.Fatalf("expected RSA leaf key, got %T", cert.PrivateKey)
+	}
+	if err := (LeafCertConfig{KeyType: "dsa"}).Validate(); err == nil {
+		t.Fatal("unsupported key type should be rejected")
+	}
+}
+
+// TestLeafCertUpstreamMimic 测试复制上游证书的主题、SAN 与有效期，IP 主机签发 IP SAN，以及获取失败时的回退
+func TestLeafCertUpstreamMimic(t *testing.T) {
+	caCert, caKey := newTestCA(t)
+	c := NewLeafCertCache(caCert, caKey, LeafCertConfig{PoolSize: -1})
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	// 未设置获取方式：按主机名签发，IP 写入 IP SAN
+	cert, err := c.GetUpstream("10.0.0.1:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Leaf.IPAddresses) != 1 || len(cert.Leaf.DNSNames) != 0 {
+		t.Fatalf("expected a single IP SAN, got %v %v", cert.Leaf.DNSNames, cert.Leaf.IPAddresses)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "10.0.0.1", Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	notAfter := time.Now().Add(90 * 24 * time.Hour).Truncate(time.Second)
+	upstream := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "*.example.com", Organization: []string{"Example Inc"}, Country: []string{"US"}},
+		DNSNames:    []string{"*.example.com", "example.com", "example.net"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.1")},
+		NotBefore:   notBefore,
+		NotAfter:    notAfter,
+	}
+	fetched := map[string]int{}
+	c.SetUpstreamCert(func(addr, _ string) (*x509.Certificate, error) {
+		fetched[addr]++
+		if addr == "down.test:443" {
+			return nil, errors.New("connection refused")
+		}
+		return upstream, nil
+	})
+
+	cert, _ = c.GetUpstream("WWW.example.com:443")
+	leaf := cert.Leaf
+	if leaf.Subject.String() != upstream.Subject.String() {
+		t.Fatalf("subject = %s", leaf.Subject)
+	}
+	if strings.Join(leaf.DNSNames, ",") != "*.example.com,example.com,example.net" || !leaf.IPAddresses[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("SANs not copied: %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+	if !leaf.NotBefore.Equal(notBefore) || !leaf.NotAfter.Equal(notAfter) {
+		t.Fatalf("validity not copied: %v - %v", leaf.NotBefore, leaf.NotAfter)
+	}
+	for _, name := range []string{"www.example.com", "example.net", "192.0.2.1"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if again, _ := c.GetUpstream("www.example.com:443"); again != cert || fetched["www.example.com:443"] != 1 {
+		t.Fatal("mimicked certificate should be cached per address")
+	}
+
+	// SAN 未覆盖连接的主机时补充该主机
+	cert, _ = c.GetUpstream("other.test:443")
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "other.test", Roots: roots}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上游已过期时保留默认有效期，避免反复签发
+	upstream.NotAfter = time.Now().Add(-time.Hour)
+	cert, _ = c.GetUpstream("expired.example.com:443")
+	if !cert.Leaf.NotAfter.After(time.Now()) {
+		t.Fatal("expired upstream validity should not be copied")
+	}
+
+	// 获取失败时按主机名签发，短时间内不再重新获取，过期后重试
+	cert, err = c.GetUpstream("down.test:443")
+	if err != nil || cert.Leaf.Subject.CommonName != "down.test" {
+		t.Fatalf("expected fallback certificate, got %v", err)
+	}
+	if again, _ := c.GetUpstream("down.test:443"); again != cert || fetched["down.test:443"] != 1 {
+		t.Fatalf("failed fetch should be remembered, got %d attempts", fetched["down.test:443"])
+	}
+	c.failTTL = 0
+	c.GetUpstream("down.test:443")
+	if fetched["down.test:443"] != 2 {
+		t.Fatalf("failed fetch should be retried after the retry delay, got %d attempts", fetched["down.test:443"])
+	}
+	if st := c.Stats(); st.Mimicked != 3 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// 本地拦截类型，记录在 Flow.Intercept 中
+const (
+	InterceptMapLocal = "map_local"
+)
+
+// DefaultMapLocalFile Map Local 规则默认持久化文件
+func DefaultMapLocalFile() string {
+	return filepath.Join(DefaultRulesDir(), "map_local.json")
+}
+
+var ErrMapLocalRuleNotFound = errors.New("map local rule not found")
+
+// MapLocalRule 将匹配的请求映射到本地文件或目录
+type MapLocalRule struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Enabled     bool              `json:"enabled"`
+	LocalPath   string            `json:"local_path"`             // 本地文件或目录
+	StripPrefix string            `json:"strip_prefix,omitempty"` // 映射到目录时从URL路径中去掉的前缀
+	StatusCode  int               `json:"status_code,omitempty"`  // 默认 200
+	ContentType string            `json:"content_type,omitempty"` // 为空时按扩展名或内容推测
+	Headers     map[string]string `json:"headers,omitempty"`      // 附加响应头
+	FlowMatcher
+}
+
+// MapLocalManager 管理 Map Local 规则
+type MapLocalManager struct {
+	mu    sync.RWMutex
+	rules []*MapLocalRule
+	path  string
+}
+
+// NewMapLocalManager 创建 Map Local 管理器，path 非空时从文件加载规则并在修改后自动保存
+func NewMapLocalManager(path string) (*MapLocalManager, error) {
+	m := &MapLocalManager{rules: make([]*MapLocalRule, 0), path: path}
+	var rules []*MapLocalRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return m, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	m.rules = append(m.rules, rules...)
+	return m, nil
+}
+
+// Rules 返回全部规则
+func (m *MapLocalManager) Rules() []*MapLocalRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*MapLocalRule, len(m.rules))
+	copy(result, m.rules)
+	return result
+}
+
+// AddRule 添加规则
+func (m *MapLocalManager) AddRule(rule *MapLocalRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则
+func (m *MapLocalManager) UpdateRule(id string, rule *MapLocalRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*MapLocalRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrMapLocalRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *MapLocalManager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrMapLocalRuleNotFound
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (m *MapLocalManager) setRulesLocked(rules []*MapLocalRule) error {
+	if err := saveJSONFile(m.path, rules); err != nil {
+		return err
+	}
+	m.rules = rules
+	return nil
+}
+
+// Match 返回第一条命中的规则
+func (m *MapLocalManager) Match(req *http.Request) *MapLocalRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.Enabled && r.MatchRequest(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (r *MapLocalRule) compile() error {
+	if r.LocalPath == "" {
+		return errors.New("local_path is required")
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 100 || r.StatusCode > 999) {
+		return errors.New("invalid status code")
+	}
+	return r.Compile()
+}
+
+// ResolveFile 计算请求对应的本地文件；规则指向目录时按URL路径查找，目录请求返回 index.html
+func (r *MapLocalRule) ResolveFile(urlPath string) (string, error) {
+	info, err := os.Stat(r.LocalPath)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return r.LocalPath, nil
+	}
+	rel := strings.TrimPrefix(urlPath, r.StripPrefix)
+	// 先按 URL 语义清理，防止 ../ 跳出映射目录
+	file := filepath.Join(r.LocalPath, filepath.FromSlash(cleanURLPath(rel)))
+	if fi, err := os.Stat(file); err == nil && fi.IsDir() {
+		file = filepath.Join(file, "index.html")
+	}
+	return file, nil
+}
+
+// cleanURLPath 以 / 为根清理路径，结果不会包含 ..
+func cleanURLPath(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return filepath.ToSlash(filepath.Clean(p))
+}
+
+// ServeLocal 读取本地文件并构造响应，文件不存在时返回 404 响应
+func (r *MapLocalRule) ServeLocal(req *http.Request) (*http.Response, string) {
+	file, err := r.ResolveFile(req.URL.Path)
+	var data []byte
+	if err == nil {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		msg := "Map Local: " + err.Error()
+		if errors.Is(err, os.ErrNotExist) {
+			return newSyntheticResponse(req, http.StatusNotFound, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(msg)), file
+		}
+		return newSyntheticResponse(req, http.StatusInternalServerError, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(msg)), file
+	}
+
+	header := make(http.Header)
+	for k, v := range r.Headers {
+		header.Set(k, v)
+	}
+	if header.Get("Content-Type") == "" {
+		ct := r.ContentType
+		if ct == "" {
+			ct = mime.TypeByExtension(filepath.Ext(file))
+		}
+		if ct == "" {
+			ct = http.DetectContentType(data)
+		}
+		header.Set("Content-Type", ct)
+	}
+	status := r.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return newSyntheticResponse(req, status, header, data), file
+}
+
+// newSyntheticResponse 构造不经过上游的本地响应
+func newSyntheticResponse(req *http.Request, status int, header http.Header, body []byte) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// serveMapLocal 命中 Map Local 规则时直接返回本地内容
+func (p *EnhancedProxyServer) serveMapLocal(flow *models.Flow, req *http.Request) *http.Response {
+	if p.mapLocal == nil {
+		return nil
+	}
+	rule := p.mapLocal.Match(req)
+	if rule == nil {
+		return nil
+	}
+	resp, file := rule.ServeLocal(req)
+	flow.Intercept = &models.InterceptInfo{
+		Type:   InterceptMapLocal,
+		RuleID: rule.ID,
+		Source: file,
+	}
+	return resp
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMapLocalDirectory 测试目录映射、Content-Type 推测与路径穿越防护
+func TestMapLocalDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "v1", "user.json"), []byte(`{"id":1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html></html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, _ := NewMapLocalManager("")
+	rule := &MapLocalRule{Enabled: true, LocalPath: dir, StripPrefix: "/api", FlowMatcher: FlowMatcher{Host: "api.example.com"}}
+	if err := m.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "https://api.example.com/api/v1/user.json", nil)
+	hit := m.Match(req)
+	if hit == nil {
+		t.Fatal("rule should match")
+	}
+	resp, file := hit.ServeLocal(req)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != `{"id":1}` {
+		t.Fatalf("status=%d body=%s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("content-type = %s", ct)
+	}
+	if file != filepath.Join(dir, "v1", "user.json") {
+		t.Fatalf("file = %s", file)
+	}
+
+	// 目录请求返回 index.html
+	resp, _ = hit.ServeLocal(httptest.NewRequest("GET", "https://api.example.com/api/", nil))
+	if resp.StatusCode != 200 {
+		t.Fatalf("index status = %d", resp.StatusCode)
+	}
+
+	// ../ 不能跳出映射目录
+	if f, _ := hit.ResolveFile("/api/../../etc/passwd"); f != filepath.Join(dir, "etc", "passwd") {
+		t.Fatalf("traversal resolved to %s", f)
+	}
+	resp, _ = hit.ServeLocal(httptest.NewRequest("GET", "https://api.example.com/api/missing.js", nil))
+	if resp.StatusCode != 404 {
+		t.Fatalf("missing status = %d", resp.StatusCode)
+	}
+
+	if m.Match(httptest.NewRequest("GET", "https://other.example.com/api/v1/user.json", nil)) != nil {
+		t.Fatal("other host should not match")
+	}
+}
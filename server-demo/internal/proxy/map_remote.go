@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// DefaultMapRemoteFile Map Remote 规则默认持久化文件
+func DefaultMapRemoteFile() string {
+	return filepath.Join(DefaultRulesDir(), "map_remote.json")
+}
+
+var ErrMapRemoteRuleNotFound = errors.New("map remote rule not found")
+
+// MapRemoteRule 将匹配的请求转发到其他上游，空字段表示保持原值
+type MapRemoteRule struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Enabled        bool   `json:"enabled"`
+	ToScheme       string `json:"to_scheme,omitempty"`        // http/https
+	ToHost         string `json:"to_host,omitempty"`          // 目标主机名，不含端口
+	ToPort         string `json:"to_port,omitempty"`          // 目标端口
+	FromPathPrefix string `json:"from_path_prefix,omitempty"` // 被替换的路径前缀
+	ToPathPrefix   string `json:"to_path_prefix,omitempty"`   // 替换后的路径前缀
+	PreserveHost   bool   `json:"preserve_host"`              // 保留原始 Host 请求头
+	FlowMatcher
+}
+
+// MapRemoteManager 管理 Map Remote 规则
+type MapRemoteManager struct {
+	mu    sync.RWMutex
+	rules []*MapRemoteRule
+	path  string
+}
+
+// NewMapRemoteManager 创建 Map Remote 管理器，path 非空时从文件加载规则并在修改后自动保存
+func NewMapRemoteManager(path string) (*MapRemoteManager, error) {
+	m := &MapRemoteManager{rules: make([]*MapRemoteRule, 0), path: path}
+	var rules []*MapRemoteRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return m, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	m.rules = append(m.rules, rules...)
+	return m, nil
+}
+
+// Rules 返回全部规则
+func (m *MapRemoteManager) Rules() []*MapRemoteRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*MapRemoteRule, len(m.rules))
+	copy(result, m.rules)
+	return result
+}
+
+// AddRule 添加规则
+func (m *MapRemoteManager) AddRule(rule *MapRemoteRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则
+func (m *MapRemoteManager) UpdateRule(id string, rule *MapRemoteRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*MapRemoteRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrMapRemoteRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *MapRemoteManager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrMapRemoteRuleNotFound
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (m *MapRemoteManager) setRulesLocked(rules []*MapRemoteRule) error {
+	if err := saveJSONFile(m.path, rules); err != nil {
+		return err
+	}
+	m.rules = rules
+	return nil
+}
+
+// Match 返回第一条命中的规则
+func (m *MapRemoteManager) Match(req *http.Request) *MapRemoteRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.Enabled && r.MatchRequest(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (r *MapRemoteRule) compile() error {
+	r.ToScheme = strings.ToLower(r.ToScheme)
+	switch r.ToScheme {
+	case "", "http", "https":
+	default:
+		return errors.New("invalid scheme: " + r.ToScheme)
+	}
+	if strings.Contains(r.ToHost, ":") && !strings.HasPrefix(r.ToHost, "[") {
+		return errors.New("to_host must not contain a port, use to_port")
+	}
+	if r.ToScheme == "" && r.ToHost == "" && r.ToPort == "" && r.FromPathPrefix == "" && r.ToPathPrefix == "" {
+		return errors.New("rule does not change the destination")
+	}
+	if r.ToPathPrefix != "" && r.FromPathPrefix == "" {
+		r.FromPathPrefix = "/"
+	}
+	return r.Compile()
+}
+
+// Apply 将请求改写到新的上游，返回改写后的 URL
+func (r *MapRemoteRule) Apply(req *http.Request) string {
+	u := req.URL
+	if r.ToScheme != "" {
+		// 切换协议时去掉与原协议对应的默认端口
+		if u.Port() == defaultPort(u.Scheme) && r.ToScheme != u.Scheme {
+			u.Host = u.Hostname()
+			if strings.Contains(u.Host, ":") {
+				u.Host = "[" + u.Host + "]"
+			}
+		}
+		u.Scheme = r.ToScheme
+	}
+	if r.ToHost != "" || r.ToPort != "" {
+		host, port := u.Hostname(), u.Port()
+		if r.ToHost != "" {
+			host = strings.Trim(r.ToHost, "[]")
+		}
+		if r.ToPort != "" {
+			port = r.ToPort
+		}
+		if port == "" || port == defaultPort(u.Scheme) {
+			u.Host = host
+			if strings.Contains(host, ":") {
+				u.Host = "[" + host + "]"
+			}
+		} else {
+			u.Host = net.JoinHostPort(host, port)
+		}
+	}
+	if r.FromPathPrefix != "" && strings.HasPrefix(u.Path, r.FromPathPrefix) {
+		u.Path = r.ToPathPrefix + strings.TrimPrefix(u.Path, r.FromPathPrefix)
+		if !strings.HasPrefix(u.Path, "/") {
+			u.Path = "/" + u.Path
+		}
+		u.RawPath = ""
+	}
+	if !r.PreserveHost {
+		req.Host = u.Host
+	}
+	return u.String()
+}
+
+func defaultPort(scheme string) string {
+	switch scheme {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// applyMapRemote 命中 Map Remote 规则时改写请求目标，并在 Flow 上记录原始与改写后的 URL
+func (p *EnhancedProxyServer) applyMapRemote(flow *models.Flow, req *http.Request) {
+	if p.mapRemote == nil {
+		return
+	}
+	rule := p.mapRemote.Match(req)
+	if rule == nil {
+		return
+	}
+	original := req.URL.String()
+	mapped := rule.Apply(req)
+	flow.MapRemote = &models.MapRemoteInfo{
+		RuleID:      rule.ID,
+		OriginalURL: original,
+		MappedURL:   mapped,
+	}
+	body := flow.Request.Body
+	flow.Request = p.buildHTTPRequest(req)
+	flow.Request.Body = body
+	flow.Scheme = req.URL.Scheme
+}
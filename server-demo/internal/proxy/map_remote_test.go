@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestMapRemoteApply 测试协议、主机、端口与路径前缀改写
+func TestMapRemoteApply(t *testing.T) {
+	cases := []struct {
+		name     string
+		rule     MapRemoteRule
+		url      string
+		wantURL  string
+		wantHost string
+	}{
+		{
+			name:     "to localhost",
+			rule:     MapRemoteRule{ToScheme: "http", ToHost: "localhost", ToPort: "3000"},
+			url:      "https://api.example.com/v1/users?id=1",
+			wantURL:  "http://localhost:3000/v1/users?id=1",
+			wantHost: "localhost:3000",
+		},
+		{
+			name:     "preserve host",
+			rule:     MapRemoteRule{ToHost: "staging.example.com", PreserveHost: true},
+			url:      "https://api.example.com/v1/users",
+			wantURL:  "https://staging.example.com/v1/users",
+			wantHost: "api.example.com",
+		},
+		{
+			name:     "path prefix",
+			rule:     MapRemoteRule{FromPathPrefix: "/v1/", ToPathPrefix: "/api/v2/"},
+			url:      "http://api.example.com:8080/v1/users",
+			wantURL:  "http://api.example.com:8080/api/v2/users",
+			wantHost: "api.example.com:8080",
+		},
+		{
+			name:     "default port dropped",
+			rule:     MapRemoteRule{ToScheme: "https", ToPort: "443"},
+			url:      "http://api.example.com/",
+			wantURL:  "https://api.example.com/",
+			wantHost: "api.example.com",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule := tc.rule
+			rule.Enabled = true
+			if err := rule.compile(); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("GET", tc.url, nil)
+			if got := rule.Apply(req); got != tc.wantURL {
+				t.Fatalf("url = %s, want %s", got, tc.wantURL)
+			}
+			if req.Host != tc.wantHost {
+				t.Fatalf("host = %s, want %s", req.Host, tc.wantHost)
+			}
+		})
+	}
+}
+
+// TestMapRemoteRuleValidation 测试非法规则被拒绝
+func TestMapRemoteRuleValidation(t *testing.T) {
+	m, _ := NewMapRemoteManager("")
+	for _, r := range []*MapRemoteRule{
+		{ToScheme: "ftp", ToHost: "a"},
+		{ToHost: "a:80"},
+		{},
+	} {
+		if err := m.AddRule(r); err == nil {
+			t.Fatalf("rule %+v should be rejected", r)
+		}
+	}
+}
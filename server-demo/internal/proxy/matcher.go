@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// FlowMatcher 代理规则通用的匹配条件，空字段表示不限制
+type FlowMatcher struct {
+	Host   string `json:"host"`   // 主机名通配符，如 *.example.com
+	Path   string `json:"path"`   // 路径正则表达式
+	Method string `json:"method"` // HTTP方法，多个用逗号分隔
+
+	hostRe *regexp.Regexp
+	pathRe *regexp.Regexp
+}
+
+// Compile 预编译匹配条件，规则添加或加载后必须调用
+func (m *FlowMatcher) Compile() error {
+	m.hostRe, m.pathRe = nil, nil
+	if m.Host != "" {
+		re, err := globToRegexp(m.Host)
+		if err != nil {
+			return err
+		}
+		m.hostRe = re
+	}
+	if m.Path != "" {
+		re, err := regexp.Compile(m.Path)
+		if err != nil {
+			return errors.New("invalid path pattern: " + err.Error())
+		}
+		m.pathRe = re
+	}
+	return nil
+}
+
+// MatchRequest 判断请求是否满足匹配条件
+func (m *FlowMatcher) MatchRequest(req *http.Request) bool {
+	if req == nil || req.URL == nil {
+		return false
+	}
+	host := req.URL.Host
+	if host == "" {
+		host = req.Host
+	}
+	return m.Match(req.Method, host, req.URL.Path)
+}
+
+// Match 根据方法、主机与路径判断是否匹配
+func (m *FlowMatcher) Match(method, host, path string) bool {
+	if m.Method != "" && !matchMethod(m.Method, method) {
+		return false
+	}
+	if m.hostRe != nil && !m.hostRe.MatchString(stripHostPort(host)) {
+		return false
+	}
+	if m.pathRe != nil && !m.pathRe.MatchString(path) {
+		return false
+	}
+	return true
+}
+
+// matchMethod 支持 "GET,POST" 形式的方法列表，* 表示任意方法
+func matchMethod(pattern, method string) bool {
+	for _, p := range strings.Split(pattern, ",") {
+		p = strings.TrimSpace(p)
+		if p == "*" || strings.EqualFold(p, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp 将主机名通配符转换为不区分大小写的正则，* 匹配任意字符，? 匹配单个字符
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("(?i)^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// stripHostPort 去掉 host 中的端口，兼容 IPv6 字面量
+func stripHostPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return strings.Trim(host, "[]")
+}
+
+// withDefaultPort 为不含端口的 host 补上 port
+func withDefaultPort(host, port string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// TestFlowMatcher 测试主机通配符、方法列表、路径正则以及端口与 IPv6 字面量的处理
+func TestFlowMatcher(t *testing.T) {
+	cases := []struct {
+		name    string
+		matcher FlowMatcher
+		method  string
+		host    string
+		path    string
+		want    bool
+	}{
+		{"empty matches all", FlowMatcher{}, "GET", "example.com", "/", true},
+		{"wildcard subdomain", FlowMatcher{Host: "*.example.com"}, "GET", "api.example.com:8443", "/", true},
+		{"wildcard needs subdomain", FlowMatcher{Host: "*.example.com"}, "GET", "example.com", "/", false},
+		{"host case insensitive", FlowMatcher{Host: "API.example.com"}, "GET", "api.EXAMPLE.com", "/", true},
+		{"single char", FlowMatcher{Host: "api?.example.com"}, "GET", "api2.example.com", "/", true},
+		{"dot is literal", FlowMatcher{Host: "a.b"}, "GET", "axb", "/", false},
+		{"ipv6 literal", FlowMatcher{Host: "::1"}, "GET", "[::1]:8080", "/", true},
+		{"method list", FlowMatcher{Method: "GET, post"}, "POST", "example.com", "/", true},
+		{"method mismatch", FlowMatcher{Method: "GET,POST"}, "DELETE", "example.com", "/", false},
+		{"method any", FlowMatcher{Method: "*"}, "PATCH", "example.com", "/", true},
+		{"path regexp", FlowMatcher{Path: `^/api/v\d+/`}, "GET", "example.com", "/api/v2/users", true},
+		{"path mismatch", FlowMatcher{Path: `^/api/`}, "GET", "example.com", "/static/app.js", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := tc.matcher
+			if err := m.Compile(); err != nil {
+				t.Fatal(err)
+			}
+			if got := m.Match(tc.method, tc.host, tc.path); got != tc.want {
+				t.Fatalf("Match(%s, %s, %s) = %v, want %v", tc.method, tc.host, tc.path, got, tc.want)
+			}
+		})
+	}
+
+	m := FlowMatcher{Path: "("}
+	if err := m.Compile(); err == nil {
+		t.Fatal("invalid path pattern should be rejected")
+	}
+
+	m = FlowMatcher{Host: "example.com", Path: "^/login$"}
+	m.Compile()
+	if !m.MatchRequest(httptest.NewRequest("POST", "http://example.com:8080/login", nil)) {
+		t.Fatal("MatchRequest should use URL host and path")
+	}
+	if m.MatchRequest(nil) {
+		t.Fatal("nil request should not match")
+	}
+
+	if got := withDefaultPort("example.com", "443"); got != "example.com:443" {
+		t.Fatalf("withDefaultPort = %s", got)
+	}
+	if got := withDefaultPort("[::1]", "443"); got != "[::1]:443" {
+		t.Fatalf("withDefaultPort = %s", got)
+	}
+	if got := withDefaultPort("example.com:8443", "443"); got != "example.com:8443" {
+		t.Fatalf("withDefaultPort = %s", got)
+	}
+}
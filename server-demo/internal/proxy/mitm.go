@@ -6,7 +6,6 @@ import (
 	"io"
 	"net"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
@@ -86,10 +85,6 @@ func (p *ProxyServer) Start() error {
 		if flowID == "" {
 			return resp
 		}
-		flow := p.store.GetByID(flowID)
-		if flow == nil {
-			return resp
-		}
 		// 读取响应体
 		var body []byte
 		if resp != nil && resp.Body != nil {
@@ -98,10 +93,9 @@ func (p *ProxyServer) Start() error {
 			resp.Body = io.NopCloser(bytes.NewReader(body))
 		}
 		end := time.Now()
-		flow.EndAt = end
-		flow.LatencyMs = end.Sub(flow.StartAt).Milliseconds()
+		var response *models.HTTPResponse
 		if resp != nil {
-			flow.Response = &models.HTTPResponse{
+			response = &models.HTTPResponse{
 				Status:     resp.Status,
 				StatusCode: resp.StatusCode,
 				Headers:    models.CopyHeaders(resp.Header),
@@ -110,6 +104,13 @@ func (p *ProxyServer) Start() error {
 				Length:     int(resp.ContentLength),
 			}
 		}
+		p.store.Update(flowID, func(flow *models.Flow) {
+			flow.EndAt = end
+			flow.LatencyMs = end.Sub(flow.StartAt).Milliseconds()
+			if response != nil {
+				flow.Response = response
+			}
+		})
 		return resp
 	})
 
@@ -124,22 +125,16 @@ func (p *ProxyServer) Start() error {
 		if err != nil {
 			return err
 		}
-		// 为每个 host 动态签发含 SAN 的证书
+		// 为每个 host 签发含 SAN 的证书，按主机缓存
+		leafCerts := NewLeafCertCache(caCert, caKey, LeafCertConfig{})
 		tlsConfigForHost := func(host string, _ *goproxy.ProxyCtx) (*tls.Config, error) {
 			// 剥离端口，获取纯主机名
-			h := host
-			if i := strings.IndexByte(h, ':'); i >= 0 {
-				h = h[:i]
-			}
-			leafCertPEM, leafKeyPEM, err := SignHostCert(caCert, caKey, h, 24*time.Hour)
-			if err != nil {
-				return nil, err
-			}
-			pair, err := tls.X509KeyPair(leafCertPEM, leafKeyPEM)
+			h := stripHostPort(host)
+			cert, err := leafCerts.Get(h)
 			if err != nil {
 				return nil, err
 			}
-			return &tls.Config{Certificates: []tls.Certificate{pair}, MinVersion: tls.VersionTLS12, ServerName: h}, nil
+			return &tls.Config{Certificates: []tls.Certificate{*cert}, MinVersion: tls.VersionTLS12, ServerName: h}, nil
 		}
 		gp.Tr = &http.Transport{
 			TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
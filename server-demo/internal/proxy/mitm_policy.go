@@ -0,0 +1,340 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// CONNECT 隧道的处理方式
+const (
+	TunnelMitm        = "mitm"        // 解密并捕获隧道内的请求
+	TunnelPassthrough = "passthrough" // 不解密，原样转发
+	TunnelReject      = "reject"      // 拒绝建立隧道
+)
+
+// DefaultMITMPolicyFile MITM 策略默认持久化文件
+func DefaultMITMPolicyFile() string {
+	return filepath.Join(DefaultRulesDir(), "mitm_policy.json")
+}
+
+var ErrMITMRuleNotFound = errors.New("mitm rule not found")
+
+// MITMRule 按主机决定 CONNECT 隧道的处理方式
+type MITMRule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Host     string `json:"host"`     // 主机名通配符
+	Action   string `json:"action"`   // mitm/passthrough/reject
+	Auto     bool   `json:"auto"`     // 检测到证书固定后自动添加
+	Insecure bool   `json:"insecure"` // 解密时不校验上游证书（自签名、过期等），Flow 的 TLS 信息中标记
+
+	matcher FlowMatcher
+}
+
+func validTunnelAction(action string) bool {
+	return action == TunnelMitm || action == TunnelPassthrough || action == TunnelReject
+}
+
+func (r *MITMRule) compile() error {
+	if r.Host == "" {
+		return errors.New("host is required")
+	}
+	if !validTunnelAction(r.Action) {
+		return errors.New("invalid action: " + r.Action)
+	}
+	r.matcher = FlowMatcher{Host: r.Host}
+	return r.matcher.Compile()
+}
+
+// mitmPolicyConfig 持久化的 MITM 策略
+type mitmPolicyConfig struct {
+	DefaultAction   string                `json:"default_action"`
+	AutoPassthrough AutoPassthroughConfig `json:"auto_passthrough"`
+	Rules           []*MITMRule           `json:"rules"`
+}
+
+// MITMPolicy 管理 CONNECT 隧道的处理策略，规则按顺序匹配，未命中时使用默认处理方式
+type MITMPolicy struct {
+	mu            sync.RWMutex
+	defaultAction string
+	rules         []*MITMRule
+	path          string
+	auto          AutoPassthroughConfig
+	failures      map[string]*HandshakeFailure // 按主机统计的客户端握手失败
+}
+
+// NewMITMPolicy 创建 MITM 策略，path 非空时从文件加载并在修改后自动保存
+func NewMITMPolicy(path string) (*MITMPolicy, error) {
+	m := &MITMPolicy{defaultAction: TunnelMitm, rules: make([]*MITMRule, 0), path: path, failures: make(map[string]*HandshakeFailure)}
+	m.auto.normalize()
+	var cfg mitmPolicyConfig
+	if err := loadJSONFile(path, &cfg); err != nil {
+		return m, err
+	}
+	for _, r := range cfg.Rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	if cfg.DefaultAction != "" {
+		if !validTunnelAction(cfg.DefaultAction) {
+			return m, errors.New("invalid default action: " + cfg.DefaultAction)
+		}
+		m.defaultAction = cfg.DefaultAction
+	}
+	if err := cfg.AutoPassthrough.normalize(); err != nil {
+		return m, err
+	}
+	m.auto = cfg.AutoPassthrough
+	m.rules = append(m.rules, cfg.Rules...)
+	return m, nil
+}
+
+// DefaultAction 返回默认处理方式
+func (m *MITMPolicy) DefaultAction() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.defaultAction
+}
+
+// SetDefaultAction 设置未命中规则时的处理方式
+func (m *MITMPolicy) SetDefaultAction(action string) error {
+	if !validTunnelAction(action) {
+		return errors.New("invalid action: " + action)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := saveJSONFile(m.path, mitmPolicyConfig{DefaultAction: action, AutoPassthrough: m.auto, Rules: m.rules}); err != nil {
+		return err
+	}
+	m.defaultAction = action
+	return nil
+}
+
+// Rules 返回全部规则
+func (m *MITMPolicy) Rules() []*MITMRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*MITMRule, len(m.rules))
+	copy(result, m.rules)
+	return result
+}
+
+// AddRule 添加规则
+func (m *MITMPolicy) AddRule(rule *MITMRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则
+func (m *MITMPolicy) UpdateRule(id string, rule *MITMRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*MITMRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrMITMRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *MITMPolicy) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrMITMRuleNotFound
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (m *MITMPolicy) setRulesLocked(rules []*MITMRule) error {
+	if err := saveJSONFile(m.path, mitmPolicyConfig{DefaultAction: m.defaultAction, AutoPassthrough: m.auto, Rules: rules}); err != nil {
+		return err
+	}
+	m.rules = rules
+	return nil
+}
+
+// Decide 返回主机对应的处理方式及命中的规则ID，未命中规则时规则ID为空
+func (m *MITMPolicy) Decide(host string) (string, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.decideLocked(host)
+}
+
+func (m *MITMPolicy) decideLocked(host string) (string, string) {
+	for _, r := range m.rules {
+		if r.Enabled && r.matcher.Match("", host, "") {
+			return r.Action, r.ID
+		}
+	}
+	return m.defaultAction, ""
+}
+
+// InsecureUpstream 报告主机命中的规则是否允许不安全的上游证书
+func (m *MITMPolicy) InsecureUpstream(host string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.Enabled && r.matcher.Match("", host, "") {
+			return r.Insecure
+		}
+	}
+	return false
+}
+
+// decideTunnel 决定 CONNECT 隧道的处理方式，未开启 HTTPS 解密时 TLS 隧道的 mitm 退化为透传
+func (p *EnhancedProxyServer) decideTunnel(host string, plainHTTP bool) (string, string) {
+	action, ruleID := TunnelMitm, ""
+	if p.mitmPolicy != nil {
+		action, ruleID = p.mitmPolicy.Decide(host)
+	}
+	if action == TunnelMitm && !p.https && !plainHTTP {
+		action = TunnelPassthrough
+	}
+	return action, ruleID
+}
+
+// newTunnelFlow 为未解密的 CONNECT 隧道创建 Flow
+func (p *EnhancedProxyServer) newTunnelFlow(req *http.Request, host, action, ruleID string) *models.Flow {
+	scheme := "https"
+	switch tunnelModeOf(req) {
+	case tunnelModeRaw:
+		scheme = "tcp"
+	case TunnelUDP:
+		scheme = "udp"
+	}
+	flow := &models.Flow{
+		ID:         uuid.NewString(),
+		Scheme:     scheme,
+		RemoteAddr: req.RemoteAddr,
+		StartAt:    time.Now(),
+		Request: &models.HTTPRequest{
+			Method:  http.MethodConnect,
+			URL:     host,
+			Host:    host,
+			Headers: models.CopyHeaders(req.Header),
+			Proto:   req.Proto,
+		},
+		Network: p.buildNetworkInfo(req),
+		Tunnel:  &models.TunnelInfo{Mode: action, RuleID: ruleID},
+	}
+	if p.upstream != nil {
+		flow.Upstream = p.upstreamRoute(host)
+	}
+	p.store.Add(flow)
+	return flow
+}
+
+// finishTunnelFlow 隧道结束时记录时长与流量。flow 已保存到存储，通过 Update 写入结果
+func (p *EnhancedProxyServer) finishTunnelFlow(flow *models.Flow, sent, received int64, err error) {
+	end := time.Now()
+	latency := end.Sub(flow.StartAt).Milliseconds()
+	tunnel := *flow.Tunnel
+	tunnel.BytesSent, tunnel.BytesReceived, tunnel.DurationMs = sent, received, latency
+	var errInfo *models.ErrorInfo
+	if err != nil {
+		errInfo = sendErrorInfo(err)
+		p.errorCollector.RecordError(flow.ID, errInfo.Type, errInfo.Message, 0, errInfo.IsTimeout, 0)
+		p.errorCollector.Cleanup(flow.ID)
+	}
+	p.store.Update(flow.ID, func(f *models.Flow) {
+		f.EndAt, f.LatencyMs, f.Tunnel = end, latency, &tunnel
+		if errInfo != nil {
+			f.Error = errInfo
+		}
+	})
+	p.networkMonitor.RecordRequest(stripHostPort(flow.Request.Host), err == nil, latency, received)
+}
+
+type tunnelFlowKey struct{}
+
+// dialTunnel 作为 goproxy 的 ConnectDialWithReq，按上游路由建立连接并为透传隧道统计流量
+func (p *EnhancedProxyServer) dialTunnel(req *http.Request, network, addr string, envDial func(network, addr string) (net.Conn, error)) (net.Conn, error) {
+	conn, err := p.dialUpstream(req.Context(), network, addr, envDial)
+	flow, _ := req.Context().Value(tunnelFlowKey{}).(*models.Flow)
+	if flow == nil {
+		return conn, err
+	}
+	if err != nil {
+		p.finishTunnelFlow(flow, 0, 0, err)
+		return nil, err
+	}
+	conn = p.throttleTunnel(flow, req, conn)
+	return &countingConn{Conn: conn, onClose: func(sent, received int64) {
+		p.finishTunnelFlow(flow, sent, received, nil)
+	}}, nil
+}
+
+// throttleTunnel 按网络条件对透传隧道的上游连接限速，并记录在 Flow 上
+func (p *EnhancedProxyServer) throttleTunnel(flow *models.Flow, req *http.Request, conn net.Conn) net.Conn {
+	if p.throttle == nil {
+		return conn
+	}
+	profile, source := p.throttle.Select(stripHostPort(flow.Request.Host), clientIPOf(req))
+	if profile == nil {
+		return conn
+	}
+	info := &models.ThrottleInfo{Profile: profile.Name, Source: source}
+	p.store.Update(flow.ID, func(f *models.Flow) { f.Throttle = info })
+	return p.throttle.WrapConn(conn, profile, source, clientIPOf(req))
+}
+
+// withTunnelFlow 将隧道 Flow 关联到 CONNECT 请求，供 dialTunnel 使用
+func withTunnelFlow(req *http.Request, flow *models.Flow) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), tunnelFlowKey{}, flow))
+}
+
+// countingConn 统计上游连接收发的字节数，关闭时回调一次
+type countingConn struct {
+	net.Conn
+	sent, received atomic.Int64
+	once           sync.Once
+	onClose        func(sent, received int64)
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.received.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.sent.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { c.onClose(c.sent.Load(), c.received.Load()) })
+	return err
+}
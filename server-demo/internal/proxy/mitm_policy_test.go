@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"probe/pkg/storage"
+)
+
+// newTestProxy 创建根证书位于临时目录的代理，测试不会在源码树中生成 CA 私钥
+func newTestProxy(t *testing.T, addr string, https bool, store storage.FlowStorage) *EnhancedProxyServer {
+	t.Helper()
+	p := NewEnhancedProxyServer(addr, https, store)
+	p.SetCAManager(NewCAManager(t.TempDir()))
+	return p
+}
+
+// TestMITMPolicyDecide 测试规则顺序、默认处理方式与持久化
+func TestMITMPolicyDecide(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mitm.json")
+	m, err := NewMITMPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*MITMRule{
+		{Enabled: true, Host: "api.bank.com", Action: TunnelReject},
+		{Enabled: true, Host: "*.bank.com", Action: TunnelPassthrough},
+		{Enabled: false, Host: "*.example.com", Action: TunnelReject},
+	} {
+		if err := m.AddRule(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.AddRule(&MITMRule{Host: "x.com", Action: "tunnel"}); err == nil {
+		t.Fatal("invalid action should be rejected")
+	}
+
+	cases := map[string]string{
+		"api.bank.com":    TunnelReject,
+		"www.bank.com":    TunnelPassthrough,
+		"www.example.com": TunnelMitm,
+	}
+	for host, want := range cases {
+		if got, _ := m.Decide(host); got != want {
+			t.Fatalf("%s: got %s, want %s", host, got, want)
+		}
+	}
+
+	if err := m.SetDefaultAction(TunnelPassthrough); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewMITMPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, id := reloaded.Decide("other.com"); got != TunnelPassthrough || id != "" {
+		t.Fatalf("default not persisted: %s %s", got, id)
+	}
+	if len(reloaded.Rules()) != 3 {
+		t.Fatalf("rules not persisted: %d", len(reloaded.Rules()))
+	}
+
+	// 未开启 HTTPS 解密时 mitm 退化为透传
+	p := newTestProxy(t, "", false, storage.NewMemoryFlowStore())
+	p.SetMITMPolicy(m)
+	if got, _ := p.decideTunnel("api.bank.com", false); got != TunnelReject {
+		t.Fatalf("reject should still apply, got %s", got)
+	}
+	m.SetDefaultAction(TunnelMitm)
+	if got, _ := p.decideTunnel("www.example.com", false); got != TunnelPassthrough {
+		t.Fatalf("mitm without https should pass through, got %s", got)
+	}
+}
+
+// TestTunnelFlowCounting 测试透传隧道记录流量与时长
+func TestTunnelFlowCounting(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 5)
+		io.ReadFull(c, buf)
+		c.Write([]byte("world!"))
+		c.Close()
+	}()
+
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "", false, store)
+	req := httptest.NewRequest("CONNECT", "http://"+ln.Addr().String(), nil)
+	flow := p.newTunnelFlow(req, ln.Addr().String(), TunnelPassthrough, "r1")
+
+	conn, err := p.dialTunnel(withTunnelFlow(req, flow), "tcp", ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello"))
+	io.ReadAll(conn)
+	conn.Close()
+	conn.Close()
+
+	got := store.GetByID(flow.ID)
+	if got == nil || got.Tunnel == nil {
+		t.Fatal("tunnel flow not stored")
+	}
+	if got.Tunnel.BytesSent != 5 || got.Tunnel.BytesReceived != 6 || got.EndAt.IsZero() {
+		t.Fatalf("unexpected tunnel info: %+v", got.Tunnel)
+	}
+
+	// 连接失败记录为错误
+	ln.Close()
+	flow = p.newTunnelFlow(req, ln.Addr().String(), TunnelPassthrough, "")
+	if _, err := p.dialTunnel(withTunnelFlow(req, flow), "tcp", ln.Addr().String(), nil); err == nil {
+		t.Fatal("dial to closed listener should fail")
+	}
+	if got := store.GetByID(flow.ID); got == nil || got.Error == nil {
+		t.Fatal("dial error not recorded")
+	}
+}
@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/elazarl/goproxy"
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// Mock 规则动作
+const (
+	MockActionMock  = "mock"  // 返回模拟响应
+	MockActionBlock = "block" // 阻断请求
+)
+
+// 阻断方式
+const (
+	BlockModeForbidden = "forbidden" // 返回 403（或自定义状态码）
+	BlockModeDrop      = "drop"      // 直接断开连接
+)
+
+// 本地拦截类型
+const (
+	InterceptMock      = "mock"
+	InterceptBlock     = "block"
+	InterceptBlockDrop = "block_drop"
+)
+
+// DefaultMockRulesFile Mock/阻断规则默认持久化文件
+func DefaultMockRulesFile() string {
+	return filepath.Join(DefaultRulesDir(), "mock_rules.json")
+}
+
+var (
+	ErrMockRuleNotFound = errors.New("mock rule not found")
+	errConnDropped      = errors.New("connection dropped by block rule")
+)
+
+// MockRule 模拟响应或阻断规则
+type MockRule struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Enabled    bool              `json:"enabled"`
+	Action     string            `json:"action"`               // mock/block
+	BlockMode  string            `json:"block_mode,omitempty"` // forbidden/drop，仅 block
+	StatusCode int               `json:"status_code,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"` // text/template 模板，可引用 {{.Method}} {{.Path}} {{.Query "id"}} 等
+	DelayMs    int               `json:"delay_ms,omitempty"`
+	Hits       uint64            `json:"hits"` // 命中次数，仅在快照中填充
+	FlowMatcher
+
+	bodyTmpl *template.Template
+	hits     *atomic.Uint64
+}
+
+// MockTemplateData 响应模板可用的请求变量
+type MockTemplateData struct {
+	FlowID   string
+	Method   string
+	URL      string
+	Scheme   string
+	Host     string
+	Path     string
+	RawQuery string
+	Body     string
+	Now      time.Time
+
+	req *http.Request
+}
+
+// Query 返回查询参数
+func (d *MockTemplateData) Query(name string) string {
+	return d.req.URL.Query().Get(name)
+}
+
+// Header 返回请求头
+func (d *MockTemplateData) Header(name string) string {
+	return d.req.Header.Get(name)
+}
+
+// MockManager 管理 Mock 与阻断规则
+type MockManager struct {
+	mu    sync.RWMutex
+	rules []*MockRule
+	path  string
+}
+
+// NewMockManager 创建 Mock 管理器，path 非空时从文件加载规则并在修改后自动保存
+func NewMockManager(path string) (*MockManager, error) {
+	m := &MockManager{rules: make([]*MockRule, 0), path: path}
+	var rules []*MockRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return m, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		r.hits = new(atomic.Uint64)
+		r.hits.Store(r.Hits)
+	}
+	m.rules = append(m.rules, rules...)
+	return m, nil
+}
+
+// Rules 返回全部规则的快照（含命中次数）
+func (m *MockManager) Rules() []MockRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return snapshotMockRules(m.rules)
+}
+
+// AddRule 添加规则
+func (m *MockManager) AddRule(rule *MockRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	rule.hits = new(atomic.Uint64)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则，保留命中次数
+func (m *MockManager) UpdateRule(id string, rule *MockRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rule.hits = r.hits
+			rules := append([]*MockRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrMockRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *MockManager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrMockRuleNotFound
+}
+
+// ResetHits 清零命中次数，id 为空时清零全部规则
+func (m *MockManager) ResetHits(id string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if id == "" || r.ID == id {
+			r.hits.Store(0)
+			if id != "" {
+				return nil
+			}
+		}
+	}
+	if id != "" {
+		return ErrMockRuleNotFound
+	}
+	return nil
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (m *MockManager) setRulesLocked(rules []*MockRule) error {
+	if err := saveJSONFile(m.path, snapshotMockRules(rules)); err != nil {
+		return err
+	}
+	m.rules = rules
+	return nil
+}
+
+// snapshotMockRules 复制规则并带上当前命中次数
+func snapshotMockRules(rules []*MockRule) []MockRule {
+	result := make([]MockRule, 0, len(rules))
+	for _, r := range rules {
+		c := *r
+		c.Hits = r.hits.Load()
+		result = append(result, c)
+	}
+	return result
+}
+
+// Match 返回第一条命中的规则并累加命中次数
+func (m *MockManager) Match(req *http.Request) *MockRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.Enabled && r.MatchRequest(req) {
+			r.hits.Add(1)
+			return r
+		}
+	}
+	return nil
+}
+
+func (r *MockRule) compile() error {
+	switch r.Action {
+	case "":
+		r.Action = MockActionMock
+	case MockActionMock, MockActionBlock:
+	default:
+		return errors.New("invalid action: " + r.Action)
+	}
+	if r.Action == MockActionBlock {
+		switch r.BlockMode {
+		case "":
+			r.BlockMode = BlockModeForbidden
+		case BlockModeForbidden, BlockModeDrop:
+		default:
+			return errors.New("invalid block mode: " + r.BlockMode)
+		}
+	}
+	if r.StatusCode != 0 && (r.StatusCode < 100 || r.StatusCode > 999) {
+		return errors.New("invalid status code")
+	}
+	if r.DelayMs < 0 {
+		return errors.New("delay_ms must not be negative")
+	}
+	r.bodyTmpl = nil
+	if r.Body != "" {
+		tmpl, err := template.New(r.ID).Option("missingkey=zero").Parse(r.Body)
+		if err != nil {
+			return errors.New("invalid body template: " + err.Error())
+		}
+		r.bodyTmpl = tmpl
+	}
+	return r.Compile()
+}
+
+// Respond 按规则构造模拟响应。drop 模式不产生响应，返回 errConnDropped，
+// 由代理在写出任何字节前断开连接
+func (r *MockRule) Respond(flowID string, req *http.Request, reqBody []byte) (*http.Response, error) {
+	if r.Action == MockActionBlock && r.BlockMode == BlockModeDrop {
+		return nil, errConnDropped
+	}
+
+	status := r.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+		if r.Action == MockActionBlock {
+			status = http.StatusForbidden
+		}
+	}
+	header := make(http.Header)
+	for k, v := range r.Headers {
+		header.Set(k, v)
+	}
+
+	var body []byte
+	if r.bodyTmpl != nil {
+		var buf bytes.Buffer
+		data := &MockTemplateData{
+			FlowID:   flowID,
+			Method:   req.Method,
+			URL:      req.URL.String(),
+			Scheme:   req.URL.Scheme,
+			Host:     req.URL.Host,
+			Path:     req.URL.Path,
+			RawQuery: req.URL.RawQuery,
+			Body:     string(reqBody),
+			Now:      time.Now(),
+			req:      req,
+		}
+		if err := r.bodyTmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	} else if r.Action == MockActionBlock {
+		body = []byte("Blocked by CetiProbe")
+	}
+	if header.Get("Content-Type") == "" && len(body) > 0 {
+		header.Set("Content-Type", http.DetectContentType(body))
+	}
+	return newSyntheticResponse(req, status, header, body), nil
+}
+
+// serveMock 命中 Mock 或阻断规则时直接返回合成的响应。drop 模式返回 nil 并在 Flow 上
+// 标记 InterceptBlockDrop，调用方需改用 dropRoundTripper 断开连接
+func (p *EnhancedProxyServer) serveMock(flow *models.Flow, req *http.Request, reqBody []byte) *http.Response {
+	if p.mocks == nil {
+		return nil
+	}
+	rule := p.mocks.Match(req)
+	if rule == nil {
+		return nil
+	}
+
+	if rule.DelayMs > 0 {
+		t := time.NewTimer(time.Duration(rule.DelayMs) * time.Millisecond)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+		}
+	}
+
+	info := &models.InterceptInfo{Type: InterceptMock, RuleID: rule.ID}
+	if rule.Action == MockActionBlock {
+		info.Type = InterceptBlock
+		if rule.BlockMode == BlockModeDrop {
+			info.Type = InterceptBlockDrop
+			flow.Error = &models.ErrorInfo{Type: "blocked", Message: errConnDropped.Error(), IsNetwork: true}
+		}
+	}
+	flow.Intercept = info
+	if info.Type == InterceptBlockDrop {
+		return nil
+	}
+
+	resp, err := rule.Respond(flow.ID, req, reqBody)
+	if err != nil {
+		p.errorCollector.RecordError(flow.ID, "mock", err.Error(), 0, false, 0)
+		return goproxy.NewResponse(req, goproxy.ContentTypeText, http.StatusInternalServerError, "Mock template error: "+err.Error())
+	}
+	return resp
+}
+
+// dropRoundTripper 代替上游请求直接失败：MITM 隧道中 goproxy 随即关闭连接，
+// 普通 HTTP 请求由 OnResponse 通过 abortClientStream 中断，客户端不会收到任何响应字节
+func (p *EnhancedProxyServer) dropRoundTripper(flow *models.Flow) goproxy.RoundTripper {
+	return goproxy.RoundTripperFunc(func(*http.Request, *goproxy.ProxyCtx) (*http.Response, error) {
+		flow.EndAt = time.Now()
+		flow.LatencyMs = flow.EndAt.Sub(flow.StartAt).Milliseconds()
+		p.CleanupFlow(flow.ID)
+		p.publishFlow(flow)
+		return nil, errConnDropped
+	})
+}
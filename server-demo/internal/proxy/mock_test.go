@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// TestMockRespondTemplate 测试模板变量、状态码与命中计数
+func TestMockRespondTemplate(t *testing.T) {
+	m, _ := NewMockManager("")
+	err := m.AddRule(&MockRule{
+		Enabled:     true,
+		StatusCode:  201,
+		Headers:     map[string]string{"Content-Type": "application/json"},
+		Body:        `{"order":"{{.Query "id"}}","method":"{{.Method}}","ua":"{{.Header "User-Agent"}}"}`,
+		FlowMatcher: FlowMatcher{Host: "pay.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "https://pay.example.com/charge?id=42", nil)
+	req.Header.Set("User-Agent", "qa")
+	rule := m.Match(req)
+	if rule == nil {
+		t.Fatal("rule should match")
+	}
+	resp, err := rule.Respond("f1", req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 201 || string(body) != `{"order":"42","method":"POST","ua":"qa"}` {
+		t.Fatalf("status=%d body=%s", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Length") != "40" {
+		t.Fatalf("content-length = %s", resp.Header.Get("Content-Length"))
+	}
+
+	m.Match(req)
+	if hits := m.Rules()[0].Hits; hits != 2 {
+		t.Fatalf("hits = %d", hits)
+	}
+	if err := m.ResetHits(rule.ID); err != nil || m.Rules()[0].Hits != 0 {
+		t.Fatalf("reset failed: %v", err)
+	}
+}
+
+// TestBlockRule 测试阻断规则的 403 与断开连接模式
+func TestBlockRule(t *testing.T) {
+	forbid := &MockRule{Action: MockActionBlock}
+	if err := forbid.compile(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "http://analytics.example.com/collect", nil)
+	resp, _ := forbid.Respond("f1", req, nil)
+	if resp.StatusCode != 403 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	drop := &MockRule{Action: MockActionBlock, BlockMode: BlockModeDrop}
+	if err := drop.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := drop.Respond("f2", req, nil); resp != nil || err != errConnDropped {
+		t.Fatalf("drop should not produce a response, got %v %v", resp, err)
+	}
+
+	if err := (&MockRule{Action: "redirect"}).compile(); err == nil {
+		t.Fatal("invalid action should be rejected")
+	}
+	if err := (&MockRule{Body: "{{.Missing"}).compile(); err == nil {
+		t.Fatal("invalid template should be rejected")
+	}
+}
+
+// TestBlockDropConnection 测试 drop 模式经代理时客户端收不到任何响应字节，上游也不会被访问
+func TestBlockDropConnection(t *testing.T) {
+	hit := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer upstream.Close()
+
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "127.0.0.1:0", false, store)
+	m, _ := NewMockManager("")
+	if err := m.AddRule(&MockRule{Enabled: true, Action: MockActionBlock, BlockMode: BlockModeDrop}); err != nil {
+		t.Fatal(err)
+	}
+	p.SetMockManager(m)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	conn, err := net.Dial("tcp", p.srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET "+upstream.URL+"/ HTTP/1.1\r\nHost: "+upstream.Listener.Addr().String()+"\r\n\r\n")
+	if got, err := io.ReadAll(conn); len(got) != 0 || err != nil {
+		t.Fatalf("client should see a closed connection, got %q (%v)", got, err)
+	}
+	if hit {
+		t.Fatal("dropped request should not reach upstream")
+	}
+	flow := waitFlow(t, store, func(f *models.Flow) bool { return f.Intercept != nil })
+	if flow.Intercept.Type != InterceptBlockDrop || flow.Error == nil || flow.Response != nil {
+		t.Fatalf("unexpected flow: %+v %+v", flow.Intercept, flow.Error)
+	}
+}
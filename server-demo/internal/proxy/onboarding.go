@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// 虚拟网卡（容器、虚拟机网桥）上的地址手机无法访问
+var virtualIfacePrefixes = []string{"docker", "veth", "br-", "virbr", "vmnet", "utun"}
+
+// LANAddresses 返回本机已启用网卡上的 IPv4 地址，私有网段在前，跳过回环、链路本地与虚拟网卡
+func LANAddresses() []string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var private, public []string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || isVirtualIface(iface.Name) {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipn, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipn.IP.To4()
+			if ip == nil || ip.IsLinkLocalUnicast() {
+				continue
+			}
+			if ip.IsPrivate() {
+				private = append(private, ip.String())
+			} else {
+				public = append(public, ip.String())
+			}
+		}
+	}
+	return append(private, public...)
+}
+
+func isVirtualIface(name string) bool {
+	for _, prefix := range virtualIfacePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// appleProfile 生成只包含根证书的配置描述文件。标识符固定，轮换后重新安装会替换旧描述文件；
+// UUID 由证书指纹派生，同一证书多次下载得到相同内容
+func appleProfile(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.Raw)
+	profileUUID := uuid.NewSHA1(uuid.NameSpaceOID, append([]byte("profile:"), sum[:]...))
+	payloadUUID := uuid.NewSHA1(uuid.NameSpaceOID, append([]byte("root:"), sum[:]...))
+	name := cert.Subject.CommonName
+	if name == "" {
+		name = "CetiProbe Root CA"
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>PayloadContent</key>
+	<array>
+		<dict>
+			<key>PayloadCertificateFileName</key>
+			<string>proxy_root_ca.cer</string>
+			<key>PayloadContent</key>
+			<data>%s</data>
+			<key>PayloadDescription</key>
+			<string>添加 CA 根证书</string>
+			<key>PayloadDisplayName</key>
+			<string>%s</string>
+			<key>PayloadIdentifier</key>
+			<string>com.cetiprobe.ca.root</string>
+			<key>PayloadType</key>
+			<string>com.apple.security.root</string>
+			<key>PayloadUUID</key>
+			<string>%s</string>
+			<key>PayloadVersion</key>
+			<integer>1</integer>
+		</dict>
+	</array>
+	<key>PayloadDescription</key>
+	<string>安装后需在 设置 → 通用 → 关于本机 → 证书信任设置 中启用完全信任</string>
+	<key>PayloadDisplayName</key>
+	<string>CetiProbe 代理根证书</string>
+	<key>PayloadIdentifier</key>
+	<string>com.cetiprobe.ca</string>
+	<key>PayloadRemovalDisallowed</key>
+	<false/>
+	<key>PayloadType</key>
+	<string>Configuration</string>
+	<key>PayloadUUID</key>
+	<string>%s</string>
+	<key>PayloadVersion</key>
+	<integer>1</integer>
+</dict>
+</plist>
+`, base64.StdEncoding.EncodeToString(cert.Raw), xmlEscape(name), strings.ToUpper(payloadUUID.String()), strings.ToUpper(profileUUID.String()))
+	return b.Bytes()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
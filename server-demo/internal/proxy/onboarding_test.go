@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+// TestAppleProfile 测试描述文件为合法 XML、包含根证书且同一证书生成的内容一致
+func TestAppleProfile(t *testing.T) {
+	caCert, _ := newTestCA(t)
+	caCert.Subject.CommonName = "A & B <CA>"
+	profile := appleProfile(caCert)
+
+	dec := xml.NewDecoder(bytes.NewReader(profile))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("invalid profile XML: %v", err)
+		}
+	}
+	for _, want := range []string{
+		base64.StdEncoding.EncodeToString(caCert.Raw),
+		"com.apple.security.root",
+		"A &amp; B &lt;CA&gt;",
+	} {
+		if !bytes.Contains(profile, []byte(want)) {
+			t.Fatalf("profile missing %q", want)
+		}
+	}
+	if !bytes.Equal(profile, appleProfile(caCert)) {
+		t.Fatal("profile should be deterministic for the same certificate")
+	}
+}
@@ -23,7 +23,7 @@ func NewPerformanceCollector() *PerformanceCollector {
 	}
 }
 
-// StartCollecting 开始收集性能指标
+// StartCollecting 开始收集性能指标，返回初始指标的副本
 func (pc *PerformanceCollector) StartCollecting(flowID string) *models.PerformanceMetrics {
 	pc.mu.Lock()
 	defer pc.mu.Unlock()
@@ -38,7 +38,8 @@ func (pc *PerformanceCollector) StartCollecting(flowID string) *models.Performan
 	}
 
 	pc.metrics[flowID] = metrics
-	return metrics
+	cp := *metrics
+	return &cp
 }
 
 // RecordDNSLookup 记录DNS解析时间
@@ -101,12 +102,17 @@ func (pc *PerformanceCollector) RecordTotalTime(flowID string, duration time.Dur
 	}
 }
 
-// GetMetrics 获取性能指标
+// GetMetrics 获取性能指标的副本，未收集时返回 nil
 func (pc *PerformanceCollector) GetMetrics(flowID string) *models.PerformanceMetrics {
 	pc.mu.RLock()
 	defer pc.mu.RUnlock()
 
-	return pc.metrics[flowID]
+	metrics, ok := pc.metrics[flowID]
+	if !ok {
+		return nil
+	}
+	cp := *metrics
+	return &cp
 }
 
 // Cleanup 清理性能指标
@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// ErrorInfo.Type 中记录的客户端握手失败类型
+const HandshakeErrorType = "tls_handshake"
+
+// pinningCloseWindow 握手完成后在此时间内未发送任何请求即断开，视为客户端拒绝了证书
+const pinningCloseWindow = time.Second
+
+// 常见 TLS 告警
+var tlsAlertNames = map[byte]string{
+	0:   "close_notify",
+	10:  "unexpected_message",
+	20:  "bad_record_mac",
+	40:  "handshake_failure",
+	42:  "bad_certificate",
+	43:  "unsupported_certificate",
+	44:  "certificate_revoked",
+	45:  "certificate_expired",
+	46:  "certificate_unknown",
+	48:  "unknown_ca",
+	49:  "access_denied",
+	50:  "decode_error",
+	51:  "decrypt_error",
+	70:  "protocol_version",
+	80:  "internal_error",
+	86:  "inappropriate_fallback",
+	90:  "user_canceled",
+	112: "unrecognized_name",
+	116: "certificate_required",
+	120: "no_application_protocol",
+}
+
+func tlsAlertName(desc byte) string {
+	if name, ok := tlsAlertNames[desc]; ok {
+		return name
+	}
+	return fmt.Sprintf("alert(%d)", desc)
+}
+
+// mitmHandshake 跟踪 MITM 隧道中客户端与代理之间的 TLS 握手
+type mitmHandshake struct {
+	connectReq *http.Request // 建立隧道的 CONNECT 请求
+	host       string
+	requests   atomic.Int32 // 隧道内解密出的请求数
+
+	mu          sync.Mutex
+	sni         string
+	started     bool // 已收到 ClientHello 并发送证书
+	startedAt   time.Time
+	completed   bool
+	completedAt time.Time
+	tls13       bool
+	alert       string // 客户端发送的明文告警
+	encrypted   bool   // 握手未完成时收到 TLS 1.3 加密告警
+}
+
+// encryptedAlertLen TLS 1.3 加密告警记录的长度：2 字节告警、1 字节类型与 16 字节认证标签
+const encryptedAlertLen = 19
+
+// observe 检查握手期间客户端发来的记录
+func (h *mitmHandshake) observe(b []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for len(b) >= 5 && h.started && !h.completed {
+		typ, n := b[0], int(b[3])<<8|int(b[4])
+		switch typ {
+		case 0x15: // alert
+			if n == 2 && len(b) >= 7 {
+				h.alert = tlsAlertName(b[6])
+			}
+		case 0x17: // application_data，TLS 1.3 握手后半段均为加密记录
+			if !h.tls13 {
+				break
+			}
+			if n == encryptedAlertLen {
+				h.encrypted = true
+			} else {
+				h.complete()
+			}
+		}
+		if len(b) < 5+n {
+			return
+		}
+		b = b[5+n:]
+	}
+}
+
+func (h *mitmHandshake) complete() {
+	h.completed, h.completedAt = true, time.Now()
+}
+
+// failureReason 判断连接关闭时握手是否被客户端拒绝，未失败时返回空
+func (h *mitmHandshake) failureReason(closedAt time.Time) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	switch {
+	case !h.started:
+		return ""
+	case h.alert != "":
+		return "client sent alert " + h.alert
+	case !h.completed && h.encrypted:
+		return "client sent encrypted alert during handshake"
+	case !h.completed && h.requests.Load() == 0:
+		return "client closed connection after ServerHello"
+	case h.requests.Load() == 0 && closedAt.Sub(h.completedAt) < pinningCloseWindow:
+		return "client closed connection after handshake without sending a request"
+	}
+	return ""
+}
+
+// trackHandshake 包装签发的 TLS 配置，将握手状态关联到客户端连接
+func trackHandshake(cfg *tls.Config, hs *mitmHandshake) *tls.Config {
+	cfg = cfg.Clone()
+	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if c, ok := hello.Conn.(*clientConn); ok {
+			c.hs.Store(hs)
+		}
+		hs.mu.Lock()
+		hs.started, hs.startedAt, hs.sni = true, time.Now(), hello.ServerName
+		hs.mu.Unlock()
+		return nil, nil
+	}
+	// TLS 1.2 在收到客户端密钥交换后回调，此时客户端已接受证书；TLS 1.3 在读取客户端
+	// Finished 之前回调，完成与否由 observe 根据客户端的加密记录判断
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		hs.mu.Lock()
+		if cs.Version >= tls.VersionTLS13 {
+			hs.tls13 = true
+		} else {
+			hs.complete()
+		}
+		hs.mu.Unlock()
+		return nil
+	}
+	return cfg
+}
+
+// clientListener 包装代理监听的连接，用于观察 MITM 隧道中的 TLS 握手
+type clientListener struct {
+	net.Listener
+	onClose func(hs *mitmHandshake)
+}
+
+func (l *clientListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &clientConn{Conn: c, onClose: l.onClose}, nil
+}
+
+// clientConn 客户端连接，hs 在 MITM 握手开始时设置
+type clientConn struct {
+	net.Conn
+	hs      atomic.Pointer[mitmHandshake]
+	once    sync.Once
+	onClose func(hs *mitmHandshake)
+}
+
+func (c *clientConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if hs := c.hs.Load(); hs != nil && n > 0 {
+		hs.observe(b[:n])
+	}
+	return n, err
+}
+
+func (c *clientConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		if hs := c.hs.Load(); hs != nil {
+			c.onClose(hs)
+		}
+	})
+	return err
+}
+
+// checkHandshake MITM 隧道关闭时检查客户端是否拒绝了代理证书，并记录为失败的 Flow
+func (p *EnhancedProxyServer) checkHandshake(hs *mitmHandshake) {
+	now := time.Now()
+	reason := hs.failureReason(now)
+	if reason == "" {
+		return
+	}
+	host := stripHostPort(hs.host)
+	req := hs.connectReq
+	hs.mu.Lock()
+	start := hs.startedAt
+	hs.mu.Unlock()
+	flow := &models.Flow{
+		ID:         uuid.NewString(),
+		Scheme:     "https",
+		RemoteAddr: req.RemoteAddr,
+		StartAt:    start,
+		EndAt:      now,
+		LatencyMs:  now.Sub(start).Milliseconds(),
+		Request: &models.HTTPRequest{
+			Method:  http.MethodConnect,
+			URL:     hs.host,
+			Host:    hs.host,
+			Headers: models.CopyHeaders(req.Header),
+			Proto:   req.Proto,
+		},
+		Network: p.buildNetworkInfo(req),
+		Error: &models.ErrorInfo{
+			Type:    HandshakeErrorType,
+			Message: fmt.Sprintf("client rejected MITM certificate for %s: %s", host, reason),
+			IsTLS:   true,
+		},
+	}
+	if p.mitmPolicy != nil {
+		rule, err := p.mitmPolicy.RecordHandshakeFailure(host, reason)
+		if rule != nil {
+			flow.Error.Message += "; host added to passthrough by rule " + rule.ID
+		}
+		if err != nil {
+			flow.Error.Message += "; saving passthrough rule failed: " + err.Error()
+		}
+	}
+	p.store.Add(flow)
+	p.errorCollector.RecordError(flow.ID, flow.Error.Type, flow.Error.Message, 0, false, 0)
+	p.errorCollector.Cleanup(flow.ID)
+	p.networkMonitor.RecordRequest(host, false, 0, 0)
+}
+
+// AutoPassthroughConfig 客户端反复拒绝证书时自动将主机加入透传
+type AutoPassthroughConfig struct {
+	Enabled   bool `json:"enabled"`
+	Threshold int  `json:"threshold"`  // 触发所需的失败次数，默认 3
+	WindowSec int  `json:"window_sec"` // 统计窗口，默认 300 秒
+}
+
+func (c *AutoPassthroughConfig) normalize() error {
+	if c.Threshold < 0 || c.WindowSec < 0 {
+		return fmt.Errorf("threshold and window_sec must not be negative")
+	}
+	if c.Threshold == 0 {
+		c.Threshold = 3
+	}
+	if c.WindowSec == 0 {
+		c.WindowSec = 300
+	}
+	return nil
+}
+
+// HandshakeFailure 主机的客户端握手失败统计
+type HandshakeFailure struct {
+	Host        string    `json:"host"`
+	Count       int       `json:"count"` // 累计失败次数
+	LastReason  string    `json:"last_reason"`
+	LastAt      time.Time `json:"last_at"`
+	Passthrough bool      `json:"passthrough"` // 是否已自动加入透传
+
+	recent []time.Time
+}
+
+// AutoPassthrough 返回自动透传配置
+func (m *MITMPolicy) AutoPassthrough() AutoPassthroughConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.auto
+}
+
+// SetAutoPassthrough 设置自动透传
+func (m *MITMPolicy) SetAutoPassthrough(cfg AutoPassthroughConfig) error {
+	if err := cfg.normalize(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := saveJSONFile(m.path, mitmPolicyConfig{DefaultAction: m.defaultAction, AutoPassthrough: cfg, Rules: m.rules}); err != nil {
+		return err
+	}
+	m.auto = cfg
+	return nil
+}
+
+// HandshakeFailures 返回各主机的握手失败统计，最近失败的在前
+func (m *MITMPolicy) HandshakeFailures() []HandshakeFailure {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]HandshakeFailure, 0, len(m.failures))
+	for _, f := range m.failures {
+		c := *f
+		c.recent = nil
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].LastAt.After(result[j].LastAt) })
+	return result
+}
+
+// ClearHandshakeFailures 清空握手失败统计
+func (m *MITMPolicy) ClearHandshakeFailures() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures = make(map[string]*HandshakeFailure)
+}
+
+// RecordHandshakeFailure 记录客户端拒绝证书，开启自动透传且窗口内失败次数达到阈值时
+// 在规则最前面添加透传规则并返回该规则；规则写入文件失败时仍在本次运行中生效，同时返回错误
+func (m *MITMPolicy) RecordHandshakeFailure(host, reason string) (*MITMRule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	f := m.failures[host]
+	if f == nil {
+		f = &HandshakeFailure{Host: host}
+		m.failures[host] = f
+	}
+	f.Count++
+	f.LastReason, f.LastAt = reason, now
+
+	if !m.auto.Enabled || f.Passthrough {
+		return nil, nil
+	}
+	window := time.Duration(m.auto.WindowSec) * time.Second
+	recent := f.recent[:0]
+	for _, t := range f.recent {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	f.recent = append(recent, now)
+	if len(f.recent) < m.auto.Threshold {
+		return nil, nil
+	}
+	if action, _ := m.decideLocked(host); action != TunnelMitm {
+		return nil, nil
+	}
+
+	rule := &MITMRule{ID: uuid.NewString(), Name: "auto passthrough", Enabled: true, Host: host, Action: TunnelPassthrough, Auto: true}
+	if err := rule.compile(); err != nil {
+		return nil, err
+	}
+	m.rules = append([]*MITMRule{rule}, m.rules...)
+	f.Passthrough, f.recent = true, nil
+	return rule, saveJSONFile(m.path, mitmPolicyConfig{DefaultAction: m.defaultAction, AutoPassthrough: m.auto, Rules: m.rules})
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// handshakeThroughTracker 在内存连接上完成一次 MITM 握手，返回关闭后的失败原因
+func handshakeThroughTracker(t *testing.T, clientCfg *tls.Config) string {
+	ts := httptest.NewTLSServer(nil)
+	serverCfg := &tls.Config{Certificates: ts.TLS.Certificates}
+	ts.Close()
+
+	hs := &mitmHandshake{connectReq: httptest.NewRequest("CONNECT", "http://example.com:443", nil), host: "example.com:443"}
+	reasons := make(chan string, 1)
+	client, server := net.Pipe()
+	conn := &clientConn{Conn: server, onClose: func(hs *mitmHandshake) { reasons <- hs.failureReason(time.Now()) }}
+
+	go func() {
+		tc := tls.Server(conn, trackHandshake(serverCfg, hs))
+		tc.Handshake()
+		buf := make([]byte, 1)
+		tc.Read(buf)
+		tc.Close()
+	}()
+
+	tc := tls.Client(client, clientCfg)
+	tc.Handshake()
+	tc.Close()
+	select {
+	case r := <-reasons:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("handshake not observed")
+	}
+	return ""
+}
+
+// TestHandshakeFailureDetection 测试识别客户端拒绝证书
+func TestHandshakeFailureDetection(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  *tls.Config
+		want string
+	}{
+		{"tls12 reject", &tls.Config{ServerName: "example.com", MaxVersion: tls.VersionTLS12}, "alert bad_certificate"},
+		{"tls13 reject", &tls.Config{ServerName: "example.com"}, "encrypted alert"},
+		{"accepted then closed", &tls.Config{InsecureSkipVerify: true}, "without sending a request"},
+	}
+	for _, c := range cases {
+		got := handshakeThroughTracker(t, c.cfg)
+		if !strings.Contains(got, c.want) {
+			t.Fatalf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// TestAutoPassthrough 测试失败次数达到阈值后自动透传
+func TestAutoPassthrough(t *testing.T) {
+	m, _ := NewMITMPolicy("")
+	if rule, _ := m.RecordHandshakeFailure("pinned.example.com", "x"); rule != nil {
+		t.Fatal("auto passthrough should be disabled by default")
+	}
+	if err := m.SetAutoPassthrough(AutoPassthroughConfig{Enabled: true, Threshold: 2}); err != nil {
+		t.Fatal(err)
+	}
+	m.AddRule(&MITMRule{Enabled: true, Host: "*", Action: TunnelMitm})
+
+	if rule, _ := m.RecordHandshakeFailure("pinned.example.com", "x"); rule != nil {
+		t.Fatal("threshold not reached yet")
+	}
+	rule, err := m.RecordHandshakeFailure("pinned.example.com", "x")
+	if err != nil || rule == nil || !rule.Auto {
+		t.Fatal("host should be added to passthrough")
+	}
+	if action, id := m.Decide("pinned.example.com"); action != TunnelPassthrough || id != rule.ID {
+		t.Fatalf("auto rule should take precedence, got %s %s", action, id)
+	}
+	if rule, _ := m.RecordHandshakeFailure("pinned.example.com", "x"); rule != nil {
+		t.Fatal("host should only be added once")
+	}
+	failures := m.HandshakeFailures()
+	if len(failures) != 1 || failures[0].Count != 4 || !failures[0].Passthrough {
+		t.Fatalf("unexpected failures: %+v", failures)
+	}
+
+	// 规则文件无法写入时透传仍在本次运行中生效，并返回写入错误
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	m.path = filepath.Join(blocker, "mitm_policy.json")
+	m.RecordHandshakeFailure("other.example.com", "x")
+	rule, err = m.RecordHandshakeFailure("other.example.com", "x")
+	if rule == nil || err == nil {
+		t.Fatalf("expected rule with save error, got %v %v", rule, err)
+	}
+	if action, _ := m.Decide("other.example.com"); action != TunnelPassthrough {
+		t.Fatalf("rule should apply despite save error, got %s", action)
+	}
+}
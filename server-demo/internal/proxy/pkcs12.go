@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ErrPKCS12Password 密码错误或文件被篡改
+var ErrPKCS12Password = pkcs12.ErrIncorrectPassword
+
+// encodePKCS12 生成 PKCS#12，使用兼容性最好的 SHA1/3DES；key 为空时只包含证书
+func encodePKCS12(cert *x509.Certificate, key crypto.Signer, password string) ([]byte, error) {
+	if key == nil {
+		return pkcs12.LegacyDES.EncodeTrustStore([]*x509.Certificate{cert}, password)
+	}
+	return pkcs12.LegacyDES.Encode(key, cert, nil, password)
+}
+
+// decodePKCS12 解析 PKCS#12 中的私钥与全部证书，支持 OpenSSL 3 默认的 PBES2/AES 与 SHA-256 MAC 以及 RC2 等旧算法
+func decodePKCS12(data []byte, password string) (crypto.Signer, []*x509.Certificate, error) {
+	pk, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := caSigner(pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, append([]*x509.Certificate{cert}, chain...), nil
+}
@@ -0,0 +1,576 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"probe/internal/models"
+	"probe/pkg/utils"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	// 注册常用的 well-known 类型，上传的文件可直接导入
+	_ "google.golang.org/protobuf/types/known/anypb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/emptypb"
+	_ "google.golang.org/protobuf/types/known/fieldmaskpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// protobuf 消息体的承载方式
+const (
+	ProtoKindGRPC     = "grpc"     // application/grpc，5 字节前缀分帧
+	ProtoKindGRPCWeb  = "grpc-web" // application/grpc-web(-text)，末尾附带 trailer 帧
+	ProtoKindConnect  = "connect"  // application/connect+proto 流式，末尾附带 end-stream 帧
+	ProtoKindProtobuf = "protobuf" // 未分帧的单条消息
+)
+
+// 分帧前缀的标志位
+const (
+	protoFlagCompressed = 0x01
+	protoFlagEndStream  = 0x02 // Connect end-stream，负载为 JSON
+	protoFlagTrailer    = 0x80 // gRPC-Web trailer，负载为 HTTP 头格式
+)
+
+// maxProtoWireDepth 无 schema 解码时嵌套消息的最大深度
+const maxProtoWireDepth = 32
+
+var ErrProtoSchemaNotFound = errors.New("protobuf schema not found")
+
+// DefaultProtoSchemaFile protobuf schema 默认持久化文件
+func DefaultProtoSchemaFile() string {
+	return filepath.Join(DefaultRulesDir(), "protobuf.json")
+}
+
+// ProtoSchema 上传的 .proto 源文件或序列化的 FileDescriptorSet，二者取其一
+type ProtoSchema struct {
+	ID            string    `json:"id"`
+	Name          string    `json:"name"`                     // .proto 文件的导入路径，描述符集仅作展示
+	Source        string    `json:"source,omitempty"`         // .proto 源码
+	DescriptorSet []byte    `json:"descriptor_set,omitempty"` // FileDescriptorSet（protoc --descriptor_set_out --include_imports）
+	Files         []string  `json:"files"`                    // 包含的 .proto 文件
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// fileProtos 解析出 schema 包含的文件描述，.proto 源码由 compiler 编译
+func (s *ProtoSchema) fileProtos(compiler *protocompile.Compiler) ([]*descriptorpb.FileDescriptorProto, error) {
+	switch {
+	case s.Source != "" && len(s.DescriptorSet) > 0:
+		return nil, errors.New("source and descriptor_set are mutually exclusive")
+	case s.Source != "":
+		if s.Name == "" {
+			return nil, errors.New("name is required for .proto source")
+		}
+		files, err := compiler.Compile(context.Background(), s.Name)
+		if err != nil {
+			return nil, err
+		}
+		return []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(files[0])}, nil
+	case len(s.DescriptorSet) > 0:
+		set, err := s.descriptorSet()
+		if err != nil {
+			return nil, err
+		}
+		if len(set.File) == 0 {
+			return nil, errors.New("descriptor set is empty")
+		}
+		return set.File, nil
+	}
+	return nil, errors.New("source or descriptor_set is required")
+}
+
+func (s *ProtoSchema) descriptorSet() (*descriptorpb.FileDescriptorSet, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(s.DescriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	return &set, nil
+}
+
+// newProtoCompiler 创建编译 .proto 源码的编译器，导入路径依次在内置注册表、上传的源码与描述符集中查找
+func newProtoCompiler(schemas []*ProtoSchema) *protocompile.Compiler {
+	sources := make(map[string]string)
+	sets := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, s := range schemas {
+		if s.Source != "" {
+			if _, ok := sources[s.Name]; !ok {
+				sources[s.Name] = s.Source
+			}
+			continue
+		}
+		if set, err := s.descriptorSet(); err == nil {
+			for _, fd := range set.File {
+				sets[fd.GetName()] = fd
+			}
+		}
+	}
+	resolve := func(path string) (protocompile.SearchResult, error) {
+		if fd, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+			return protocompile.SearchResult{Desc: fd}, nil
+		}
+		if src, ok := sources[path]; ok {
+			return protocompile.SearchResult{Source: strings.NewReader(src)}, nil
+		}
+		if fd, ok := sets[path]; ok {
+			return protocompile.SearchResult{Proto: fd}, nil
+		}
+		return protocompile.SearchResult{}, protoregistry.NotFound
+	}
+	return &protocompile.Compiler{Resolver: protocompile.ResolverFunc(resolve)}
+}
+
+// ProtoManager 管理上传的 protobuf schema，并据此解码 gRPC 与 protobuf 消息体
+type ProtoManager struct {
+	mu      sync.RWMutex
+	schemas []*ProtoSchema
+	path    string
+	files   *protoregistry.Files
+	types   *dynamicpb.Types
+}
+
+// NewProtoManager 创建 protobuf schema 管理器，path 非空时从文件加载并在修改后自动保存
+func NewProtoManager(path string) (*ProtoManager, error) {
+	m := &ProtoManager{schemas: make([]*ProtoSchema, 0), path: path}
+	m.setFiles(new(protoregistry.Files))
+	var schemas []*ProtoSchema
+	if err := loadJSONFile(path, &schemas); err != nil {
+		return m, err
+	}
+	files, err := buildProtoFiles(schemas)
+	if err != nil {
+		return m, err
+	}
+	m.schemas = append(m.schemas, schemas...)
+	m.setFiles(files)
+	return m, nil
+}
+
+func (m *ProtoManager) setFiles(files *protoregistry.Files) {
+	m.files, m.types = files, dynamicpb.NewTypes(files)
+}
+
+// Schemas 返回已上传的 schema
+func (m *ProtoManager) Schemas() []*ProtoSchema {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*ProtoSchema, len(m.schemas))
+	copy(out, m.schemas)
+	return out
+}
+
+// Add 上传 schema，与已有 schema 一起编译通过后才会生效
+func (m *ProtoManager) Add(s *ProtoSchema) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.ID = uuid.NewString()
+	s.CreatedAt = time.Now()
+	schemas := append(append([]*ProtoSchema(nil), m.schemas...), s)
+	files, err := buildProtoFiles(schemas)
+	if err != nil {
+		return err
+	}
+	m.schemas = schemas
+	m.setFiles(files)
+	return saveJSONFile(m.path, m.schemas)
+}
+
+// Remove 删除 schema，仍被其他 schema 导入时拒绝删除
+func (m *ProtoManager) Remove(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, s := range m.schemas {
+		if s.ID != id {
+			continue
+		}
+		schemas := append(append([]*ProtoSchema(nil), m.schemas[:i]...), m.schemas[i+1:]...)
+		files, err := buildProtoFiles(schemas)
+		if err != nil {
+			return err
+		}
+		m.schemas = schemas
+		m.setFiles(files)
+		return saveJSONFile(m.path, m.schemas)
+	}
+	return ErrProtoSchemaNotFound
+}
+
+// protoResolver 先查找上传的文件，再查找程序内置的全局注册表
+type protoResolver struct {
+	local *protoregistry.Files
+}
+
+func (r protoResolver) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	if fd, err := r.local.FindFileByPath(path); err == nil {
+		return fd, nil
+	}
+	return protoregistry.GlobalFiles.FindFileByPath(path)
+}
+
+func (r protoResolver) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	if d, err := r.local.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	return protoregistry.GlobalFiles.FindDescriptorByName(name)
+}
+
+// buildProtoFiles 按依赖顺序编译所有 schema 的文件，并回填各 schema 包含的文件列表。
+// 与内置 well-known 类型同名的文件直接使用内置版本
+func buildProtoFiles(schemas []*ProtoSchema) (*protoregistry.Files, error) {
+	pending := make(map[string]*descriptorpb.FileDescriptorProto)
+	var order []string
+	compiler := newProtoCompiler(schemas)
+	for _, s := range schemas {
+		fds, err := s.fileProtos(compiler)
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", s.Name, err)
+		}
+		s.Files = s.Files[:0]
+		for _, fd := range fds {
+			s.Files = append(s.Files, fd.GetName())
+			if _, err := protoregistry.GlobalFiles.FindFileByPath(fd.GetName()); err == nil {
+				continue
+			}
+			if _, ok := pending[fd.GetName()]; ok {
+				return nil, fmt.Errorf("duplicate file %s", fd.GetName())
+			}
+			pending[fd.GetName()] = fd
+			order = append(order, fd.GetName())
+		}
+	}
+
+	files := new(protoregistry.Files)
+	resolver := protoResolver{local: files}
+	for len(order) > 0 {
+		var waiting []string
+		for _, name := range order {
+			fd := pending[name]
+			ready := true
+			for _, dep := range fd.GetDependency() {
+				if _, err := resolver.FindFileByPath(dep); err == nil {
+					continue
+				}
+				if _, ok := pending[dep]; !ok {
+					return nil, fmt.Errorf("%s: import %q not found", name, dep)
+				}
+				ready = false
+			}
+			if !ready {
+				waiting = append(waiting, name)
+				continue
+			}
+			desc, err := protodesc.NewFile(fd, resolver)
+			if err != nil {
+				return nil, err
+			}
+			if err := files.RegisterFile(desc); err != nil {
+				return nil, err
+			}
+		}
+		if len(waiting) == len(order) {
+			return nil, fmt.Errorf("import cycle among %s", strings.Join(waiting, ", "))
+		}
+		order = waiting
+	}
+	return files, nil
+}
+
+// ProtoDecoded 一个消息体的解码结果
+type ProtoDecoded struct {
+	Kind     string          `json:"kind"`             // grpc/grpc-web/connect/protobuf
+	Method   string          `json:"method,omitempty"` // 匹配的 RPC 方法，形如 pkg.Service/Method
+	Type     string          `json:"type,omitempty"`   // 解码使用的消息类型，为空表示按线格式解码
+	Messages []*ProtoMessage `json:"messages"`
+	Error    string          `json:"error,omitempty"` // 分帧或解压失败的原因
+}
+
+// ProtoMessage 消息体中的单条消息
+type ProtoMessage struct {
+	Compressed bool              `json:"compressed,omitempty"`
+	Size       int               `json:"size"`               // 解压后的长度
+	JSON       json.RawMessage   `json:"json,omitempty"`     // 按 schema 解码的 JSON
+	Fields     []*ProtoWireField `json:"fields,omitempty"`   // 无 schema 或按 schema 解码失败时的线格式字段
+	Trailers   map[string]string `json:"trailers,omitempty"` // gRPC-Web trailer 帧
+	EndStream  json.RawMessage   `json:"end_stream,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// ProtoWireField 按线格式解码的字段，bytes 类型能解析为消息时展开为 Message
+type ProtoWireField struct {
+	Number  int               `json:"number"`
+	Wire    string            `json:"wire"` // varint/fixed64/bytes/group/fixed32
+	Value   interface{}       `json:"value,omitempty"`
+	Message []*ProtoWireField `json:"message,omitempty"`
+}
+
+// protoKindOf 根据 Content-Type 判断消息体承载方式，非 protobuf 时返回空串
+func protoKindOf(contentType string) (kind string, params map[string]string) {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", nil
+	}
+	switch mt {
+	case "application/grpc", "application/grpc+proto":
+		return ProtoKindGRPC, params
+	case "application/grpc-web", "application/grpc-web+proto", "application/grpc-web-text", "application/grpc-web-text+proto":
+		return ProtoKindGRPCWeb, params
+	case "application/connect+proto":
+		return ProtoKindConnect, params
+	case "application/x-protobuf", "application/protobuf", "application/x-google-protobuf", "application/vnd.google.protobuf", "application/proto":
+		return ProtoKindProtobuf, params
+	}
+	return "", nil
+}
+
+// DecodeFlow 解码 Flow 的请求与响应消息体，非 protobuf 的一侧返回 nil
+func (m *ProtoManager) DecodeFlow(flow *models.Flow) (req, resp *ProtoDecoded) {
+	if flow.Request == nil {
+		return nil, nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	method := m.findMethod(flow.Request.Path)
+	var input, output protoreflect.MessageDescriptor
+	if method != nil {
+		input, output = method.Input(), method.Output()
+	}
+	req = m.decode(flow.Request.Headers, flow.Request.Body, method, input)
+	if flow.Response != nil {
+		resp = m.decode(flow.Response.Headers, flow.Response.Body, method, output)
+	}
+	return req, resp
+}
+
+// findMethod 按路径最后两段 /pkg.Service/Method 查找方法，兼容 gRPC、Connect 与 Twirp 的路径
+func (m *ProtoManager) findMethod(path string) protoreflect.MethodDescriptor {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 {
+		return nil
+	}
+	d, err := m.files.FindDescriptorByName(protoreflect.FullName(parts[len(parts)-2]))
+	if err != nil {
+		return nil
+	}
+	svc, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil
+	}
+	return svc.Methods().ByName(protoreflect.Name(parts[len(parts)-1]))
+}
+
+// findMessage 按全名查找消息类型
+func (m *ProtoManager) findMessage(name string) protoreflect.MessageDescriptor {
+	d, err := m.files.FindDescriptorByName(protoreflect.FullName(strings.TrimPrefix(name, ".")))
+	if err != nil {
+		return nil
+	}
+	md, _ := d.(protoreflect.MessageDescriptor)
+	return md
+}
+
+func (m *ProtoManager) decode(headers map[string]string, body []byte, method protoreflect.MethodDescriptor, md protoreflect.MessageDescriptor) *ProtoDecoded {
+	kind, params := protoKindOf(headers["Content-Type"])
+	if kind == "" {
+		return nil
+	}
+	out := &ProtoDecoded{Kind: kind, Messages: make([]*ProtoMessage, 0)}
+	if method != nil {
+		out.Method = string(method.Parent().FullName()) + "/" + string(method.Name())
+	} else {
+		// protobuf over HTTP 常在 Content-Type 参数中声明消息类型
+		for _, key := range []string{"messagetype", "proto", "type"} {
+			if md = m.findMessage(params[key]); md != nil {
+				break
+			}
+		}
+	}
+	if md != nil {
+		out.Type = string(md.FullName())
+	}
+
+	body, err := utils.DecodeBody(body, headers["Content-Encoding"])
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if kind == ProtoKindProtobuf {
+		out.Messages = append(out.Messages, m.decodeMessage(body, md))
+		return out
+	}
+	if strings.HasPrefix(headers["Content-Type"], "application/grpc-web-text") {
+		if body, err = base64.StdEncoding.DecodeString(string(body)); err != nil {
+			out.Error = err.Error()
+			return out
+		}
+	}
+	// 单条消息的压缩算法
+	encoding := headers["Grpc-Encoding"]
+	if kind == ProtoKindConnect {
+		encoding = headers["Connect-Content-Encoding"]
+	}
+	for len(body) > 0 {
+		if len(body) < 5 {
+			out.Error = "truncated message prefix"
+			return out
+		}
+		flags, n := body[0], binary.BigEndian.Uint32(body[1:5])
+		if uint64(n) > uint64(len(body)-5) {
+			out.Error = fmt.Sprintf("truncated message: want %d bytes, have %d", n, len(body)-5)
+			return out
+		}
+		payload := body[5 : 5+n]
+		body = body[5+n:]
+
+		var msg *ProtoMessage
+		if flags&protoFlagCompressed != 0 {
+			plain, err := utils.DecodeBody(payload, encoding)
+			if err != nil {
+				out.Messages = append(out.Messages, &ProtoMessage{Compressed: true, Size: len(payload), Error: err.Error()})
+				continue
+			}
+			payload = plain
+		}
+		switch {
+		case kind == ProtoKindGRPCWeb && flags&protoFlagTrailer != 0:
+			msg = &ProtoMessage{Size: len(payload), Trailers: parseGRPCWebTrailers(payload)}
+		case kind == ProtoKindConnect && flags&protoFlagEndStream != 0:
+			msg = &ProtoMessage{Size: len(payload), EndStream: json.RawMessage(payload)}
+			if !json.Valid(payload) {
+				msg.EndStream, msg.Error = nil, "invalid end-stream JSON"
+			}
+		default:
+			msg = m.decodeMessage(payload, md)
+		}
+		msg.Compressed = flags&protoFlagCompressed != 0
+		out.Messages = append(out.Messages, msg)
+	}
+	return out
+}
+
+// decodeMessage 有 schema 时解码为 JSON，否则或失败时按线格式解码
+func (m *ProtoManager) decodeMessage(payload []byte, md protoreflect.MessageDescriptor) *ProtoMessage {
+	msg := &ProtoMessage{Size: len(payload)}
+	if md != nil {
+		dm := dynamicpb.NewMessage(md)
+		err := proto.UnmarshalOptions{Resolver: m.types}.Unmarshal(payload, dm)
+		if err == nil {
+			var data []byte
+			if data, err = (protojson.MarshalOptions{Resolver: m.types}).Marshal(dm); err == nil {
+				msg.JSON = data
+				return msg
+			}
+		}
+		msg.Error = err.Error()
+	}
+	fields, err := decodeProtoWire(payload, 0)
+	if err != nil && msg.Error == "" {
+		msg.Error = err.Error()
+	}
+	msg.Fields = fields
+	return msg
+}
+
+// parseGRPCWebTrailers 解析 "key: value\r\n" 格式的 trailer 帧
+func parseGRPCWebTrailers(payload []byte) map[string]string {
+	trailers := make(map[string]string)
+	for _, line := range strings.Split(string(payload), "\n") {
+		if key, value, ok := strings.Cut(strings.TrimRight(line, "\r"), ":"); ok {
+			trailers[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return trailers
+}
+
+// decodeProtoWire 无 schema 按线格式解码，返回解析失败前已得到的字段
+func decodeProtoWire(b []byte, depth int) ([]*ProtoWireField, error) {
+	fields := make([]*ProtoWireField, 0)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fields, protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := &ProtoWireField{Number: int(num)}
+		switch typ {
+		case protowire.VarintType:
+			var v uint64
+			v, n = protowire.ConsumeVarint(b)
+			f.Wire, f.Value = "varint", v
+		case protowire.Fixed64Type:
+			var v uint64
+			v, n = protowire.ConsumeFixed64(b)
+			f.Wire, f.Value = "fixed64", v
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.Wire, f.Value = "fixed32", v
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			f.Wire = "bytes"
+			if n >= 0 {
+				f.Value, f.Message = wireBytesValue(v, depth)
+			}
+		case protowire.StartGroupType:
+			var v []byte
+			v, n = protowire.ConsumeGroup(num, b)
+			f.Wire = "group"
+			if n >= 0 && depth < maxProtoWireDepth {
+				f.Message, _ = decodeProtoWire(v, depth+1)
+			}
+		default:
+			n = -1
+		}
+		if n < 0 {
+			return fields, fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// wireBytesValue 优先解析为嵌套消息，其次为可打印字符串，否则保留原始字节
+func wireBytesValue(v []byte, depth int) (interface{}, []*ProtoWireField) {
+	if len(v) > 0 && depth < maxProtoWireDepth && !isPrintableText(v) {
+		if nested, err := decodeProtoWire(v, depth+1); err == nil && len(nested) > 0 {
+			return nil, nested
+		}
+	}
+	if isPrintableText(v) {
+		return string(v), nil
+	}
+	return v, nil
+}
+
+func isPrintableText(v []byte) bool {
+	if !utf8.Valid(v) {
+		return false
+	}
+	for _, r := range string(v) {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"probe/internal/models"
+	"probe/pkg/utils"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const testProtoSource = `
+syntax = "proto3";
+package demo.v1;
+
+import "google/protobuf/timestamp.proto";
+option go_package = "example.com/demo;demo";
+
+/* 用户服务 */
+service UserService {
+  rpc GetUser (GetUserRequest) returns (User);
+  rpc Watch (stream GetUserRequest) returns (stream User) { option deprecated = true; }
+}
+
+message GetUserRequest {
+  string id = 1;
+  optional bool verbose = 2;
+}
+
+message User {
+  enum Role { ROLE_UNSPECIFIED = 0; ADMIN = 1 [deprecated = true]; }
+  message Address { string city = 1; }
+  reserved 9, 10 to 12;
+
+  string id = 1;
+  Role role = 2;
+  map<string, int64> scores = 3;
+  repeated Address addresses = 4;
+  oneof contact {
+    string email = 5;
+    string phone = 6;
+  }
+  google.protobuf.Timestamp created_at = 7 [json_name = "createdAt"];
+}
+`
+
+// frameProto 编码一条 gRPC 分帧消息
+func frameProto(flags byte, payload []byte) []byte {
+	b := []byte{flags, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(len(payload)))
+	return append(b, payload...)
+}
+
+// marshalDynamic 将 JSON 按 md 编码为 protobuf
+func marshalDynamic(t *testing.T, md protoreflect.MessageDescriptor, js string) []byte {
+	msg := dynamicpb.NewMessage(md)
+	if err := protojson.Unmarshal([]byte(js), msg); err != nil {
+		t.Fatal(err)
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func assertJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid JSON %s: %v", got, err)
+	}
+	json.Unmarshal([]byte(want), &w)
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+// TestProtoSchemaDecoding 测试 .proto 上传、gRPC 分帧与压缩、按方法类型解码与描述符集上传
+func TestProtoSchemaDecoding(t *testing.T) {
+	m, _ := NewProtoManager("")
+	if err := m.Add(&ProtoSchema{Name: "broken.proto", Source: `syntax = "proto3"; import "missing.proto";`}); err == nil {
+		t.Fatal("missing import should be rejected")
+	}
+	schema := &ProtoSchema{Name: "demo/v1/user.proto", Source: testProtoSource}
+	if err := m.Add(schema); err != nil {
+		t.Fatal(err)
+	}
+	method := m.findMethod("/demo.v1.UserService/GetUser")
+	if method == nil {
+		t.Fatal("method not registered")
+	}
+	if !method.Parent().(protoreflect.ServiceDescriptor).Methods().ByName("Watch").IsStreamingServer() {
+		t.Fatal("stream modifier not parsed")
+	}
+
+	userJSON := `{"id":"u1","role":"ADMIN","scores":{"go":"3"},"addresses":[{"city":"Paris"}],"email":"a@b.c","createdAt":"2024-01-02T03:04:05Z"}`
+	reqPayload := marshalDynamic(t, method.Input(), `{"id":"u1","verbose":false}`)
+	respPayload := marshalDynamic(t, method.Output(), userJSON)
+	compressed, _ := utils.EncodeBody(respPayload, "gzip")
+	flow := &models.Flow{
+		Request: &models.HTTPRequest{
+			Path:    "/demo.v1.UserService/GetUser",
+			Headers: map[string]string{"Content-Type": "application/grpc"},
+			Body:    frameProto(0, reqPayload),
+		},
+		Response: &models.HTTPResponse{
+			Headers: map[string]string{"Content-Type": "application/grpc+proto", "Grpc-Encoding": "gzip"},
+			Body:    append(frameProto(1, compressed), frameProto(0, respPayload)...),
+		},
+	}
+	req, resp := m.DecodeFlow(flow)
+	if req == nil || req.Method != "demo.v1.UserService/GetUser" || req.Type != "demo.v1.GetUserRequest" || len(req.Messages) != 1 {
+		t.Fatalf("unexpected request decoding: %+v", req)
+	}
+	// proto3 optional 字段显式设置为默认值时仍会输出
+	assertJSON(t, req.Messages[0].JSON, `{"id":"u1","verbose":false}`)
+	if resp == nil || resp.Type != "demo.v1.User" || len(resp.Messages) != 2 || !resp.Messages[0].Compressed {
+		t.Fatalf("unexpected response decoding: %+v", resp)
+	}
+	for _, msg := range resp.Messages {
+		assertJSON(t, msg.JSON, userJSON)
+	}
+
+	// 描述符集上传：--include_imports 带入的 well-known 类型使用内置版本
+	set, _ := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+		protodesc.ToFileDescriptorProto(method.ParentFile()),
+	}})
+	m2, _ := NewProtoManager("")
+	if err := m2.Add(&ProtoSchema{Name: "demo.pb", DescriptorSet: set}); err != nil {
+		t.Fatal(err)
+	}
+	if _, resp := m2.DecodeFlow(flow); resp == nil || len(resp.Messages) != 2 || resp.Messages[1].JSON == nil {
+		t.Fatalf("descriptor set schema not used: %+v", resp)
+	}
+	if err := m.Remove(schema.ID); err != nil || m.findMethod("/demo.v1.UserService/GetUser") != nil {
+		t.Fatalf("schema not removed: %v", err)
+	}
+}
+
+// TestProtoSchemaOptions 测试 .proto 源码中的选项、json_name、扩展与 editions 语法被完整保留
+func TestProtoSchemaOptions(t *testing.T) {
+	m, _ := NewProtoManager("")
+	if err := m.Add(&ProtoSchema{Name: "bad.proto", Source: `syntax = "proto3"; message A { string a = 1 [(missing) = 1]; }`}); err == nil {
+		t.Fatal("unknown custom option should be rejected")
+	}
+	err := m.Add(&ProtoSchema{Name: "opt/v1/item.proto", Source: `
+edition = "2023";
+package opt.v1;
+
+import "google/protobuf/descriptor.proto";
+
+extend google.protobuf.FieldOptions { string label = 50001; }
+
+message Item {
+  string name = 1 [json_name = "title", (label) = "名称"];
+  repeated int32 ids = 2 [features.repeated_field_encoding = EXPANDED];
+  extensions 100 to 200;
+}
+
+extend Item { int64 rank = 100; }
+`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := m.findMessage("opt.v1.Item")
+	if md == nil {
+		t.Fatal("message not registered")
+	}
+	name, ids := md.Fields().ByName("name"), md.Fields().ByName("ids")
+	opts, _ := proto.Marshal(name.Options())
+	if name.JSONName() != "title" || !bytes.Contains(opts, []byte("名称")) {
+		t.Fatalf("field options lost: json_name=%s options=%x", name.JSONName(), opts)
+	}
+	if ids.IsPacked() {
+		t.Fatal("expanded repeated field should not be packed")
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := (protojson.UnmarshalOptions{Resolver: m.types}).Unmarshal([]byte(`{"title":"a","ids":[1,2],"[opt.v1.rank]":"5"}`), msg); err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := proto.Marshal(msg)
+	if !bytes.Contains(payload, []byte{0x10, 1, 0x10, 2}) {
+		t.Fatalf("repeated field not expanded: %x", payload)
+	}
+	assertJSON(t, m.decodeMessage(payload, md).JSON, `{"title":"a","ids":[1,2],"[opt.v1.rank]":"5"}`)
+}
+
+// TestProtoWireDecoding 测试无 schema 的线格式解码与 gRPC-Web trailer
+func TestProtoWireDecoding(t *testing.T) {
+	m, _ := NewProtoManager("")
+	// field 1: varint 150; field 2: "hi"; field 3: { field 1: varint 1 }
+	payload := []byte{0x08, 0x96, 0x01, 0x12, 0x02, 'h', 'i', 0x1a, 0x02, 0x08, 0x01}
+	flow := &models.Flow{
+		Request: &models.HTTPRequest{
+			Path:    "/api/thing",
+			Headers: map[string]string{"Content-Type": "application/x-protobuf"},
+			Body:    payload,
+		},
+		Response: &models.HTTPResponse{
+			Headers: map[string]string{"Content-Type": "application/grpc-web+proto"},
+			Body:    append(frameProto(0, payload), frameProto(0x80, []byte("grpc-status: 0\r\ngrpc-message: OK\r\n"))...),
+		},
+	}
+	req, resp := m.DecodeFlow(flow)
+	if req == nil || req.Kind != ProtoKindProtobuf || req.Type != "" {
+		t.Fatalf("unexpected request decoding: %+v", req)
+	}
+	fields := req.Messages[0].Fields
+	if len(fields) != 3 || fields[0].Value != uint64(150) || fields[1].Value != "hi" || len(fields[2].Message) != 1 || fields[2].Message[0].Value != uint64(1) {
+		data, _ := json.Marshal(fields)
+		t.Fatalf("unexpected wire fields: %s", data)
+	}
+	if resp == nil || resp.Kind != ProtoKindGRPCWeb || len(resp.Messages) != 2 || resp.Messages[1].Trailers["grpc-status"] != "0" {
+		t.Fatalf("unexpected grpc-web decoding: %+v", resp)
+	}
+
+	flow.Request.Headers["Content-Type"] = "application/json"
+	if req, _ := m.DecodeFlow(flow); req != nil {
+		t.Fatal("non-protobuf body should not be decoded")
+	}
+}
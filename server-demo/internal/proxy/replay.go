@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"probe/internal/models"
+)
+
+// 重放限制
+const (
+	MaxReplayRepeat      = 1000
+	MaxReplayConcurrency = 50
+	DefaultReplayTimeout = 60 * time.Second
+)
+
+// hopHeaders 逐跳请求头，重放时不应沿用
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade", "Content-Length",
+}
+
+// ReplayOverrides 重放时对原始请求的修改，nil 字段表示沿用原值
+type ReplayOverrides struct {
+	Method        *string           `json:"method,omitempty"`
+	URL           *string           `json:"url,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`        // 覆盖或新增的请求头
+	RemoveHeaders []string          `json:"remove_headers,omitempty"` // 删除的请求头
+	Body          *string           `json:"body,omitempty"`
+	BodyBase64    *string           `json:"body_base64,omitempty"` // 二进制内容以base64提交
+}
+
+// ReplayOptions 重放参数
+type ReplayOptions struct {
+	ReplayOverrides
+	Repeat      int `json:"repeat"`      // 重复次数，默认 1
+	Concurrency int `json:"concurrency"` // 并发数，默认 1
+}
+
+// Validate 校验并补全默认值
+func (o *ReplayOptions) Validate() error {
+	if o.Repeat <= 0 {
+		o.Repeat = 1
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.Repeat > MaxReplayRepeat {
+		return errors.New("repeat exceeds limit")
+	}
+	if o.Concurrency > MaxReplayConcurrency {
+		o.Concurrency = MaxReplayConcurrency
+	}
+	if o.Concurrency > o.Repeat {
+		o.Concurrency = o.Repeat
+	}
+	return nil
+}
+
+// replayTemplate 由原始请求与修改项生成的请求模板，每次重放据此新建请求
+type replayTemplate struct {
+	method string
+	url    *url.URL
+	header http.Header
+	body   []byte
+}
+
+// buildReplayTemplate 还原原始请求并应用修改
+func buildReplayTemplate(orig *models.HTTPRequest, o ReplayOverrides) (*replayTemplate, error) {
+	if orig == nil {
+		return nil, errors.New("flow has no request")
+	}
+	t := &replayTemplate{method: orig.Method, header: make(http.Header), body: orig.Body}
+	if o.Method != nil && *o.Method != "" {
+		t.method = strings.ToUpper(*o.Method)
+	}
+	rawURL := orig.URL
+	if o.URL != nil && *o.URL != "" {
+		rawURL = *o.URL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("url must be absolute http(s) url")
+	}
+	t.url = u
+
+	for k, v := range orig.Headers {
+		t.header.Set(k, v)
+	}
+	for _, h := range hopHeaders {
+		t.header.Del(h)
+	}
+	for k, v := range o.Headers {
+		t.header.Set(k, v)
+	}
+	for _, k := range o.RemoveHeaders {
+		t.header.Del(k)
+	}
+
+	switch {
+	case o.BodyBase64 != nil:
+		body, err := base64.StdEncoding.DecodeString(*o.BodyBase64)
+		if err != nil {
+			return nil, err
+		}
+		t.body = body
+	case o.Body != nil:
+		t.body = []byte(*o.Body)
+	}
+	return t, nil
+}
+
+func (t *replayTemplate) newRequest(ctx context.Context) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, t.method, t.url.String(), bytes.NewReader(t.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = t.header.Clone()
+	if len(t.body) == 0 {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	if host := t.header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+	return req, nil
+}
+
+// Replay 按原始 Flow 重新发送请求，可修改请求并重复多次；结果作为新的 Flow 保存并关联原始 Flow
+func (p *EnhancedProxyServer) Replay(ctx context.Context, orig *models.Flow, opts ReplayOptions) ([]*models.Flow, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	tmpl, err := buildReplayTemplate(orig.Request, opts.ReplayOverrides)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{
+		Transport: p.transportFor(tmpl.url.Hostname()),
+		Timeout:   DefaultReplayTimeout,
+		// 重放保持原始请求语义，不自动跟随重定向
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	flows := make([]*models.Flow, opts.Repeat)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				req, err := tmpl.newRequest(ctx)
+				if err != nil {
+					continue
+				}
+				flows[i] = p.sendFlow(client, req, tmpl.body, FlowSourceReplay, orig.ID)
+			}
+		}()
+	}
+	for i := 0; i < opts.Repeat; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	result := make([]*models.Flow, 0, len(flows))
+	for _, f := range flows {
+		if f != nil {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
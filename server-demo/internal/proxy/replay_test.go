@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// TestBuildReplayTemplate 测试请求还原与修改项
+func TestBuildReplayTemplate(t *testing.T) {
+	orig := &models.HTTPRequest{
+		Method:  "POST",
+		URL:     "http://api.example.com/v1/items?a=1",
+		Headers: map[string]string{"Content-Type": "application/json", "Connection": "keep-alive", "X-Old": "1", "Content-Length": "7"},
+		Body:    []byte(`{"a":1}`),
+	}
+	method, url, body := "put", "http://other.example.com/v2", "changed"
+	tmpl, err := buildReplayTemplate(orig, ReplayOverrides{
+		Method:        &method,
+		URL:           &url,
+		Headers:       map[string]string{"X-New": "2"},
+		RemoveHeaders: []string{"X-Old"},
+		Body:          &body,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tmpl.method != "PUT" || tmpl.url.String() != url || string(tmpl.body) != body {
+		t.Fatalf("overrides not applied: %s %s %q", tmpl.method, tmpl.url, tmpl.body)
+	}
+	if tmpl.header.Get("Connection") != "" || tmpl.header.Get("Content-Length") != "" || tmpl.header.Get("X-Old") != "" {
+		t.Fatalf("unexpected headers: %v", tmpl.header)
+	}
+	if tmpl.header.Get("X-New") != "2" || tmpl.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("headers not kept: %v", tmpl.header)
+	}
+
+	bad := "/relative"
+	if _, err := buildReplayTemplate(orig, ReplayOverrides{URL: &bad}); err == nil {
+		t.Fatal("relative url should be rejected")
+	}
+}
+
+// TestReplayRepeat 测试重复重放并记录为关联的新 Flow
+func TestReplayRepeat(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(r.Method + " " + r.Header.Get("X-Token") + " " + string(b)))
+	}))
+	defer upstream.Close()
+
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "", false, store)
+	orig := &models.Flow{ID: "orig", Request: &models.HTTPRequest{
+		Method:  "POST",
+		URL:     upstream.URL + "/echo",
+		Headers: map[string]string{"X-Token": "abc"},
+		Body:    []byte("hello"),
+	}}
+
+	flows, err := p.Replay(context.Background(), orig, ReplayOptions{Repeat: 5, Concurrency: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flows) != 5 || calls.Load() != 5 {
+		t.Fatalf("got %d flows, %d calls", len(flows), calls.Load())
+	}
+	for _, f := range flows {
+		if f.ReplayOf != "orig" || f.Source != FlowSourceReplay {
+			t.Fatalf("flow not linked: %+v", f)
+		}
+		if f.Response == nil || string(f.Response.Body) != "POST abc hello" {
+			t.Fatalf("unexpected response: %+v", f.Response)
+		}
+		stored := store.GetByID(f.ID)
+		if f.Performance == nil || stored == nil || stored.ReplayOf != "orig" || stored.Response == nil {
+			t.Fatalf("flow not recorded: %+v", stored)
+		}
+	}
+
+	if _, err := p.Replay(context.Background(), orig, ReplayOptions{Repeat: MaxReplayRepeat + 1}); err == nil {
+		t.Fatal("repeat over limit should be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FlowSourceReverse 经反向代理监听进入的流量
+const FlowSourceReverse = "reverse"
+
+// ReverseConfig 反向代理配置，Addr 为空时不启用
+type ReverseConfig struct {
+	Addr         string `json:"addr"`
+	Backend      string `json:"backend"`       // 后端地址 http(s)://host[:port][/prefix]
+	TLS          bool   `json:"tls"`           // 使用 Probe CA 签发的证书终止 TLS
+	PreserveHost bool   `json:"preserve_host"` // 保留客户端的 Host，否则改为后端主机
+}
+
+// Validate 校验配置
+func (c ReverseConfig) Validate() error {
+	if c.Addr == "" {
+		return nil
+	}
+	_, err := c.parseBackend()
+	return err
+}
+
+// parseBackend 校验并解析后端地址
+func (c ReverseConfig) parseBackend() (*url.URL, error) {
+	u, err := url.Parse(c.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("backend must be an http or https url")
+	}
+	if u.Host == "" {
+		return nil, errors.New("backend host is required")
+	}
+	return u, nil
+}
+
+type reverseKey struct{}
+
+// isReverseRequest 请求是否由反向代理监听转入
+func isReverseRequest(req *http.Request) bool {
+	return req.Context().Value(reverseKey{}) != nil
+}
+
+// reverseHandler 将请求改写为指向后端的绝对地址后交给 handler（goproxy），复用捕获流程
+func reverseHandler(backend *url.URL, preserveHost bool, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			http.Error(w, "CONNECT is not supported in reverse proxy mode", http.StatusMethodNotAllowed)
+			return
+		}
+		out := r.Clone(context.WithValue(r.Context(), reverseKey{}, true))
+		out.URL.Scheme = backend.Scheme
+		out.URL.Host = backend.Host
+		out.URL.Path = joinURLPath(backend.Path, r.URL.Path)
+		out.URL.RawPath = ""
+		if backend.RawQuery != "" {
+			if out.URL.RawQuery == "" {
+				out.URL.RawQuery = backend.RawQuery
+			} else {
+				out.URL.RawQuery = backend.RawQuery + "&" + out.URL.RawQuery
+			}
+		}
+		if !preserveHost {
+			out.Host = backend.Host
+		}
+
+		proto := "http"
+		if r.TLS != nil {
+			proto = "https"
+		}
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			if prior := out.Header.Get("X-Forwarded-For"); prior != "" {
+				ip = prior + ", " + ip
+			}
+			out.Header.Set("X-Forwarded-For", ip)
+		}
+		out.Header.Set("X-Forwarded-Host", r.Host)
+		out.Header.Set("X-Forwarded-Proto", proto)
+		handler.ServeHTTP(w, out)
+	})
+}
+
+func joinURLPath(base, path string) string {
+	if base == "" || base == "/" {
+		return path
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
+
+// reverseTLSConfig 按 SNI 使用 Probe CA 签发证书，没有 SNI 时签发给 localhost
+func reverseTLSConfig(certs *LeafCertCache) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			host := hello.ServerName
+			if host == "" {
+				host = "localhost"
+			}
+			return certs.Get(host)
+		},
+	}
+}
+
+// startReverse 启动反向代理监听
+func (p *EnhancedProxyServer) startReverse(handler http.Handler) error {
+	backend, err := p.reverse.parseBackend()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", p.reverse.Addr)
+	if err != nil {
+		return err
+	}
+	if p.reverse.TLS {
+		ln = tls.NewListener(ln, reverseTLSConfig(p.leafCerts))
+	}
+	p.reverseSrv = &http.Server{Addr: ln.Addr().String(), Handler: reverseHandler(backend, p.reverse.PreserveHost, handler)}
+	go p.reverseSrv.Serve(ln)
+	return nil
+}
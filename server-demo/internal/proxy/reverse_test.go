@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// TestReverseProxy 测试反向代理转发到后端并记录 Flow
+func TestReverseProxy(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Seen", r.Host+" "+r.Header.Get("X-Forwarded-For")+" "+r.Header.Get("X-Forwarded-Proto"))
+		w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer backend.Close()
+
+	if err := (ReverseConfig{Addr: ":0", Backend: "ftp://x"}).Validate(); err == nil {
+		t.Fatal("non-http backend should be rejected")
+	}
+
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "127.0.0.1:0", false, store)
+	p.SetReverse(ReverseConfig{Addr: "127.0.0.1:0", Backend: backend.URL + "/api?v=1"})
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+
+	resp, err := http.Post("http://"+p.reverseSrv.Addr+"/users?id=7", "text/plain", strings.NewReader("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/api/users?v=1&id=7" {
+		t.Fatalf("unexpected backend path %q", body)
+	}
+	backendHost := strings.TrimPrefix(backend.URL, "http://")
+	if seen := resp.Header.Get("X-Seen"); seen != backendHost+" 127.0.0.1 http" {
+		t.Fatalf("unexpected forwarded headers %q", seen)
+	}
+
+	flow := waitFlow(t, store, func(f *models.Flow) bool { return f.Response != nil })
+	if flow.Source != FlowSourceReverse || string(flow.Request.Body) != "hi" || flow.Request.URL != backend.URL+"/api/users?v=1&id=7" {
+		t.Fatalf("unexpected flow: %s %q %s", flow.Source, flow.Request.Body, flow.Request.URL)
+	}
+}
@@ -0,0 +1,465 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+	"probe/pkg/utils"
+)
+
+// 改写规则作用阶段
+const (
+	RewritePhaseRequest  = "request"
+	RewritePhaseResponse = "response"
+)
+
+// 改写动作类型
+const (
+	RewriteSetHeader    = "set_header"    // 设置请求头/响应头：Name, Value
+	RewriteRemoveHeader = "remove_header" // 删除请求头/响应头：Name
+	RewriteReplaceBody  = "replace_body"  // 正则替换消息体：Pattern, Replacement；Pattern 为空时整体替换为 Replacement
+	RewriteJSONSet      = "json_set"      // 按 JSONPath 设置字段：Path, Value（JSON字面量，解析失败按字符串处理）
+	RewriteJSONDelete   = "json_delete"   // 按 JSONPath 删除字段：Path
+	RewriteSetStatus    = "set_status"    // 修改响应状态码：StatusCode
+	RewriteURL          = "rewrite_url"   // 正则改写完整URL：Pattern, Replacement
+	RewriteSetQuery     = "set_query"     // 设置查询参数：Name, Value
+	RewriteRemoveQuery  = "remove_query"  // 删除查询参数：Name
+)
+
+// DefaultRewriteRulesFile 改写规则默认持久化文件
+func DefaultRewriteRulesFile() string {
+	return filepath.Join(DefaultRulesDir(), "rewrite_rules.json")
+}
+
+var ErrRewriteRuleNotFound = errors.New("rewrite rule not found")
+
+// RewriteAction 单个改写动作
+type RewriteAction struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Path        string `json:"path,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+
+	re       *regexp.Regexp
+	jsonPath []jsonPathToken
+}
+
+// RewriteRule 改写规则，按列表顺序依次执行
+type RewriteRule struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Enabled     bool            `json:"enabled"`
+	Phase       string          `json:"phase"`                  // request/response
+	ContentType string          `json:"content_type,omitempty"` // Content-Type 通配符，如 application/json*
+	StatusCode  int             `json:"status_code,omitempty"`  // 仅 response 阶段，0 表示不限制
+	Actions     []RewriteAction `json:"actions"`
+	FlowMatcher
+
+	contentTypeRe *regexp.Regexp
+}
+
+// RewriteEngine 管理并执行改写规则
+type RewriteEngine struct {
+	mu    sync.RWMutex
+	rules []*RewriteRule
+	path  string
+}
+
+// NewRewriteEngine 创建改写引擎，path 非空时从文件加载规则并在修改后自动保存
+func NewRewriteEngine(path string) (*RewriteEngine, error) {
+	e := &RewriteEngine{rules: make([]*RewriteRule, 0), path: path}
+	var rules []*RewriteRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return e, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return e, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	e.rules = append(e.rules, rules...)
+	return e, nil
+}
+
+// Rules 返回全部规则（按执行顺序）
+func (e *RewriteEngine) Rules() []*RewriteRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	result := make([]*RewriteRule, len(e.rules))
+	copy(result, e.rules)
+	return result
+}
+
+// AddRule 在末尾追加规则
+func (e *RewriteEngine) AddRule(rule *RewriteRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.setRulesLocked(append(e.rules[:len(e.rules):len(e.rules)], rule))
+}
+
+// UpdateRule 更新指定规则，保持原有顺序
+func (e *RewriteEngine) UpdateRule(id string, rule *RewriteRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*RewriteRule(nil), e.rules...)
+			rules[i] = rule
+			return e.setRulesLocked(rules)
+		}
+	}
+	return ErrRewriteRuleNotFound
+}
+
+// RemoveRule 删除指定规则
+func (e *RewriteEngine) RemoveRule(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, r := range e.rules {
+		if r.ID == id {
+			return e.setRulesLocked(append(e.rules[:i:i], e.rules[i+1:]...))
+		}
+	}
+	return ErrRewriteRuleNotFound
+}
+
+// ReplaceRules 整体替换规则列表，用于调整顺序或批量导入
+func (e *RewriteEngine) ReplaceRules(rules []*RewriteRule) error {
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return err
+		}
+		if r.ID == "" {
+			r.ID = uuid.NewString()
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.setRulesLocked(append(make([]*RewriteRule, 0, len(rules)), rules...))
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (e *RewriteEngine) setRulesLocked(rules []*RewriteRule) error {
+	if err := saveJSONFile(e.path, rules); err != nil {
+		return err
+	}
+	e.rules = rules
+	return nil
+}
+
+// matching 返回指定阶段命中的规则
+func (e *RewriteEngine) matching(phase string, req *http.Request, contentType string, status int) []*RewriteRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var result []*RewriteRule
+	for _, r := range e.rules {
+		if !r.Enabled || r.Phase != phase || !r.MatchRequest(req) {
+			continue
+		}
+		if r.contentTypeRe != nil && !r.contentTypeRe.MatchString(contentType) {
+			continue
+		}
+		if phase == RewritePhaseResponse && r.StatusCode != 0 && r.StatusCode != status {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// ApplyRequest 对请求执行改写，返回新的消息体、命中的规则ID及执行中遇到的首个错误
+func (e *RewriteEngine) ApplyRequest(req *http.Request, body []byte) ([]byte, []string, error) {
+	rules := e.matching(RewritePhaseRequest, req, req.Header.Get("Content-Type"), 0)
+	if len(rules) == 0 {
+		return body, nil, nil
+	}
+	m := &rewriteMessage{header: req.Header, body: body}
+	applied, firstErr := m.run(rules, func(a *RewriteAction) (bool, error) {
+		return applyURLAction(req, a)
+	})
+	newBody, err := m.finish()
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if m.bodyChanged && err == nil {
+		req.Body = io.NopCloser(bytes.NewReader(newBody))
+		req.ContentLength = int64(len(newBody))
+		req.Header.Del("Transfer-Encoding")
+		req.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	}
+	return newBody, applied, firstErr
+}
+
+// ApplyResponse 对响应执行改写，返回新的消息体、命中的规则ID及执行中遇到的首个错误
+func (e *RewriteEngine) ApplyResponse(req *http.Request, resp *http.Response, body []byte) ([]byte, []string, error) {
+	rules := e.matching(RewritePhaseResponse, req, resp.Header.Get("Content-Type"), resp.StatusCode)
+	if len(rules) == 0 {
+		return body, nil, nil
+	}
+	m := &rewriteMessage{header: resp.Header, body: body}
+	applied, firstErr := m.run(rules, func(a *RewriteAction) (bool, error) {
+		if a.Type != RewriteSetStatus {
+			return false, nil
+		}
+		resp.StatusCode = a.StatusCode
+		resp.Status = fmt.Sprintf("%d %s", a.StatusCode, http.StatusText(a.StatusCode))
+		return true, nil
+	})
+	newBody, err := m.finish()
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if m.bodyChanged && err == nil {
+		resp.Body = io.NopCloser(bytes.NewReader(newBody))
+		resp.ContentLength = int64(len(newBody))
+		resp.TransferEncoding = nil
+		resp.Header.Del("Transfer-Encoding")
+		resp.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+	}
+	return newBody, applied, firstErr
+}
+
+// rewriteMessage 改写过程中的消息状态，消息体仅在需要时解压一次
+type rewriteMessage struct {
+	header      http.Header
+	body        []byte
+	plain       []byte
+	decoded     bool
+	bodyChanged bool
+}
+
+// run 依次执行规则动作；extra 处理阶段特有的动作，返回 true 表示已处理
+func (m *rewriteMessage) run(rules []*RewriteRule, extra func(*RewriteAction) (bool, error)) ([]string, error) {
+	var applied []string
+	var firstErr error
+	for _, r := range rules {
+		for i := range r.Actions {
+			a := &r.Actions[i]
+			handled, err := extra(a)
+			if !handled && err == nil {
+				err = m.apply(a)
+			}
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("rule %s: %w", r.ID, err)
+			}
+		}
+		applied = append(applied, r.ID)
+	}
+	return applied, firstErr
+}
+
+func (m *rewriteMessage) apply(a *RewriteAction) error {
+	switch a.Type {
+	case RewriteSetHeader:
+		m.header.Set(a.Name, a.Value)
+	case RewriteRemoveHeader:
+		m.header.Del(a.Name)
+	case RewriteReplaceBody:
+		plain, err := m.plainBody()
+		if err != nil {
+			return err
+		}
+		if a.re == nil {
+			m.setBody([]byte(a.Replacement))
+		} else {
+			m.setBody(a.re.ReplaceAll(plain, []byte(a.Replacement)))
+		}
+	case RewriteJSONSet, RewriteJSONDelete:
+		plain, err := m.plainBody()
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		if len(bytes.TrimSpace(plain)) > 0 {
+			if doc, err = decodeJSON(plain); err != nil {
+				return errors.New("body is not valid json")
+			}
+		}
+		if a.Type == RewriteJSONSet {
+			doc, err = jsonPathSet(doc, a.jsonPath, a.jsonSetValue())
+			if err != nil {
+				return err
+			}
+		} else {
+			doc = jsonPathDelete(doc, a.jsonPath)
+		}
+		out, err := encodeJSON(doc)
+		if err != nil {
+			return err
+		}
+		m.setBody(out)
+	}
+	// set_status、URL 类动作在不适用的阶段忽略
+	return nil
+}
+
+// plainBody 返回解压后的消息体
+func (m *rewriteMessage) plainBody() ([]byte, error) {
+	if m.decoded {
+		return m.plain, nil
+	}
+	plain, err := utils.DecodeBody(m.body, m.header.Get("Content-Encoding"))
+	if err != nil {
+		return nil, err
+	}
+	m.plain, m.decoded = plain, true
+	return plain, nil
+}
+
+func (m *rewriteMessage) setBody(b []byte) {
+	m.plain = b
+	m.bodyChanged = true
+}
+
+// finish 按原 Content-Encoding 重新压缩被修改的消息体
+func (m *rewriteMessage) finish() ([]byte, error) {
+	if !m.bodyChanged {
+		return m.body, nil
+	}
+	out, err := utils.EncodeBody(m.plain, m.header.Get("Content-Encoding"))
+	if err != nil {
+		return m.body, err
+	}
+	return out, nil
+}
+
+// jsonSetValue 将 Value 解析为JSON字面量，失败时按字符串处理；每次生成新值避免规则间共享
+func (a *RewriteAction) jsonSetValue() interface{} {
+	v, err := decodeJSON([]byte(a.Value))
+	if err != nil {
+		return a.Value
+	}
+	return v
+}
+
+// applyURLAction 处理请求阶段的 URL 改写动作
+func applyURLAction(req *http.Request, a *RewriteAction) (bool, error) {
+	switch a.Type {
+	case RewriteURL:
+		raw := a.re.ReplaceAllString(req.URL.String(), a.Replacement)
+		u, err := url.Parse(raw)
+		if err != nil {
+			return true, err
+		}
+		if u.Host != "" && u.Host != req.URL.Host {
+			req.Host = u.Host
+		}
+		req.URL = u
+	case RewriteSetQuery:
+		q := req.URL.Query()
+		q.Set(a.Name, a.Value)
+		req.URL.RawQuery = q.Encode()
+	case RewriteRemoveQuery:
+		q := req.URL.Query()
+		q.Del(a.Name)
+		req.URL.RawQuery = q.Encode()
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func (r *RewriteRule) compile() error {
+	switch r.Phase {
+	case "":
+		r.Phase = RewritePhaseResponse
+	case RewritePhaseRequest, RewritePhaseResponse:
+	default:
+		return errors.New("invalid phase: " + r.Phase)
+	}
+	if err := r.Compile(); err != nil {
+		return err
+	}
+	r.contentTypeRe = nil
+	if r.ContentType != "" {
+		re, err := globToRegexp(r.ContentType)
+		if err != nil {
+			return err
+		}
+		r.contentTypeRe = re
+	}
+	if r.Phase == RewritePhaseRequest && r.StatusCode != 0 {
+		return errors.New("status_code condition only applies to response rules")
+	}
+	if len(r.Actions) == 0 {
+		return errors.New("rule has no actions")
+	}
+	for i := range r.Actions {
+		if err := r.Actions[i].compile(r.Phase); err != nil {
+			return fmt.Errorf("action %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (a *RewriteAction) compile(phase string) error {
+	a.re, a.jsonPath = nil, nil
+	switch a.Type {
+	case RewriteSetHeader, RewriteRemoveHeader:
+		if a.Name == "" {
+			return errors.New("header name is required")
+		}
+	case RewriteReplaceBody:
+		if a.Pattern != "" {
+			re, err := regexp.Compile(a.Pattern)
+			if err != nil {
+				return errors.New("invalid body pattern: " + err.Error())
+			}
+			a.re = re
+		}
+	case RewriteJSONSet, RewriteJSONDelete:
+		tokens, err := parseJSONPath(a.Path)
+		if err != nil {
+			return err
+		}
+		a.jsonPath = tokens
+	case RewriteSetStatus:
+		if phase != RewritePhaseResponse {
+			return errors.New("set_status only applies to response rules")
+		}
+		if a.StatusCode < 100 || a.StatusCode > 999 {
+			return errors.New("invalid status code")
+		}
+	case RewriteURL:
+		if phase != RewritePhaseRequest {
+			return errors.New("rewrite_url only applies to request rules")
+		}
+		re, err := regexp.Compile(a.Pattern)
+		if err != nil || a.Pattern == "" {
+			return errors.New("invalid url pattern")
+		}
+		a.re = re
+	case RewriteSetQuery, RewriteRemoveQuery:
+		if phase != RewritePhaseRequest {
+			return errors.New(a.Type + " only applies to request rules")
+		}
+		if a.Name == "" {
+			return errors.New("query name is required")
+		}
+	default:
+		return errors.New("unknown action type: " + a.Type)
+	}
+	return nil
+}
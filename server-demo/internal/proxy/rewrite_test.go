@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestRewriteResponseGzipJSON 测试gzip响应的JSONPath改写与重新压缩
+func TestRewriteResponseGzipJSON(t *testing.T) {
+	e, err := NewRewriteEngine("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = e.AddRule(&RewriteRule{
+		Enabled:     true,
+		Phase:       RewritePhaseResponse,
+		ContentType: "application/json*",
+		FlowMatcher: FlowMatcher{Host: "*.example.com", Path: "^/api/"},
+		Actions: []RewriteAction{
+			{Type: RewriteJSONSet, Path: "$.user.vip", Value: "true"},
+			{Type: RewriteJSONSet, Path: "$.items[0].name", Value: "patched"},
+			{Type: RewriteSetHeader, Name: "X-Rewritten", Value: "1"},
+			{Type: RewriteSetStatus, StatusCode: 201},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "https://api.example.com/api/me", nil)
+	orig := gzipBytes(t, []byte(`{"user":{"vip":false},"items":[{"name":"a"}]}`))
+	resp := &http.Response{StatusCode: 200, Status: "200 OK", Header: http.Header{}, Request: req}
+	resp.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp.Header.Set("Content-Encoding", "gzip")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(orig)))
+
+	body, applied, err := e.ApplyResponse(req, resp, orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("applied = %v", applied)
+	}
+	if resp.StatusCode != 201 || resp.Header.Get("X-Rewritten") != "1" {
+		t.Fatalf("status/header not rewritten: %d %v", resp.StatusCode, resp.Header)
+	}
+	if resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) || resp.ContentLength != int64(len(body)) {
+		t.Fatalf("content-length mismatch: %s vs %d", resp.Header.Get("Content-Length"), len(body))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("body is not gzip: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	var doc struct {
+		User  struct{ VIP bool }
+		Items []struct{ Name string }
+	}
+	if err := json.Unmarshal(plain, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !doc.User.VIP || doc.Items[0].Name != "patched" {
+		t.Fatalf("unexpected body %s", plain)
+	}
+}
+
+// TestRewriteJSONPreservesDocument 测试JSON改写保留大整数精度、键顺序且不转义HTML字符
+func TestRewriteJSONPreservesDocument(t *testing.T) {
+	e, _ := NewRewriteEngine("")
+	err := e.AddRule(&RewriteRule{
+		Enabled: true,
+		Phase:   RewritePhaseResponse,
+		Actions: []RewriteAction{
+			{Type: RewriteJSONSet, Path: "$.b.flag", Value: "true"},
+			{Type: RewriteJSONSet, Path: "$.new", Value: `{"y":1,"x":12345678901234567890}`},
+			{Type: RewriteJSONDelete, Path: "$.list[1]"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	resp := &http.Response{StatusCode: 200, Header: http.Header{}, Request: req}
+	orig := []byte(`{"z":9007199254740993,"b":{"flag":false,"html":"<a>&"},"a":1.50,"list":[1,2,3]}`)
+	body, _, err := e.ApplyResponse(req, resp, orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"z":9007199254740993,"b":{"flag":true,"html":"<a>&"},"a":1.50,"list":[1,3],"new":{"y":1,"x":12345678901234567890}}`
+	if string(body) != want {
+		t.Fatalf("body = %s\nwant   %s", body, want)
+	}
+
+	bad := []byte(`{"a":1} trailing`)
+	if _, _, err := e.ApplyResponse(req, &http.Response{StatusCode: 200, Header: http.Header{}, Request: req}, bad); err == nil {
+		t.Fatal("trailing data should be rejected")
+	}
+}
+
+// TestRewriteRequest 测试请求阶段的URL、查询参数、请求头与正则替换
+func TestRewriteRequest(t *testing.T) {
+	e, _ := NewRewriteEngine("")
+	err := e.AddRule(&RewriteRule{
+		Enabled:     true,
+		Phase:       RewritePhaseRequest,
+		FlowMatcher: FlowMatcher{Method: "POST"},
+		Actions: []RewriteAction{
+			{Type: RewriteURL, Pattern: `^http://old\.test/`, Replacement: "http://new.test/v2/"},
+			{Type: RewriteSetQuery, Name: "debug", Value: "1"},
+			{Type: RewriteRemoveQuery, Name: "token"},
+			{Type: RewriteRemoveHeader, Name: "Cookie"},
+			{Type: RewriteReplaceBody, Pattern: `secret=\w+`, Replacement: "secret=xxx"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig := []byte("a=1&secret=abc")
+	req := httptest.NewRequest("POST", "http://old.test/login?token=t", bytes.NewReader(orig))
+	req.Header.Set("Cookie", "sid=1")
+	body, applied, err := e.ApplyRequest(req, orig)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("applied=%v err=%v", applied, err)
+	}
+	if got := req.URL.String(); got != "http://new.test/v2/login?debug=1" {
+		t.Fatalf("url = %s", got)
+	}
+	if req.Host != "new.test" || req.Header.Get("Cookie") != "" {
+		t.Fatalf("host=%s cookie=%s", req.Host, req.Header.Get("Cookie"))
+	}
+	if string(body) != "a=1&secret=xxx" || req.ContentLength != int64(len(body)) {
+		t.Fatalf("body = %s", body)
+	}
+
+	// GET 请求不命中
+	get := httptest.NewRequest("GET", "http://old.test/", nil)
+	if _, applied, _ := e.ApplyRequest(get, nil); len(applied) != 0 {
+		t.Fatalf("GET should not match, applied %v", applied)
+	}
+}
+
+// TestRewriteRuleValidation 测试非法规则被拒绝
+func TestRewriteRuleValidation(t *testing.T) {
+	e, _ := NewRewriteEngine("")
+	bad := []*RewriteRule{
+		{Phase: "both", Actions: []RewriteAction{{Type: RewriteRemoveHeader, Name: "a"}}},
+		{Phase: RewritePhaseRequest, Actions: []RewriteAction{{Type: RewriteSetStatus, StatusCode: 500}}},
+		{Phase: RewritePhaseResponse, Actions: []RewriteAction{{Type: RewriteJSONSet, Path: "a.b"}}},
+		{Phase: RewritePhaseResponse, Actions: []RewriteAction{{Type: "unknown"}}},
+		{Phase: RewritePhaseResponse},
+	}
+	for i, r := range bad {
+		if err := e.AddRule(r); err == nil {
+			t.Fatalf("rule %d should be rejected", i)
+		}
+	}
+}
+
+// TestRewriteEnginePersistence 测试规则保存后可重新加载且保持顺序
+func TestRewriteEnginePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	e, err := NewRewriteEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"first", "second"} {
+		err := e.AddRule(&RewriteRule{Name: name, Enabled: true, Actions: []RewriteAction{{Type: RewriteRemoveHeader, Name: "Server"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rules := e.Rules()
+	if err := e.ReplaceRules([]*RewriteRule{rules[1], rules[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("rules file mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	loaded, err := NewRewriteEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.Rules()
+	if len(got) != 2 || got[0].Name != "second" || got[1].Name != "first" {
+		t.Fatalf("unexpected rules after reload: %+v", got)
+	}
+}
+
+// TestRewriteEngineSaveFailure 测试规则写入失败时内存中的规则保持不变
+func TestRewriteEngineSaveFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	e, err := NewRewriteEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule := &RewriteRule{Name: "kept", Enabled: true, Actions: []RewriteAction{{Type: RewriteRemoveHeader, Name: "Server"}}}
+	if err := e.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// 规则文件的父目录被普通文件占用，后续写入都会失败
+	blocker := filepath.Join(t.TempDir(), "blocker")
+	if err := os.WriteFile(blocker, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	e.path = filepath.Join(blocker, "rules.json")
+
+	other := &RewriteRule{Name: "other", Enabled: true, Actions: []RewriteAction{{Type: RewriteRemoveHeader, Name: "Via"}}}
+	if err := e.AddRule(other); err == nil {
+		t.Fatal("add should fail")
+	}
+	if err := e.UpdateRule(rule.ID, other); err == nil {
+		t.Fatal("update should fail")
+	}
+	if err := e.RemoveRule(rule.ID); err == nil {
+		t.Fatal("remove should fail")
+	}
+	if got := e.Rules(); len(got) != 1 || got[0] != rule {
+		t.Fatalf("rules changed after failed saves: %+v", got)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// DefaultRulesDir 规则持久化目录，与 certs 一样相对运行目录
+func DefaultRulesDir() string {
+	return filepath.Clean("../data")
+}
+
+// loadJSONFile 从文件读取JSON，文件不存在时不报错
+func loadJSONFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// saveJSONFile 以临时文件+重命名的方式原子写入JSON
+func saveJSONFile(path string, v interface{}) error {
+	if path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 规则中可能包含上游代理与 SOCKS5 密码，只允许当前用户读写
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,176 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// 由服务端主动发出的流量来源
+const (
+	FlowSourceReplay   = "replay"
+	FlowSourceComposer = "composer"
+)
+
+// requestTimer 通过 httptrace 记录请求各阶段耗时
+type requestTimer struct {
+	mu                       sync.Mutex
+	start                    time.Time
+	dnsStart, dnsDone        time.Time
+	connectStart, connectEnd time.Time
+	tlsStart, tlsDone        time.Time
+	firstByte                time.Time
+	remoteAddr               string
+}
+
+func (t *requestTimer) trace() *httptrace.ClientTrace {
+	now := func(dst *time.Time) {
+		t.mu.Lock()
+		if dst.IsZero() {
+			*dst = time.Now()
+		}
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart:      func(string, string) { now(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { now(&t.connectEnd) },
+		TLSHandshakeStart: func() { now(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.remoteAddr = info.Conn.RemoteAddr().String()
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	}
+}
+
+// metrics 生成与代理一致的性能指标
+func (t *requestTimer) metrics(end time.Time) *models.PerformanceMetrics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := func(a, b time.Time) int64 {
+		if a.IsZero() || b.IsZero() {
+			return 0
+		}
+		return b.Sub(a).Milliseconds()
+	}
+	m := &models.PerformanceMetrics{
+		DNSLookupTime:    ms(t.dnsStart, t.dnsDone),
+		TCPConnectTime:   ms(t.connectStart, t.connectEnd),
+		TLSHandshakeTime: ms(t.tlsStart, t.tlsDone),
+		TTFB:             ms(t.start, t.firstByte),
+		TotalTime:        ms(t.start, end),
+	}
+	if !t.firstByte.IsZero() {
+		m.ContentTransferTime = ms(t.firstByte, end)
+	}
+	return m
+}
+
+// sendFlow 由服务端发出请求并记录为 Flow，填充与代理捕获相同的性能、TLS 与内容信息；
+// replayOf 为重放的原始 Flow ID，写入存储前就已设置
+func (p *EnhancedProxyServer) sendFlow(client *http.Client, req *http.Request, body []byte, source, replayOf string) *models.Flow {
+	timer := &requestTimer{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+
+	flow := &models.Flow{
+		ID:       uuid.NewString(),
+		Scheme:   req.URL.Scheme,
+		StartAt:  timer.start,
+		Request:  p.buildHTTPRequest(req),
+		Source:   source,
+		ReplayOf: replayOf,
+	}
+	flow.Request.Body = body
+	flow.Content = p.analyzeContent(body, req.Header)
+	if p.upstream != nil {
+		flow.Upstream = p.upstreamRoute(req.URL.Host)
+	}
+	p.store.Add(flow)
+
+	resp, err := client.Do(req)
+	var respBody []byte
+	if err == nil {
+		respBody, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	end := time.Now()
+	flow.EndAt = end
+	flow.LatencyMs = end.Sub(flow.StartAt).Milliseconds()
+	flow.Performance = timer.metrics(end)
+	flow.Network = p.sentNetworkInfo(req, timer.remoteAddr)
+
+	if resp != nil {
+		flow.Response = &models.HTTPResponse{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Headers:    models.CopyHeaders(resp.Header),
+			Body:       respBody,
+			Proto:      resp.Proto,
+			Length:     int(resp.ContentLength),
+		}
+		flow.Content = p.analyzeContent(respBody, resp.Header)
+		if flow.Scheme == "https" {
+			flow.TLS = p.collectTLSInfo(resp)
+		}
+	}
+	if err != nil {
+		flow.Error = sendErrorInfo(err)
+		p.errorCollector.RecordError(flow.ID, flow.Error.Type, flow.Error.Message, 0, flow.Error.IsTimeout, 0)
+	}
+
+	success := err == nil && resp.StatusCode < 400
+	p.networkMonitor.RecordRequest(flow.Request.Host, success, flow.LatencyMs, int64(len(respBody)))
+	p.CleanupFlow(flow.ID)
+	p.publishFlow(flow)
+	return flow
+}
+
+// sentNetworkInfo 服务端发出的请求以本机为客户端，记录实际连接的服务器地址
+func (p *EnhancedProxyServer) sentNetworkInfo(req *http.Request, remoteAddr string) *models.NetworkInfo {
+	info := &models.NetworkInfo{ClientIP: "127.0.0.1", IsLocalhost: true}
+	host, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = stripHostPort(req.URL.Host)
+	}
+	info.ServerIP = host
+	if port != "" {
+		info.ServerPort, _ = net.LookupPort("tcp", port)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		info.IsIPv6 = ip.To4() == nil
+		info.IsPrivate = ip.IsPrivate()
+		info.Country, info.Region, info.City, info.ISP, info.ASN = p.geoService.GetLocationInfo(host)
+	}
+	return info
+}
+
+// sendErrorInfo 将请求错误转换为 ErrorInfo
+func sendErrorInfo(err error) *models.ErrorInfo {
+	info := &models.ErrorInfo{Type: "network", Message: err.Error(), IsNetwork: true}
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()):
+		info.Type, info.IsTimeout = "timeout", true
+	case errors.As(err, &dnsErr):
+		info.Type, info.IsDNS = "dns", true
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		info.Type, info.IsTLS = "tls", true
+	}
+	return info
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 非 CONNECT 入口（SOCKS5、透明代理）按客户端首个数据识别的隧道内容
+const (
+	tunnelModeTLS  = "tls"  // TLS，按 MITM 策略处理
+	tunnelModeHTTP = "http" // 明文 HTTP，解析请求并记录
+	tunnelModeRaw  = "raw"  // 其他 TCP 流量，原样转发
+)
+
+// sniffTimeout 等待客户端首个数据的时间，超时视为服务端先发言的协议
+const sniffTimeout = 300 * time.Millisecond
+
+type tunnelModeKey struct{}
+
+// tunnelModeOf 返回非 CONNECT 入口合成的 CONNECT 请求的隧道类型，普通 CONNECT 返回空
+func tunnelModeOf(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	mode, _ := req.Context().Value(tunnelModeKey{}).(string)
+	return mode
+}
+
+// sniffTunnel 根据客户端首个数据判断隧道内容
+func sniffTunnel(conn net.Conn, br *bufio.Reader) string {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	_, err := br.Peek(1)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		return tunnelModeRaw
+	}
+	head, _ := br.Peek(br.Buffered())
+	switch {
+	case len(head) >= 2 && head[0] == 0x16 && head[1] == 0x03:
+		return tunnelModeTLS
+	case looksLikeHTTPRequest(head):
+		return tunnelModeHTTP
+	}
+	return tunnelModeRaw
+}
+
+var httpMethodPrefixes = [][]byte{
+	[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "),
+	[]byte("OPTIONS "), []byte("PATCH "), []byte("TRACE "),
+}
+
+func looksLikeHTTPRequest(b []byte) bool {
+	for _, m := range httpMethodPrefixes {
+		if bytes.HasPrefix(b, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveTunnel 将已识别的连接以 CONNECT 请求的形式交给代理，复用 MITM 策略、解密与 Flow 记录。
+// dst 非空时为透明代理的原始目标，上游连接固定发往该地址
+func (p *EnhancedProxyServer) serveTunnel(conn net.Conn, br *bufio.Reader, target, mode, dst string, handler http.Handler) {
+	req := &http.Request{
+		Method:     http.MethodConnect,
+		URL:        &url.URL{Host: target},
+		Host:       target,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+	ctx := context.WithValue(context.Background(), tunnelModeKey{}, mode)
+	if dst != "" {
+		ctx = withOriginalDst(ctx, dst)
+	}
+	sc := &sniffedConn{Conn: conn, r: br}
+	handler.ServeHTTP(&hijackWriter{conn: &clientConn{Conn: sc, onClose: p.checkHandshake}}, req.WithContext(ctx))
+}
+
+// sniffedConn 读取时先返回识别协议时缓冲的数据，写入时丢弃代理对 CONNECT 的应答头
+type sniffedConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	mu       sync.Mutex
+	answered bool
+	pending  []byte
+}
+
+func (c *sniffedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *sniffedConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	if c.answered {
+		c.mu.Unlock()
+		return c.Conn.Write(b)
+	}
+	c.pending = append(c.pending, b...)
+	i := bytes.Index(c.pending, []byte("\r\n\r\n"))
+	if i < 0 {
+		c.mu.Unlock()
+		return len(b), nil
+	}
+	rest := c.pending[i+4:]
+	c.answered, c.pending = true, nil
+	c.mu.Unlock()
+	if len(rest) > 0 {
+		if _, err := c.Conn.Write(rest); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// hijackWriter 供 goproxy 接管连接的 ResponseWriter
+type hijackWriter struct {
+	conn   net.Conn
+	header http.Header
+}
+
+func (w *hijackWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *hijackWriter) Write(b []byte) (int, error) { return w.conn.Write(b) }
+
+func (w *hijackWriter) WriteHeader(int) {}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
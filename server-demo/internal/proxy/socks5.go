@@ -0,0 +1,368 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"probe/internal/models"
+)
+
+// SOCKS5Config SOCKS5 监听配置，Addr 为空时不启用
+type SOCKS5Config struct {
+	Addr     string `json:"addr"`
+	Username string `json:"username,omitempty"` // 设置后要求用户名密码认证
+	Password string `json:"password,omitempty"`
+}
+
+// TunnelUDP UDP ASSOCIATE 转发的数据流
+const TunnelUDP = "udp"
+
+const (
+	socksVersion      = 5
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAuthNoAccept = 0xff
+
+	socksCmdConnect      = 1
+	socksCmdUDPAssociate = 3
+
+	socksAtypIPv4   = 1
+	socksAtypDomain = 3
+	socksAtypIPv6   = 4
+
+	socksRepSuccess         = 0
+	socksRepGeneralFailure  = 1
+	socksRepNotAllowed      = 2
+	socksRepCmdNotSupported = 7
+	socksRepAtypUnsupported = 8
+)
+
+// serveSOCKS5 接受 SOCKS5 连接，TCP 隧道交给 handler（goproxy）按 CONNECT 处理
+func (p *EnhancedProxyServer) serveSOCKS5(ln net.Listener, cfg SOCKS5Config, handler http.Handler) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handleSOCKS5(conn, cfg, handler)
+	}
+}
+
+func (p *EnhancedProxyServer) handleSOCKS5(conn net.Conn, cfg SOCKS5Config, handler http.Handler) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	br := bufio.NewReader(conn)
+	if err := socksNegotiate(br, conn, cfg); err != nil {
+		conn.Close()
+		return
+	}
+	cmd, target, err := socksReadRequest(br)
+	if err != nil {
+		var rep socksReplyError
+		if errors.As(err, &rep) {
+			socksReply(conn, byte(rep), nil)
+		}
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	switch cmd {
+	case socksCmdConnect:
+		p.socksConnect(conn, br, target, handler)
+	case socksCmdUDPAssociate:
+		p.socksUDPAssociate(conn, br)
+	default:
+		socksReply(conn, socksRepCmdNotSupported, nil)
+		conn.Close()
+	}
+}
+
+// socksNegotiate 协商认证方式，配置了用户名时要求用户名密码认证（RFC 1929）
+func socksNegotiate(br *bufio.Reader, conn net.Conn, cfg SOCKS5Config) error {
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return err
+	}
+	if head[0] != socksVersion {
+		return errors.New("unsupported socks version")
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(br, methods); err != nil {
+		return err
+	}
+	want := byte(socksAuthNone)
+	if cfg.Username != "" {
+		want = socksAuthPassword
+	}
+	if bytes.IndexByte(methods, want) < 0 {
+		conn.Write([]byte{socksVersion, socksAuthNoAccept})
+		return errors.New("no acceptable socks auth method")
+	}
+	if _, err := conn.Write([]byte{socksVersion, want}); err != nil {
+		return err
+	}
+	if want == socksAuthNone {
+		return nil
+	}
+
+	// VER ULEN UNAME PLEN PASSWD
+	ver, err := br.ReadByte()
+	if err != nil || ver != 1 {
+		return errors.New("invalid socks auth request")
+	}
+	user, err := readLenPrefixed(br)
+	if err != nil {
+		return err
+	}
+	pass, err := readLenPrefixed(br)
+	if err != nil {
+		return err
+	}
+	ok := subtle.ConstantTimeCompare(user, []byte(cfg.Username)) == 1 &&
+		subtle.ConstantTimeCompare(pass, []byte(cfg.Password)) == 1
+	if !ok {
+		conn.Write([]byte{1, 1})
+		return errors.New("socks authentication failed")
+	}
+	_, err = conn.Write([]byte{1, 0})
+	return err
+}
+
+func readLenPrefixed(br *bufio.Reader) ([]byte, error) {
+	n, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	_, err = io.ReadFull(br, b)
+	return b, err
+}
+
+// socksReplyError 需要回复给客户端的错误码
+type socksReplyError byte
+
+func (e socksReplyError) Error() string {
+	return "socks request failed with code " + strconv.Itoa(int(e))
+}
+
+// socksReadRequest 读取请求：VER CMD RSV ATYP DST.ADDR DST.PORT
+func socksReadRequest(br *bufio.Reader) (byte, string, error) {
+	head := make([]byte, 3)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return 0, "", err
+	}
+	if head[0] != socksVersion {
+		return 0, "", errors.New("unsupported socks version")
+	}
+	target, err := socksReadAddr(br)
+	if err != nil {
+		return 0, "", err
+	}
+	return head[1], target, nil
+}
+
+// socksReadAddr 读取 ATYP DST.ADDR DST.PORT，返回 host:port
+func socksReadAddr(r io.Reader) (string, error) {
+	atyp := make([]byte, 1)
+	if _, err := io.ReadFull(r, atyp); err != nil {
+		return "", err
+	}
+	var host string
+	switch atyp[0] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip := make([]byte, net.IPv4len)
+		if atyp[0] == socksAtypIPv6 {
+			ip = make([]byte, net.IPv6len)
+		}
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socksAtypDomain:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(r, n); err != nil {
+			return "", err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return "", err
+		}
+		host = string(name)
+	default:
+		return "", socksReplyError(socksRepAtypUnsupported)
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// socksAppendAddr 按 SOCKS5 格式追加地址
+func socksAppendAddr(b []byte, addr net.Addr) []byte {
+	ip, port := net.IPv4zero, 0
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = a.IP, a.Port
+	case *net.UDPAddr:
+		ip, port = a.IP, a.Port
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		b = append(append(b, socksAtypIPv4), ip4...)
+	} else {
+		b = append(append(b, socksAtypIPv6), ip.To16()...)
+	}
+	return binary.BigEndian.AppendUint16(b, uint16(port))
+}
+
+func socksReply(conn net.Conn, rep byte, bind net.Addr) error {
+	_, err := conn.Write(socksAppendAddr([]byte{socksVersion, rep, 0}, bind))
+	return err
+}
+
+// socksConnect 处理 CONNECT：先应答成功，再识别隧道内容交给代理
+func (p *EnhancedProxyServer) socksConnect(conn net.Conn, br *bufio.Reader, target string, handler http.Handler) {
+	if err := socksReply(conn, socksRepSuccess, conn.LocalAddr()); err != nil {
+		conn.Close()
+		return
+	}
+	p.serveTunnel(conn, br, target, sniffTunnel(conn, br), "", handler)
+}
+
+// socksUDPAssociate 处理 UDP ASSOCIATE：在本地端口转发数据报，按目标地址记录 Flow，
+// 控制连接关闭时结束转发
+func (p *EnhancedProxyServer) socksUDPAssociate(conn net.Conn, br *bufio.Reader) {
+	defer conn.Close()
+	local := conn.LocalAddr().(*net.TCPAddr)
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: local.IP})
+	if err != nil {
+		socksReply(conn, socksRepGeneralFailure, nil)
+		return
+	}
+	if err := socksReply(conn, socksRepSuccess, pc.LocalAddr()); err != nil {
+		pc.Close()
+		return
+	}
+	clientIP := conn.RemoteAddr().(*net.TCPAddr).IP
+	relay := &udpRelay{p: p, pc: pc, clientIP: clientIP, clientAddr: conn.RemoteAddr().String(), flows: make(map[string]*udpFlow)}
+	go func() {
+		io.Copy(io.Discard, br)
+		pc.Close()
+	}()
+	relay.run()
+}
+
+// udpFlow 单个目标地址的 UDP 数据流
+type udpFlow struct {
+	flow           *models.Flow
+	addr           *net.UDPAddr
+	sent, received int64
+	rejected       bool
+}
+
+// udpRelay SOCKS5 UDP 转发
+type udpRelay struct {
+	p          *EnhancedProxyServer
+	pc         *net.UDPConn
+	clientIP   net.IP
+	clientAddr string
+	client     *net.UDPAddr // 客户端首个数据报的来源地址
+	flows      map[string]*udpFlow
+}
+
+func (r *udpRelay) run() {
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := r.pc.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		if from.IP.Equal(r.clientIP) && (r.client == nil || from.Port == r.client.Port) {
+			r.client = from
+			r.fromClient(buf[:n])
+		} else {
+			r.fromRemote(from, buf[:n])
+		}
+	}
+	for _, f := range r.flows {
+		r.p.finishTunnelFlow(f.flow, f.sent, f.received, nil)
+	}
+}
+
+// fromClient 解析 RSV(2) FRAG ATYP DST.ADDR DST.PORT DATA 并发往目标，不支持分片
+func (r *udpRelay) fromClient(b []byte) {
+	if len(b) < 4 || b[2] != 0 {
+		return
+	}
+	rd := bytes.NewReader(b[3:])
+	target, err := socksReadAddr(rd)
+	if err != nil {
+		return
+	}
+	data := b[len(b)-rd.Len():]
+	f := r.flows[target]
+	if f == nil {
+		f = r.newFlow(target)
+		r.flows[target] = f
+	}
+	if f.rejected || f.addr == nil {
+		return
+	}
+	if n, err := r.pc.WriteToUDP(data, f.addr); err == nil {
+		f.sent += int64(n)
+	}
+}
+
+func (r *udpRelay) newFlow(target string) *udpFlow {
+	req := &http.Request{Method: http.MethodConnect, Host: target, URL: &url.URL{Host: target}, Header: make(http.Header), RemoteAddr: r.clientAddr}
+	req = req.WithContext(context.WithValue(context.Background(), tunnelModeKey{}, TunnelUDP))
+	action, ruleID := r.p.decideTunnel(stripHostPort(target), false)
+	mode := TunnelUDP
+	if action == TunnelReject {
+		mode = TunnelReject
+	}
+	f := &udpFlow{flow: r.p.newTunnelFlow(req, target, mode, ruleID), rejected: action == TunnelReject}
+	if f.rejected {
+		return f
+	}
+	addr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		info := sendErrorInfo(err)
+		r.p.store.Update(f.flow.ID, func(flow *models.Flow) { flow.Error = info })
+		return f
+	}
+	f.addr = addr
+	return f
+}
+
+// fromRemote 将目标返回的数据报加上来源地址转给客户端
+func (r *udpRelay) fromRemote(from *net.UDPAddr, data []byte) {
+	if r.client == nil {
+		return
+	}
+	var f *udpFlow
+	for _, candidate := range r.flows {
+		if candidate.addr != nil && candidate.addr.IP.Equal(from.IP) && candidate.addr.Port == from.Port {
+			f = candidate
+			break
+		}
+	}
+	if f == nil {
+		return
+	}
+	packet := socksAppendAddr([]byte{0, 0, 0}, from)
+	packet = append(packet, data...)
+	if _, err := r.pc.WriteToUDP(packet, r.client); err == nil {
+		f.received += int64(len(data))
+	}
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	xproxy "golang.org/x/net/proxy"
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// startSOCKS5Proxy 启动带 SOCKS5 监听的代理，返回 SOCKS5 地址
+func startSOCKS5Proxy(t *testing.T, cfg SOCKS5Config) (*EnhancedProxyServer, storage.FlowStorage, string) {
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "127.0.0.1:0", false, store)
+	cfg.Addr = "127.0.0.1:0"
+	p.SetSOCKS5(cfg)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	return p, store, p.socksLn.Addr().String()
+}
+
+// waitFlow 等待满足条件的 Flow 出现
+func waitFlow(t *testing.T, store storage.FlowStorage, match func(*models.Flow) bool) *models.Flow {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, f := range store.GetAll(0) {
+			if match(f) {
+				return f
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("flow not recorded")
+	return nil
+}
+
+// TestStartListenError 测试 SOCKS5 端口被占用时 Start 返回错误并释放已监听的 HTTP 端口
+func TestStartListenError(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+
+	p := newTestProxy(t, addr, false, storage.NewMemoryFlowStore())
+	p.SetSOCKS5(SOCKS5Config{Addr: busy.Addr().String()})
+	if err := p.Start(); err == nil {
+		p.Stop()
+		t.Fatal("start should fail when the SOCKS5 port is in use")
+	}
+	if p.IsRunning() {
+		t.Fatal("proxy should not be running after a failed start")
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("HTTP listener should be closed: %v", err)
+	}
+	ln.Close()
+}
+
+// TestSOCKS5HTTPCapture 测试认证与隧道内明文 HTTP 的捕获
+func TestSOCKS5HTTPCapture(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer target.Close()
+	_, store, addr := startSOCKS5Proxy(t, SOCKS5Config{Username: "u", Password: "p"})
+
+	bad, _ := xproxy.SOCKS5("tcp", addr, &xproxy.Auth{User: "u", Password: "wrong"}, xproxy.Direct)
+	if conn, err := bad.Dial("tcp", strings.TrimPrefix(target.URL, "http://")); err == nil {
+		conn.Close()
+		t.Fatal("wrong password should be rejected")
+	}
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(&url.URL{Scheme: "socks5", User: url.UserPassword("u", "p"), Host: addr})}}
+	for _, path := range []string{"/a", "/b"} {
+		resp, err := client.Get(target.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "hello "+path {
+			t.Fatalf("unexpected body %q", body)
+		}
+	}
+	// 同一隧道内的后续请求同样补全地址
+	waitFlow(t, store, func(f *models.Flow) bool {
+		return f.Request.URL == target.URL+"/b" && f.Response != nil
+	})
+}
+
+// TestSOCKS5RawTunnel 测试非 HTTP/TLS 流量透传并记录字节数
+func TestSOCKS5RawTunnel(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(conn, conn)
+		conn.Close()
+	}()
+	_, store, addr := startSOCKS5Proxy(t, SOCKS5Config{})
+
+	dialer, _ := xproxy.SOCKS5("tcp", addr, nil, xproxy.Direct)
+	conn, err := dialer.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(conn, "ping\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Fatalf("echo failed: %q %v", line, err)
+	}
+	conn.Close()
+
+	flow := waitFlow(t, store, func(f *models.Flow) bool {
+		return f.Tunnel != nil && !f.EndAt.IsZero()
+	})
+	if flow.Scheme != "tcp" || flow.Tunnel.Mode != TunnelPassthrough || flow.Tunnel.BytesSent != 5 || flow.Tunnel.BytesReceived != 5 {
+		t.Fatalf("unexpected tunnel flow: %s %+v", flow.Scheme, flow.Tunnel)
+	}
+}
+
+// TestSOCKS5UDPAssociate 测试 UDP 转发与按目标记录 Flow
+func TestSOCKS5UDPAssociate(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := echo.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(buf[:n], from)
+		}
+	}()
+	_, store, addr := startSOCKS5Proxy(t, SOCKS5Config{})
+
+	ctrl, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(ctrl)
+	ctrl.Write([]byte{socksVersion, 1, socksAuthNone})
+	if _, err := io.ReadFull(br, make([]byte, 2)); err != nil {
+		t.Fatal(err)
+	}
+	ctrl.Write(socksAppendAddr([]byte{socksVersion, socksCmdUDPAssociate, 0}, &net.UDPAddr{IP: net.IPv4zero}))
+	reply := make([]byte, 3)
+	if _, err := io.ReadFull(br, reply); err != nil || reply[1] != socksRepSuccess {
+		t.Fatalf("udp associate failed: %v %v", reply, err)
+	}
+	bind, err := socksReadAddr(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uc, err := net.Dial("udp", bind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uc.Close()
+	packet := append(socksAppendAddr([]byte{0, 0, 0}, echo.LocalAddr()), "ping"...)
+	uc.Write(packet)
+	uc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := uc.Read(buf)
+	if err != nil || string(buf[:n]) != string(packet) {
+		t.Fatalf("unexpected udp reply %q %v", buf[:n], err)
+	}
+	ctrl.Close()
+
+	flow := waitFlow(t, store, func(f *models.Flow) bool {
+		return f.Tunnel != nil && !f.EndAt.IsZero()
+	})
+	if flow.Scheme != "udp" || flow.Tunnel.Mode != TunnelUDP || flow.Tunnel.BytesSent != 4 || flow.Tunnel.BytesReceived != 4 {
+		t.Fatalf("unexpected udp flow: %s %+v", flow.Scheme, flow.Tunnel)
+	}
+}
@@ -0,0 +1,366 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"probe/internal/models"
+)
+
+// MaxStreamEvents 每个 Flow 保留的 SSE 事件数上限
+const MaxStreamEvents = 1000
+
+// maxSSELineLength 单行超过该长度的部分不再记录
+const maxSSELineLength = 1 << 20
+
+var errStreamClosed = errors.New("stream closed before completion")
+
+// StreamConfig 流式响应的捕获上限
+type StreamConfig struct {
+	MemoryLimit int64  // 内存中保留的字节数，也是缓冲读取的响应大小上限
+	DiskLimit   int64  // 捕获的总字节数上限，超出内存上限的部分写入磁盘；不大于 MemoryLimit 时不写磁盘
+	Dir         string // 磁盘文件目录
+}
+
+// DefaultStreamConfig 默认内存 1MB、总计 64MB
+func DefaultStreamConfig() StreamConfig {
+	return StreamConfig{
+		MemoryLimit: 1 << 20,
+		DiskLimit:   64 << 20,
+		Dir:         filepath.Join(os.TempDir(), "probe-streams"),
+	}
+}
+
+// withDefaults 未设置的字段使用默认值
+func (c StreamConfig) withDefaults() StreamConfig {
+	def := DefaultStreamConfig()
+	if c.MemoryLimit <= 0 {
+		c.MemoryLimit = def.MemoryLimit
+	}
+	if c.DiskLimit == 0 {
+		c.DiskLimit = def.DiskLimit
+	}
+	if c.Dir == "" {
+		c.Dir = def.Dir
+	}
+	return c
+}
+
+// captureLimit 捕获的总字节数上限
+func (c StreamConfig) captureLimit() int64 {
+	if c.DiskLimit > c.MemoryLimit {
+		return c.DiskLimit
+	}
+	return c.MemoryLimit
+}
+
+// isEventStream 判断响应是否为 text/event-stream
+func isEventStream(h http.Header) bool {
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mt == "text/event-stream"
+}
+
+// shouldStream 判断响应是否边转发边捕获：SSE、长度未知或超过内存上限的响应。
+// 响应阶段的改写与断点需要完整消息体，命中时仍缓冲读取；故障注入在流式读取中进行
+func (p *EnhancedProxyServer) shouldStream(flow *models.Flow, req *http.Request, resp *http.Response, state *proxyCtxData) bool {
+	if resp.Body == nil || resp.Body == http.NoBody || req.Method == http.MethodHead {
+		return false
+	}
+	if !isEventStream(resp.Header) && resp.ContentLength >= 0 && resp.ContentLength <= p.stream.MemoryLimit {
+		return false
+	}
+	if p.rewriter != nil && len(p.rewriter.matching(RewritePhaseResponse, req, resp.Header.Get("Content-Type"), resp.StatusCode)) > 0 {
+		return false
+	}
+	return p.breakpoints.Match(BreakpointPhaseResponse, flow.Request.Method, req.URL.Host, flow.Request.Path) == nil
+}
+
+// startStream 记录响应头并以捕获器替换消息体，Flow 在流结束前标记为传输中。
+// Flow 在此写回存储，之后的捕获进度由捕获器通过存储更新
+func (p *EnhancedProxyServer) startStream(flow *models.Flow, resp *http.Response) {
+	flow.Response = &models.HTTPResponse{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Headers:    models.CopyHeaders(resp.Header),
+		Proto:      resp.Proto,
+		Length:     int(resp.ContentLength),
+	}
+	flow.Stream = &models.StreamInfo{}
+	flow.InProgress = true
+	p.publishFlow(flow)
+	s := &streamCapture{
+		p:      p,
+		flow:   flow,
+		body:   resp.Body,
+		header: resp.Header.Clone(),
+		cfg:    p.stream,
+		start:  time.Now(),
+	}
+	if isEventStream(resp.Header) {
+		if enc := resp.Header.Get("Content-Encoding"); enc == "" || enc == "identity" {
+			s.sse = &sseParser{}
+		}
+	} else {
+		// 让 goproxy 逐块刷新给客户端，而不是在缓冲区写满后才发送
+		resp.Header.Set("Transfer-Encoding", "chunked")
+	}
+	resp.Body = s
+}
+
+// streamCapture 转发消息体的同时捕获内容，超出内存上限后写入磁盘
+type streamCapture struct {
+	p      *EnhancedProxyServer
+	flow   *models.Flow
+	body   io.ReadCloser
+	header http.Header
+	cfg    StreamConfig
+	start  time.Time
+	sse    *sseParser
+
+	mu   sync.Mutex // 保护 info 与 mem，并保证进度按顺序写入存储
+	info models.StreamInfo
+	mem  []byte
+	file *os.File
+	once sync.Once
+}
+
+func (s *streamCapture) Read(b []byte) (int, error) {
+	n, err := s.body.Read(b)
+	if n > 0 {
+		s.capture(b[:n])
+	}
+	if err == io.EOF {
+		s.finish(nil)
+	} else if err != nil {
+		s.finish(err)
+	}
+	return n, err
+}
+
+// Close 在读到结尾前关闭表示客户端断开或上游中断
+func (s *streamCapture) Close() error {
+	err := s.body.Close()
+	s.finish(errStreamClosed)
+	return err
+}
+
+func (s *streamCapture) capture(b []byte) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.publishLocked(nil)
+	info := &s.info
+	info.Size += int64(len(b))
+	if s.sse != nil {
+		for _, ev := range s.sse.feed(b, now) {
+			info.EventCount++
+			ev.Seq = info.EventCount
+			info.Events = append(info.Events, ev)
+			if len(info.Events) > MaxStreamEvents {
+				info.Events = info.Events[len(info.Events)-MaxStreamEvents:]
+			}
+		}
+	}
+
+	if room := s.cfg.captureLimit() - info.Captured; int64(len(b)) > room {
+		b, info.Truncated = b[:max(room, 0)], true
+	}
+	if len(b) == 0 {
+		return
+	}
+	if s.file == nil {
+		n := min(int64(len(b)), s.cfg.MemoryLimit-int64(len(s.mem)))
+		s.mem = append(s.mem, b[:n]...)
+		info.Captured += n
+		if b = b[n:]; len(b) == 0 {
+			return
+		}
+		if err := s.spill(); err != nil {
+			info.Truncated, info.Error = true, err.Error()
+			s.cfg.DiskLimit = 0
+			return
+		}
+		info.SpillFile = s.file.Name()
+	}
+	if _, err := s.file.Write(b); err != nil {
+		info.Truncated, info.Error = true, err.Error()
+		s.cfg.DiskLimit = 0
+		return
+	}
+	info.Captured += int64(len(b))
+}
+
+// spill 创建磁盘文件并写入内存中已捕获的内容；正文可能含有凭据，目录与文件只允许当前用户访问，
+// 且不复用已存在的文件
+func (s *streamCapture) spill() error {
+	if err := os.MkdirAll(s.cfg.Dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.cfg.Dir, s.flow.ID+".body"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(s.mem); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+// finish 流结束时补全 Flow，仅执行一次
+func (s *streamCapture) finish(err error) {
+	s.once.Do(func() {
+		end := time.Now()
+		s.mu.Lock()
+		info := &s.info
+		if s.file != nil {
+			s.file.Close()
+		}
+		info.DurationMs = end.Sub(s.start).Milliseconds()
+		if err != nil && info.Error == "" {
+			info.Error = err.Error()
+		}
+		var perf *models.PerformanceMetrics
+		if s.flow.Performance != nil {
+			cp := *s.flow.Performance
+			cp.ContentTransferTime = info.DurationMs
+			cp.TotalTime = end.Sub(s.flow.StartAt).Milliseconds()
+			perf = &cp
+		}
+		content := s.p.analyzeContent(s.mem, s.header)
+		stored := s.publishLocked(func(f *models.Flow) {
+			f.EndAt = end
+			if perf != nil {
+				f.Performance = perf
+			}
+			f.Content = content
+			f.InProgress = false
+		})
+		// 传输期间 Flow 已被清空或淘汰，没有记录再引用磁盘文件
+		if !stored && s.file != nil {
+			os.Remove(s.file.Name())
+		}
+		size := info.Size
+		s.mu.Unlock()
+
+		success := s.flow.Response.StatusCode < 400 && err == nil
+		s.p.networkMonitor.RecordRequest(s.flow.Request.Host, success, s.flow.LatencyMs, size)
+	})
+}
+
+// publishLocked 将捕获进度的快照写入存储中的 Flow，fn 可补充其他字段，Flow 已不在存储中时返回 false；
+// 调用方需持有 s.mu
+func (s *streamCapture) publishLocked(fn func(f *models.Flow)) bool {
+	info := s.info
+	info.Events = append([]*models.SSEEvent(nil), s.info.Events...)
+	body := s.mem
+	return s.p.store.Update(s.flow.ID, func(f *models.Flow) {
+		f.Stream = &info
+		if f.Response != nil {
+			resp := *f.Response
+			resp.Body = body
+			f.Response = &resp
+		}
+		if fn != nil {
+			fn(f)
+		}
+	})
+}
+
+// sseParser 增量解析 text/event-stream（WHATWG HTML 规范 9.2.6）
+type sseParser struct {
+	line    []byte
+	lastCR  bool
+	lastID  string // 事件 ID 在后续事件中沿用
+	event   string
+	data    []string
+	hasData bool
+	retry   int
+}
+
+// feed 解析一段字节，返回其中完成的事件
+func (p *sseParser) feed(b []byte, now time.Time) []*models.SSEEvent {
+	var events []*models.SSEEvent
+	for _, c := range b {
+		if p.lastCR {
+			p.lastCR = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\r', '\n':
+			p.lastCR = c == '\r'
+			if ev := p.processLine(now); ev != nil {
+				events = append(events, ev)
+			}
+		default:
+			if len(p.line) < maxSSELineLength {
+				p.line = append(p.line, c)
+			}
+		}
+	}
+	return events
+}
+
+func (p *sseParser) processLine(now time.Time) *models.SSEEvent {
+	line := string(p.line)
+	p.line = p.line[:0]
+	if line == "" {
+		return p.dispatch(now)
+	}
+	if line[0] == ':' {
+		return nil
+	}
+	field, value, found := strings.Cut(line, ":")
+	if found {
+		value = strings.TrimPrefix(value, " ")
+	}
+	switch field {
+	case "event":
+		p.event = value
+	case "data":
+		p.data = append(p.data, value)
+		p.hasData = true
+	case "id":
+		if !strings.ContainsRune(value, 0) {
+			p.lastID = value
+		}
+	case "retry":
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			p.retry = n
+		}
+	}
+	return nil
+}
+
+// dispatch 空行结束一个事件，没有 data 字段的事件被忽略
+func (p *sseParser) dispatch(now time.Time) *models.SSEEvent {
+	defer func() {
+		p.event, p.data, p.hasData, p.retry = "", nil, false, 0
+	}()
+	if !p.hasData {
+		return nil
+	}
+	ev := &models.SSEEvent{
+		ID:        p.lastID,
+		Event:     p.event,
+		Data:      strings.Join(p.data, "\n"),
+		Retry:     p.retry,
+		Timestamp: now,
+	}
+	if ev.Event == "" {
+		ev.Event = "message"
+	}
+	return ev
+}
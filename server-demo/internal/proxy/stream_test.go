@@ -0,0 +1,256 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// TestSSEParser 测试换行符、注释、多行 data、ID 沿用与跨块解析
+func TestSSEParser(t *testing.T) {
+	p := &sseParser{}
+	now := time.Now()
+	input := ": comment\r\nid: 1\r\nevent: update\r\ndata: a\r\ndata:b\r\n\r\nretry: 500\ndata: c\n\nevent: empty\n\nda"
+	events := p.feed([]byte(input), now)
+	events = append(events, p.feed([]byte("ta: d\r\r"), now)...)
+	want := []models.SSEEvent{
+		{ID: "1", Event: "update", Data: "a\nb"},
+		{ID: "1", Event: "message", Data: "c", Retry: 500},
+		{ID: "1", Event: "message", Data: "d"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %d", len(want), len(events))
+	}
+	for i, ev := range events {
+		if ev.ID != want[i].ID || ev.Event != want[i].Event || ev.Data != want[i].Data || ev.Retry != want[i].Retry {
+			t.Fatalf("event %d: got %+v, want %+v", i, *ev, want[i])
+		}
+	}
+}
+
+// newStreamProxy 启动代理并返回经代理访问的客户端
+func newStreamProxy(t *testing.T, cfg StreamConfig) (*EnhancedProxyServer, storage.FlowStorage, *http.Client) {
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "127.0.0.1:0", false, store)
+	p.SetStreamConfig(cfg)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	proxyURL, _ := url.Parse("http://" + p.srv.Addr)
+	return p, store, &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+}
+
+// TestStreamingSSE 测试 SSE 事件在上游结束前即送达客户端，并逐条记录
+func TestStreamingSSE(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: token\ndata: hello\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: bye\n\n")
+	}))
+	defer server.Close()
+	defer close(release)
+
+	_, store, client := newStreamProxy(t, StreamConfig{})
+	resp, err := client.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	br := bufio.NewReader(resp.Body)
+	for _, want := range []string{"event: token\n", "data: hello\n", "\n"} {
+		if line, err := br.ReadString('\n'); err != nil || line != want {
+			t.Fatalf("expected %q before upstream finished, got %q %v", want, line, err)
+		}
+	}
+
+	flow := waitFlow(t, store, func(f *models.Flow) bool { return f.Stream != nil && f.Stream.EventCount == 1 })
+	if !flow.InProgress {
+		t.Fatal("flow should be in progress while streaming")
+	}
+	release <- struct{}{}
+	rest, _ := io.ReadAll(br)
+	if string(rest) != "data: bye\n\n" {
+		t.Fatalf("unexpected tail %q", rest)
+	}
+
+	flow = waitFlow(t, store, func(f *models.Flow) bool { return !f.InProgress })
+	events := flow.Stream.Events
+	if len(events) != 2 || events[0].Event != "token" || events[0].Data != "hello" || events[1].Data != "bye" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events[1].Timestamp.Before(events[0].Timestamp) || flow.Stream.Error != "" {
+		t.Fatalf("unexpected stream info: %+v", flow.Stream)
+	}
+	if string(flow.Response.Body) != "event: token\ndata: hello\n\ndata: bye\n\n" {
+		t.Fatalf("unexpected captured body %q", flow.Response.Body)
+	}
+}
+
+// TestStreamingSpill 测试超出内存上限的部分写入磁盘，超出总上限后截断
+func TestStreamingSpill(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 分块发送，长度未知
+		for i := 0; i < 10; i++ {
+			w.Write(payload[i*100 : (i+1)*100])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	_, store, client := newStreamProxy(t, StreamConfig{MemoryLimit: 256, DiskLimit: 700, Dir: t.TempDir()})
+	resp, err := client.Get(server.URL + "/download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, payload) {
+		t.Fatalf("client received %d bytes, want %d", len(body), len(payload))
+	}
+
+	flow := waitFlow(t, store, func(f *models.Flow) bool { return f.Stream != nil && !f.InProgress })
+	info := flow.Stream
+	if info.Size != 1000 || info.Captured != 700 || !info.Truncated {
+		t.Fatalf("unexpected stream info: %+v", info)
+	}
+	if !bytes.Equal(flow.Response.Body, payload[:256]) {
+		t.Fatalf("memory capture should hold the first 256 bytes, got %d", len(flow.Response.Body))
+	}
+	spilled, err := os.ReadFile(info.SpillFile)
+	if err != nil || !bytes.Equal(spilled, payload[:700]) {
+		t.Fatalf("spill file should hold the first 700 bytes, got %d %v", len(spilled), err)
+	}
+	fi, err := os.Stat(info.SpillFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("spill file mode = %v, want 0600", fi.Mode().Perm())
+	}
+
+	// 长度已知且在内存上限内的响应仍缓冲读取
+	small := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		w.Write([]byte("small"))
+	}))
+	defer small.Close()
+	resp, err = client.Get(small.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	flow = waitFlow(t, store, func(f *models.Flow) bool {
+		return f.Response != nil && strings.HasPrefix(f.Request.URL, small.URL)
+	})
+	if flow.Stream != nil || string(flow.Response.Body) != "small" {
+		t.Fatalf("small response should be buffered: %+v", flow.Stream)
+	}
+
+	// 传输期间 Flow 被清空：流结束后删除磁盘文件
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload[:300])
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write(payload[300:])
+	}))
+	defer slow.Close()
+	resp, err = client.Get(slow.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadFull(resp.Body, make([]byte, 300))
+	flow = waitFlow(t, store, func(f *models.Flow) bool {
+		return f.Stream != nil && f.Stream.SpillFile != "" && strings.HasPrefix(f.Request.URL, slow.URL)
+	})
+	store.Clear()
+	close(release)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(flow.Stream.SpillFile); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("spill file of a removed flow should be deleted")
+}
+
+// TestStreamingFault 测试流式响应中的截断与断开故障，Flow 记录客户端实际收到的内容
+func TestStreamingFault(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 10; i++ {
+			w.Write(payload[i*100 : (i+1)*100])
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer server.Close()
+
+	faults, _ := NewFaultManager("")
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "127.0.0.1:0", false, store)
+	p.SetStreamConfig(StreamConfig{})
+	p.SetFaultManager(faults)
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	proxyURL, _ := url.Parse("http://" + p.srv.Addr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}, Timeout: 10 * time.Second}
+
+	if err := faults.AddRule(&FaultRule{Enabled: true, Fault: FaultTruncate, AfterBytes: 300, FlowMatcher: FlowMatcher{Path: "/truncate"}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL + "/truncate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || !bytes.Equal(body, payload[:300]) {
+		t.Fatalf("truncate: got %d bytes, %v", len(body), err)
+	}
+	flow := waitFlow(t, store, func(f *models.Flow) bool {
+		return !f.InProgress && f.Stream != nil && strings.HasSuffix(f.Request.URL, "/truncate")
+	})
+	if flow.Error == nil || flow.Error.Type != FaultErrorType || !bytes.Equal(flow.Response.Body, payload[:300]) {
+		t.Fatalf("truncate flow: %+v %d bytes", flow.Error, len(flow.Response.Body))
+	}
+
+	if err := faults.AddRule(&FaultRule{Enabled: true, Fault: FaultReset, AfterBytes: 200, FlowMatcher: FlowMatcher{Path: "/reset"}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = client.Get(server.URL + "/reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || len(body) > 200 {
+		t.Fatalf("reset: got %d bytes, err %v", len(body), err)
+	}
+	flow = waitFlow(t, store, func(f *models.Flow) bool {
+		return !f.InProgress && f.Stream != nil && strings.HasSuffix(f.Request.URL, "/reset")
+	})
+	if flow.Error == nil || flow.Error.Type != FaultErrorType {
+		t.Fatalf("reset flow error: %+v", flow.Error)
+	}
+}
@@ -0,0 +1,585 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultThrottleFile 网络模拟配置默认持久化文件
+func DefaultThrottleFile() string {
+	return filepath.Join(DefaultRulesDir(), "throttle.json")
+}
+
+var (
+	ErrThrottleRuleNotFound = errors.New("throttle rule not found")
+	ErrThrottleProfile      = errors.New("unknown throttle profile")
+	errThrottleDrop         = errors.New("connection dropped by network simulation")
+)
+
+// ThrottleProfile 网络条件配置，带宽为 0 表示不限速
+type ThrottleProfile struct {
+	Name         string  `json:"name"`
+	DownloadKbps int     `json:"download_kbps"` // 下行带宽(kbit/s)
+	UploadKbps   int     `json:"upload_kbps"`   // 上行带宽(kbit/s)
+	LatencyMs    int     `json:"latency_ms"`    // 附加往返延迟，在响应首字节前生效
+	JitterMs     int     `json:"jitter_ms"`     // 延迟抖动，在 ±jitter 范围内随机
+	LossRate     float64 `json:"loss_rate"`     // 每个数据块的丢包概率，丢包时按重传超时额外延迟
+	DropRate     float64 `json:"drop_rate"`     // 每个请求被中途断开连接的概率
+}
+
+// 内置网络条件
+var throttlePresets = map[string]ThrottleProfile{
+	"gprs":       {Name: "gprs", DownloadKbps: 50, UploadKbps: 20, LatencyMs: 500, JitterMs: 100},
+	"edge":       {Name: "edge", DownloadKbps: 240, UploadKbps: 200, LatencyMs: 400, JitterMs: 80},
+	"3g":         {Name: "3g", DownloadKbps: 780, UploadKbps: 330, LatencyMs: 100, JitterMs: 30},
+	"4g":         {Name: "4g", DownloadKbps: 9000, UploadKbps: 9000, LatencyMs: 50, JitterMs: 10},
+	"lossy-wifi": {Name: "lossy-wifi", DownloadKbps: 5000, UploadKbps: 2000, LatencyMs: 40, JitterMs: 60, LossRate: 0.05, DropRate: 0.02},
+}
+
+// ThrottlePresets 返回内置网络条件，按名称排序
+func ThrottlePresets() []ThrottleProfile {
+	result := make([]ThrottleProfile, 0, len(throttlePresets))
+	for _, p := range throttlePresets {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// ThrottleSetting 引用内置配置或给出自定义配置
+type ThrottleSetting struct {
+	Preset string           `json:"preset,omitempty"`
+	Custom *ThrottleProfile `json:"custom,omitempty"`
+}
+
+// resolve 返回生效的配置，未设置时返回 nil
+func (s *ThrottleSetting) resolve() (*ThrottleProfile, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if s.Custom != nil {
+		p := *s.Custom
+		if p.Name == "" {
+			p.Name = "custom"
+		}
+		return &p, p.validate()
+	}
+	if s.Preset == "" {
+		return nil, nil
+	}
+	p, ok := throttlePresets[strings.ToLower(s.Preset)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrThrottleProfile, s.Preset)
+	}
+	return &p, nil
+}
+
+func (p *ThrottleProfile) validate() error {
+	if p.DownloadKbps < 0 || p.UploadKbps < 0 || p.LatencyMs < 0 || p.JitterMs < 0 {
+		return errors.New("throttle values must not be negative")
+	}
+	if p.LossRate < 0 || p.LossRate >= 1 || p.DropRate < 0 || p.DropRate > 1 {
+		return errors.New("loss_rate must be in [0,1) and drop_rate in [0,1]")
+	}
+	return nil
+}
+
+// ThrottleRule 针对主机或客户端的网络条件
+type ThrottleRule struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+	Host    string `json:"host,omitempty"`   // 主机名通配符
+	Client  string `json:"client,omitempty"` // 客户端IP或CIDR
+	ThrottleSetting
+
+	matcher FlowMatcher
+	client  *net.IPNet
+	profile *ThrottleProfile
+}
+
+func (r *ThrottleRule) compile() error {
+	if r.Host == "" && r.Client == "" {
+		return errors.New("host or client is required")
+	}
+	r.matcher = FlowMatcher{Host: r.Host}
+	if err := r.matcher.Compile(); err != nil {
+		return err
+	}
+	r.client = nil
+	if r.Client != "" {
+		cidr := r.Client
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() == nil {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return errors.New("invalid client: " + r.Client)
+		}
+		r.client = n
+	}
+	p, err := r.resolve()
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return errors.New("preset or custom profile is required")
+	}
+	r.profile = p
+	return nil
+}
+
+func (r *ThrottleRule) match(host, clientIP string) bool {
+	if r.Host != "" && !r.matcher.Match("", host, "") {
+		return false
+	}
+	if r.client != nil {
+		ip := net.ParseIP(clientIP)
+		if ip == nil || !r.client.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// throttleConfig 持久化的网络模拟配置
+type throttleConfig struct {
+	Global *ThrottleSetting `json:"global,omitempty"`
+	Rules  []*ThrottleRule  `json:"rules"`
+}
+
+// limiterIdleTimeout 带宽限制器空闲超过该时间后被清理，清理检查的间隔相同
+const limiterIdleTimeout = 2 * time.Minute
+
+// ThrottleManager 管理网络条件模拟，规则优先于全局配置
+type ThrottleManager struct {
+	mu        sync.RWMutex
+	global    *ThrottleSetting
+	profile   *ThrottleProfile
+	rules     []*ThrottleRule
+	path      string
+	limiters  map[string]*bandwidthLimiter
+	lastSweep time.Time
+}
+
+// NewThrottleManager 创建网络模拟管理器，path 非空时从文件加载配置并在修改后自动保存
+func NewThrottleManager(path string) (*ThrottleManager, error) {
+	m := &ThrottleManager{rules: make([]*ThrottleRule, 0), path: path, limiters: make(map[string]*bandwidthLimiter)}
+	var cfg throttleConfig
+	if err := loadJSONFile(path, &cfg); err != nil {
+		return m, err
+	}
+	for _, r := range cfg.Rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	p, err := cfg.Global.resolve()
+	if err != nil {
+		return m, err
+	}
+	m.global, m.profile = cfg.Global, p
+	m.rules = append(m.rules, cfg.Rules...)
+	return m, nil
+}
+
+// Global 返回全局配置，未启用时返回 nil
+func (m *ThrottleManager) Global() *ThrottleSetting {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.global
+}
+
+// SetGlobal 设置全局网络条件，传入 nil 或空配置表示关闭
+func (m *ThrottleManager) SetGlobal(s *ThrottleSetting) error {
+	p, err := s.resolve()
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		s = nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := saveJSONFile(m.path, throttleConfig{Global: s, Rules: m.rules}); err != nil {
+		return err
+	}
+	m.global, m.profile = s, p
+	m.resetLimitersLocked()
+	return nil
+}
+
+// Rules 返回全部规则
+func (m *ThrottleManager) Rules() []*ThrottleRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*ThrottleRule, len(m.rules))
+	copy(result, m.rules)
+	return result
+}
+
+// AddRule 添加规则
+func (m *ThrottleManager) AddRule(rule *ThrottleRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则
+func (m *ThrottleManager) UpdateRule(id string, rule *ThrottleRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*ThrottleRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrThrottleRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *ThrottleManager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrThrottleRuleNotFound
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则并重建限速器
+func (m *ThrottleManager) setRulesLocked(rules []*ThrottleRule) error {
+	if err := saveJSONFile(m.path, throttleConfig{Global: m.global, Rules: rules}); err != nil {
+		return err
+	}
+	m.rules = rules
+	m.resetLimitersLocked()
+	return nil
+}
+
+func (m *ThrottleManager) resetLimitersLocked() {
+	m.limiters = make(map[string]*bandwidthLimiter)
+}
+
+// Select 选择请求适用的网络条件，返回配置及其标识（规则ID或 global），未启用时返回 nil
+func (m *ThrottleManager) Select(host, clientIP string) (*ThrottleProfile, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.Enabled && r.match(host, clientIP) {
+			return r.profile, r.ID
+		}
+	}
+	if m.profile != nil {
+		return m.profile, "global"
+	}
+	return nil, ""
+}
+
+// limiter 返回同一客户端、同一配置、同一方向共享的带宽限制器
+func (m *ThrottleManager) limiter(source, clientIP, direction string, kbps int) *bandwidthLimiter {
+	if kbps <= 0 {
+		return nil
+	}
+	key := source + "|" + clientIP + "|" + direction
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) >= limiterIdleTimeout {
+		m.sweepLimitersLocked(now)
+		m.lastSweep = now
+	}
+	l, ok := m.limiters[key]
+	if !ok {
+		l = newBandwidthLimiter(kbps)
+		m.limiters[key] = l
+	}
+	l.touch(now)
+	return l
+}
+
+// sweepLimitersLocked 清理空闲的带宽限制器，调用方需持有写锁
+func (m *ThrottleManager) sweepLimitersLocked(now time.Time) {
+	for k, l := range m.limiters {
+		if l.idle(now, limiterIdleTimeout) {
+			delete(m.limiters, k)
+		}
+	}
+}
+
+// WrapUpload 对上行消息体限速
+func (m *ThrottleManager) WrapUpload(ctx context.Context, body io.ReadCloser, p *ThrottleProfile, source, clientIP string) io.ReadCloser {
+	lim := m.limiter(source, clientIP, "up", p.UploadKbps)
+	if lim == nil && p.LossRate == 0 {
+		return body
+	}
+	return &throttledReader{ctx: ctx, r: body, lim: lim, profile: p, started: true, dropAt: -1}
+}
+
+// WrapDownload 对下行消息体施加延迟、限速、丢包与断连，abortHandler 的含义见 abortClientStream
+func (m *ThrottleManager) WrapDownload(ctx context.Context, body io.ReadCloser, p *ThrottleProfile, source, clientIP string, abortHandler bool) io.ReadCloser {
+	t := &throttledReader{
+		ctx:          ctx,
+		r:            body,
+		lim:          m.limiter(source, clientIP, "down", p.DownloadKbps),
+		profile:      p,
+		delay:        jitterDelay(p.LatencyMs, p.JitterMs),
+		dropAt:       -1,
+		abortHandler: abortHandler,
+	}
+	if p.DropRate > 0 && rand.Float64() < p.DropRate {
+		// 在前 64KB 内随机位置断开，消息体更短时在结束处断开
+		t.dropAt = rand.Int63n(64 << 10)
+	}
+	return t
+}
+
+// WrapStream 对 WebSocket 等升级后的连接双向限速：读取按下行、写入按上行计算，首次读取前施加延迟，
+// 模拟丢包但不模拟断连
+func (m *ThrottleManager) WrapStream(rwc io.ReadWriteCloser, p *ThrottleProfile, source, clientIP string) io.ReadWriteCloser {
+	if s := m.newThrottledStream(rwc, p, source, clientIP); s != nil {
+		return s
+	}
+	return rwc
+}
+
+// WrapConn 对透传隧道的上游连接双向限速，规则同 WrapStream
+func (m *ThrottleManager) WrapConn(conn net.Conn, p *ThrottleProfile, source, clientIP string) net.Conn {
+	if s := m.newThrottledStream(conn, p, source, clientIP); s != nil {
+		return &throttledConn{Conn: conn, s: s}
+	}
+	return conn
+}
+
+// newThrottledStream 创建双向限速的连接，配置不影响长连接时返回 nil
+func (m *ThrottleManager) newThrottledStream(rwc io.ReadWriteCloser, p *ThrottleProfile, source, clientIP string) *throttledStream {
+	down := m.limiter(source, clientIP, "down", p.DownloadKbps)
+	up := m.limiter(source, clientIP, "up", p.UploadKbps)
+	if down == nil && up == nil && p.LossRate == 0 && p.LatencyMs == 0 && p.JitterMs == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &throttledStream{
+		rwc:    rwc,
+		down:   &throttledReader{ctx: ctx, r: rwc, lim: down, profile: p, delay: jitterDelay(p.LatencyMs, p.JitterMs), dropAt: -1},
+		up:     up,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// jitterDelay 返回 latency ± jitter 范围内的随机延迟
+func jitterDelay(latencyMs, jitterMs int) time.Duration {
+	d := latencyMs
+	if jitterMs > 0 {
+		d += rand.Intn(2*jitterMs+1) - jitterMs
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d) * time.Millisecond
+}
+
+// bandwidthLimiter 按虚拟时钟排队的带宽限制器，可被多个流共享
+type bandwidthLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	next        time.Time
+}
+
+func newBandwidthLimiter(kbps int) *bandwidthLimiter {
+	return &bandwidthLimiter{bytesPerSec: float64(kbps) * 1000 / 8}
+}
+
+// chunk 单次读取的数据块大小，约 50ms 的流量，使输出平滑
+func (l *bandwidthLimiter) chunk() int {
+	n := int(l.bytesPerSec / 20)
+	if n < 512 {
+		n = 512
+	}
+	return n
+}
+
+// touch 标记限制器在 now 被使用
+func (l *bandwidthLimiter) touch(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.next.Before(now) {
+		l.next = now
+	}
+}
+
+// idle 报告限制器在 now 时是否已超过 d 没有预约发送
+func (l *bandwidthLimiter) idle(now time.Time, d time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return now.Sub(l.next) > d
+}
+
+// reserve 预约 n 字节的发送时间，返回需要等待的时长
+func (l *bandwidthLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.bytesPerSec * float64(time.Second)))
+	return l.next.Sub(now)
+}
+
+// throttledReader 在读取消息体时模拟网络条件
+type throttledReader struct {
+	ctx          context.Context
+	r            io.ReadCloser
+	lim          *bandwidthLimiter
+	profile      *ThrottleProfile
+	delay        time.Duration // 首字节前的延迟
+	started      bool
+	read         int64
+	dropAt       int64 // 断开位置，-1 表示不断开
+	abortHandler bool
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if !t.started {
+		t.started = true
+		if err := t.sleep(t.delay); err != nil {
+			return 0, err
+		}
+	}
+	if t.lim != nil && len(p) > t.lim.chunk() {
+		p = p[:t.lim.chunk()]
+	}
+	n, err := t.r.Read(p)
+	if t.dropAt >= 0 && (t.read+int64(n) >= t.dropAt || err == io.EOF) {
+		return t.drop()
+	}
+	t.read += int64(n)
+	if n > 0 {
+		if t.profile.LossRate > 0 && rand.Float64() < t.profile.LossRate {
+			// 丢包后等待重传：RTO 取 200ms 与两倍延迟中的较大值
+			rto := 200 * time.Millisecond
+			if d := 2 * time.Duration(t.profile.LatencyMs) * time.Millisecond; d > rto {
+				rto = d
+			}
+			if serr := t.sleep(rto); serr != nil {
+				return n, serr
+			}
+		}
+		if t.lim != nil {
+			if serr := t.sleep(t.lim.reserve(n)); serr != nil {
+				return n, serr
+			}
+		}
+	}
+	return n, err
+}
+
+func (t *throttledReader) drop() (int, error) {
+	t.r.Close()
+	return 0, abortClientStream(t.abortHandler, errThrottleDrop)
+}
+
+func (t *throttledReader) sleep(d time.Duration) error {
+	return sleepContext(t.ctx, d)
+}
+
+func (t *throttledReader) Close() error {
+	return t.r.Close()
+}
+
+// sleepContext 等待 d，ctx 结束时提前返回
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledStream 双向限速的长连接，关闭时中断正在进行的等待
+type throttledStream struct {
+	rwc    io.ReadWriteCloser
+	down   *throttledReader
+	up     *bandwidthLimiter
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (s *throttledStream) Read(p []byte) (int, error) {
+	return s.down.Read(p)
+}
+
+// Write 按上行带宽分块写出
+func (s *throttledStream) Write(p []byte) (int, error) {
+	if s.up == nil {
+		return s.rwc.Write(p)
+	}
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > s.up.chunk() {
+			chunk = chunk[:s.up.chunk()]
+		}
+		if err := sleepContext(s.ctx, s.up.reserve(len(chunk))); err != nil {
+			return written, err
+		}
+		n, err := s.rwc.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (s *throttledStream) Close() error {
+	s.cancel()
+	return s.rwc.Close()
+}
+
+// throttledConn 保留 net.Conn 的地址与超时方法，读写经过 throttledStream
+type throttledConn struct {
+	net.Conn
+	s *throttledStream
+}
+
+func (c *throttledConn) Read(p []byte) (int, error)  { return c.s.Read(p) }
+func (c *throttledConn) Write(p []byte) (int, error) { return c.s.Write(p) }
+func (c *throttledConn) Close() error                { return c.s.Close() }
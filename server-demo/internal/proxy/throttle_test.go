@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestThrottleSelect 测试规则优先于全局配置，以及主机与客户端匹配
+func TestThrottleSelect(t *testing.T) {
+	m, _ := NewThrottleManager("")
+	if p, _ := m.Select("api.example.com", "10.0.0.2"); p != nil {
+		t.Fatal("throttle should be off by default")
+	}
+	if err := m.SetGlobal(&ThrottleSetting{Preset: "3G"}); err != nil {
+		t.Fatal(err)
+	}
+	rule := &ThrottleRule{Enabled: true, Host: "*.example.com", Client: "10.0.0.0/24", ThrottleSetting: ThrottleSetting{Preset: "edge"}}
+	if err := m.AddRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	if p, src := m.Select("api.example.com", "10.0.0.2"); p == nil || p.Name != "edge" || src != rule.ID {
+		t.Fatalf("got %+v from %s", p, src)
+	}
+	if p, src := m.Select("api.example.com", "192.168.1.2"); p == nil || p.Name != "3g" || src != "global" {
+		t.Fatalf("got %+v from %s", p, src)
+	}
+	if err := m.SetGlobal(nil); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := m.Select("other.test", "10.0.0.2"); p != nil {
+		t.Fatal("global throttle should be disabled")
+	}
+
+	if err := m.SetGlobal(&ThrottleSetting{Preset: "5g"}); !errors.Is(err, ErrThrottleProfile) {
+		t.Fatalf("unknown preset err = %v", err)
+	}
+	if err := m.AddRule(&ThrottleRule{Enabled: true, Client: "bad", ThrottleSetting: ThrottleSetting{Preset: "3g"}}); err == nil {
+		t.Fatal("invalid client should be rejected")
+	}
+}
+
+// TestThrottledDownload 测试下行限速与首字节延迟
+func TestThrottledDownload(t *testing.T) {
+	m, _ := NewThrottleManager("")
+	// 80kbit/s = 10KB/s，20KB 约需 2s；首字节前延迟 100ms
+	p := &ThrottleProfile{Name: "slow", DownloadKbps: 80, LatencyMs: 100}
+	body := io.NopCloser(bytes.NewReader(make([]byte, 20<<10)))
+
+	start := time.Now()
+	r := m.WrapDownload(context.Background(), body, p, "test", "127.0.0.1", false)
+	n, err := io.Copy(io.Discard, r)
+	elapsed := time.Since(start)
+	if err != nil || n != 20<<10 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if elapsed < 1800*time.Millisecond || elapsed > 4*time.Second {
+		t.Fatalf("elapsed %v, want about 2s", elapsed)
+	}
+}
+
+// TestThrottledConn 测试长连接双向限速：写入按上行、读取按下行带宽，关闭时中断等待
+func TestThrottledConn(t *testing.T) {
+	m, _ := NewThrottleManager("")
+	// 上行与下行均为 80kbit/s = 10KB/s，各传 10KB 约需 1s
+	p := &ThrottleProfile{Name: "slow", DownloadKbps: 80, UploadKbps: 80}
+	client, server := net.Pipe()
+	defer server.Close()
+	conn := m.WrapConn(client, p, "test", "127.0.0.1")
+
+	go func() {
+		io.CopyN(io.Discard, server, 10<<10)
+		server.Write(make([]byte, 10<<10))
+	}()
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 10<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("upload elapsed %v, want about 1s", elapsed)
+	}
+	start = time.Now()
+	if _, err := io.ReadFull(conn, make([]byte, 10<<10)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("download elapsed %v, want about 1s", elapsed)
+	}
+	if conn.RemoteAddr() == nil {
+		t.Fatal("wrapped conn should keep the address methods")
+	}
+
+	// 关闭后等待中的写入立即返回
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(make([]byte, 100<<10))
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("write should fail after close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("close should interrupt a throttled write")
+	}
+
+	if got := m.WrapConn(client, &ThrottleProfile{Name: "off"}, "test", "127.0.0.1"); got != client {
+		t.Fatal("profile without limits should not wrap the conn")
+	}
+}
+
+// TestThrottledDrop 测试模拟断连
+func TestThrottledDrop(t *testing.T) {
+	m, _ := NewThrottleManager("")
+	p := &ThrottleProfile{Name: "flaky", DropRate: 1}
+	r := m.WrapDownload(context.Background(), io.NopCloser(bytes.NewReader([]byte("short"))), p, "test", "127.0.0.1", false)
+	if _, err := io.ReadAll(r); !errors.Is(err, errThrottleDrop) {
+		t.Fatalf("err = %v", err)
+	}
+
+	// 上下文取消时立即结束等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := &ThrottleProfile{Name: "slow", LatencyMs: 5000}
+	r = m.WrapDownload(ctx, io.NopCloser(bytes.NewReader([]byte("x"))), slow, "test", "127.0.0.1", false)
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+// TestThrottleLimiterSweep 测试同一客户端共享限制器，空闲的限制器会被清理而仍有排队数据的保留
+func TestThrottleLimiterSweep(t *testing.T) {
+	m, _ := NewThrottleManager("")
+	idle := m.limiter("global", "10.0.0.1", "down", 80)
+	if m.limiter("global", "10.0.0.1", "down", 80) != idle {
+		t.Fatal("same client and direction should share a limiter")
+	}
+	busy := m.limiter("global", "10.0.0.2", "down", 80)
+	// 80kbit/s 下预约 3MB，发送排队超过清理阈值
+	busy.reserve(3 << 20)
+
+	m.mu.Lock()
+	m.sweepLimitersLocked(time.Now().Add(limiterIdleTimeout + time.Second))
+	_, idleKept := m.limiters["global|10.0.0.1|down"]
+	_, busyKept := m.limiters["global|10.0.0.2|down"]
+	m.mu.Unlock()
+	if idleKept || !busyKept {
+		t.Fatalf("idle kept=%v busy kept=%v", idleKept, busyKept)
+	}
+	if m.limiter("global", "10.0.0.1", "down", 80) == idle {
+		t.Fatal("swept limiter should be recreated")
+	}
+}
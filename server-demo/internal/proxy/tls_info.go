@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"probe/internal/models"
+)
+
+// 证书校验失败的原因
+const (
+	CertExpired          = "expired"
+	CertNotYetValid      = "not_yet_valid"
+	CertUnknownAuthority = "unknown_authority"
+	CertHostnameMismatch = "hostname_mismatch"
+	CertInvalid          = "invalid"
+)
+
+// insecureUpstream 报告 MITM 规则是否允许 host 使用不安全的上游证书
+func (p *EnhancedProxyServer) insecureUpstream(host string) bool {
+	return p.mitmPolicy != nil && p.mitmPolicy.InsecureUpstream(host)
+}
+
+// transportFor 返回访问 host 使用的传输层，允许不安全上游时使用不校验证书的副本
+func (p *EnhancedProxyServer) transportFor(host string) *http.Transport {
+	if !p.insecureUpstream(host) {
+		return p.transport
+	}
+	p.insecureOnce.Do(func() {
+		tr := p.transport.Clone()
+		tr.TLSClientConfig.InsecureSkipVerify = true
+		p.insecureTr = tr
+	})
+	return p.insecureTr
+}
+
+// upstreamRoundTrip 经 tr 发送代理请求，tr 为 nil 时使用 transportFor 选择的传输层；失败时在 Flow 中记录错误，
+// 证书校验失败时同时记录上游证书链与原因
+func (p *EnhancedProxyServer) upstreamRoundTrip(flow *models.Flow, req *http.Request, tr http.RoundTripper) (*http.Response, error) {
+	if tr == nil {
+		tr = p.transportFor(req.URL.Hostname())
+	}
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		flow.EndAt = time.Now()
+		flow.LatencyMs = flow.EndAt.Sub(flow.StartAt).Milliseconds()
+		flow.Error = sendErrorInfo(err)
+		if info := p.tlsInfoFromError(err, req.URL.Hostname()); info != nil {
+			flow.TLS = info
+		}
+		p.errorCollector.RecordError(flow.ID, flow.Error.Type, flow.Error.Message, 0, flow.Error.IsTimeout, 0)
+		p.CleanupFlow(flow.ID)
+		// MITM 隧道中请求失败时 goproxy 不再调用 OnResponse，在此写回存储
+		p.publishFlow(flow)
+	}
+	return resp, err
+}
+
+// collectTLSInfo 收集上游连接的TLS信息
+func (p *EnhancedProxyServer) collectTLSInfo(resp *http.Response) *models.TLSInfo {
+	if resp == nil || resp.TLS == nil {
+		return nil
+	}
+	host := ""
+	if resp.Request != nil {
+		host = resp.Request.URL.Hostname()
+	}
+	return p.upstreamTLSInfo(resp.TLS, host)
+}
+
+// upstreamTLSInfo 记录协商参数、完整证书链与 SHA-256 指纹、OCSP 装订，并以系统根证书
+// （传输层指定了 RootCAs 时使用该证书池）校验证书链与主机名；跳过校验的连接在此补做校验以记录原因
+func (p *EnhancedProxyServer) upstreamTLSInfo(cs *tls.ConnectionState, host string) *models.TLSInfo {
+	info := &models.TLSInfo{
+		Version:          p.getTLSVersion(cs.Version),
+		CipherSuite:      p.getCipherSuite(cs.CipherSuite),
+		ServerName:       host,
+		ALPN:             cs.NegotiatedProtocol,
+		OCSPStapled:      len(cs.OCSPResponse) > 0,
+		InsecureUpstream: p.insecureUpstream(host),
+		Protocol:         "TLS",
+	}
+	fillChain(info, cs.PeerCertificates)
+	if info.Certificate != nil {
+		var err error
+		if len(cs.VerifiedChains) == 0 {
+			err = verifyChain(cs.PeerCertificates, host, p.transport.TLSClientConfig.RootCAs)
+		}
+		setValidation(info.Certificate, err)
+	}
+	if info.OCSPStapled && len(cs.PeerCertificates) > 0 {
+		info.OCSPStatus = ocspStatus(cs.OCSPResponse, cs.PeerCertificates)
+	}
+	info.IsSecure = info.Certificate != nil && info.Certificate.IsValid && info.OCSPStatus != "revoked"
+	return info
+}
+
+// tlsInfoFromError 从证书校验失败的错误中取出上游证书链，其他错误返回 nil
+func (p *EnhancedProxyServer) tlsInfoFromError(err error, host string) *models.TLSInfo {
+	var certErr *tls.CertificateVerificationError
+	if !errors.As(err, &certErr) {
+		return nil
+	}
+	info := &models.TLSInfo{ServerName: host, Protocol: "TLS"}
+	fillChain(info, certErr.UnverifiedCertificates)
+	if info.Certificate != nil {
+		setValidation(info.Certificate, certErr.Err)
+	}
+	return info
+}
+
+// fillChain 记录证书链，链中证书的有效性只检查有效期，叶子证书由 setValidation 写入完整校验结果
+func fillChain(info *models.TLSInfo, certs []*x509.Certificate) {
+	if len(certs) == 0 {
+		return
+	}
+	now := time.Now()
+	for _, cert := range certs {
+		ci := certificateInfo(cert)
+		switch {
+		case now.Before(cert.NotBefore):
+			ci.ValidationReason = CertNotYetValid
+		case now.After(cert.NotAfter):
+			ci.ValidationReason = CertExpired
+		}
+		ci.IsValid = ci.ValidationReason == ""
+		info.Chain = append(info.Chain, ci)
+	}
+	info.Certificate = info.Chain[0]
+}
+
+// setValidation 写入证书链校验结果，err 为空表示校验通过
+func setValidation(ci *models.CertificateInfo, err error) {
+	ci.IsValid = err == nil
+	ci.ValidationError, ci.ValidationReason = "", ""
+	if err != nil {
+		ci.ValidationError = err.Error()
+		ci.ValidationReason = certVerifyReason(err)
+	}
+}
+
+// verifyChain 以 roots（为空时使用系统根证书）校验证书链与主机名
+func verifyChain(certs []*x509.Certificate, host string, roots *x509.CertPool) error {
+	opts := x509.VerifyOptions{Roots: roots, DNSName: host, Intermediates: x509.NewCertPool()}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+func certificateInfo(cert *x509.Certificate) *models.CertificateInfo {
+	sum := sha256.Sum256(cert.Raw)
+	ci := &models.CertificateInfo{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		DNSNames:     cert.DNSNames,
+		NotBefore:    cert.NotBefore,
+		NotAfter:     cert.NotAfter,
+		SerialNumber: cert.SerialNumber.String(),
+		Fingerprint:  fingerprint(sum[:]),
+		IsCA:         cert.IsCA,
+		IsSelfSigned: cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil,
+	}
+	for _, ip := range cert.IPAddresses {
+		ci.IPAddresses = append(ci.IPAddresses, ip.String())
+	}
+	return ci
+}
+
+// certVerifyReason 将证书校验错误归类为 CertExpired 等原因
+func certVerifyReason(err error) string {
+	var invalid x509.CertificateInvalidError
+	var unknown x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	switch {
+	case errors.As(err, &invalid) && invalid.Reason == x509.Expired:
+		if invalid.Cert != nil && time.Now().Before(invalid.Cert.NotBefore) {
+			return CertNotYetValid
+		}
+		return CertExpired
+	case errors.As(err, &unknown):
+		return CertUnknownAuthority
+	case errors.As(err, &hostname):
+		return CertHostnameMismatch
+	}
+	return CertInvalid
+}
+
+// ocspStatus 解析装订的 OCSP 响应；有签发者证书时同时校验响应签名
+func ocspStatus(der []byte, chain []*x509.Certificate) string {
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	resp, err := ocsp.ParseResponseForCert(der, chain[0], issuer)
+	if err != nil {
+		return "invalid"
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
+}
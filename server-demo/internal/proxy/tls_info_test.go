@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// signTestLeaf 由测试根证书为 host 签发指定有效期的叶子证书
+func signTestLeaf(t *testing.T, ca *x509.Certificate, caKey *rsa.PrivateKey, host string, notBefore, notAfter time.Time) tls.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	addSAN(tmpl, host)
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der, ca.Raw}, PrivateKey: key, Leaf: leaf}
+}
+
+// TestUpstreamTLSInfo 测试证书链、指纹、ALPN、OCSP 装订与各类校验失败原因
+func TestUpstreamTLSInfo(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	cert := signTestLeaf(t, ca, caKey, "127.0.0.1", time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	cert.OCSPStaple, _ = ocsp.CreateResponse(ca, ca, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: cert.Leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+	}, caKey)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	p := newTestProxy(t, "", true, storage.NewMemoryFlowStore())
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	p.transport.TLSClientConfig.RootCAs = pool
+
+	resp, err := (&http.Client{Transport: p.transport}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	info := p.collectTLSInfo(resp)
+	sum := sha256.Sum256(cert.Leaf.Raw)
+	if !info.IsSecure || !info.Certificate.IsValid || info.InsecureUpstream {
+		t.Fatalf("trusted upstream should be secure: %+v", info.Certificate)
+	}
+	if len(info.Chain) != 2 || !info.Chain[1].IsCA || info.Certificate.Fingerprint != fingerprint(sum[:]) {
+		t.Fatalf("unexpected chain: %+v", info.Chain)
+	}
+	if info.ALPN != "h2" || !info.OCSPStapled || info.OCSPStatus != "good" || info.Certificate.IPAddresses[0] != "127.0.0.1" {
+		t.Fatalf("unexpected tls info: %+v", info)
+	}
+
+	expired := signTestLeaf(t, ca, caKey, "expired.test", time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+	future := signTestLeaf(t, ca, caKey, "future.test", time.Now().Add(24*time.Hour), time.Now().Add(48*time.Hour))
+	otherCA, otherKey := newTestCA(t)
+	untrusted := signTestLeaf(t, otherCA, otherKey, "untrusted.test", time.Now().Add(-time.Minute), time.Now().Add(time.Hour))
+	for _, tc := range []struct {
+		cert tls.Certificate
+		host string
+		want string
+	}{
+		{expired, "expired.test", CertExpired},
+		{future, "future.test", CertNotYetValid},
+		{untrusted, "untrusted.test", CertUnknownAuthority},
+		{cert, "example.com", CertHostnameMismatch},
+	} {
+		cs := &tls.ConnectionState{Version: tls.VersionTLS13, PeerCertificates: []*x509.Certificate{tc.cert.Leaf}}
+		info := p.upstreamTLSInfo(cs, tc.host)
+		if info.IsSecure || info.Certificate.IsValid || info.Certificate.ValidationReason != tc.want || info.Certificate.ValidationError == "" {
+			t.Errorf("%s: got %q (%s), want %s", tc.host, info.Certificate.ValidationReason, info.Certificate.ValidationError, tc.want)
+		}
+	}
+}
+
+// TestInsecureUpstream 测试默认拒绝不受信任的上游并记录原因，以及按 MITM 规则放行并在 Flow 中标记
+func TestInsecureUpstream(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	host, _, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	p := newTestProxy(t, "", true, storage.NewMemoryFlowStore())
+
+	send := func() (*models.Flow, *http.Response, error) {
+		flow := &models.Flow{ID: "f", StartAt: time.Now()}
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		resp, err := p.upstreamRoundTrip(flow, req, nil)
+		return flow, resp, err
+	}
+
+	flow, _, err := send()
+	if err == nil {
+		t.Fatal("untrusted upstream should be rejected by default")
+	}
+	if flow.Error == nil || !flow.Error.IsTLS || flow.TLS == nil || flow.TLS.Certificate.ValidationReason != CertUnknownAuthority {
+		t.Fatalf("verification failure not recorded: %+v %+v", flow.Error, flow.TLS)
+	}
+
+	m, _ := NewMITMPolicy("")
+	if err := m.AddRule(&MITMRule{Enabled: true, Host: host, Action: TunnelMitm, Insecure: true}); err != nil {
+		t.Fatal(err)
+	}
+	p.SetMITMPolicy(m)
+	flow, resp, err := send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	info := p.collectTLSInfo(resp)
+	if flow.Error != nil || !info.InsecureUpstream || info.IsSecure || info.Certificate.ValidationReason != CertUnknownAuthority {
+		t.Fatalf("insecure upstream should be allowed and flagged: %+v", info)
+	}
+	if p.transportFor("example.com") != p.transport {
+		t.Fatal("other hosts should keep certificate verification")
+	}
+}
@@ -0,0 +1,257 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// TransparentConfig 透明代理监听配置，Addr 为空时不启用
+type TransparentConfig struct {
+	Addr   string `json:"addr"`
+	TProxy bool   `json:"tproxy"` // TPROXY 模式，否则按 REDIRECT 读取 SO_ORIGINAL_DST
+}
+
+// ErrTransparentUnsupported 当前平台不支持透明代理
+var ErrTransparentUnsupported = errors.New("transparent proxy is only supported on linux")
+
+// maxTLSRecord 单个 TLS 记录的最大长度，用于缓冲完整的 ClientHello
+const maxTLSRecord = 5 + 16384 + 2048
+
+// serveTransparent 接受被 nftables 重定向的连接，恢复原始目标后交给 handler（goproxy）
+func (p *EnhancedProxyServer) serveTransparent(ln net.Listener, cfg TransparentConfig, handler http.Handler) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.handleTransparent(conn, cfg, handler)
+	}
+}
+
+func (p *EnhancedProxyServer) handleTransparent(conn net.Conn, cfg TransparentConfig, handler http.Handler) {
+	dst, err := transparentDst(conn, cfg.TProxy)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	// 未经重定向直接连到监听端口时原始目标就是自身，转发会形成回环
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && !cfg.TProxy && local.IP.Equal(dst.IP) && local.Port == dst.Port {
+		conn.Close()
+		return
+	}
+
+	br := bufio.NewReaderSize(conn, maxTLSRecord)
+	mode := sniffTunnel(conn, br)
+	target := dst.String()
+	if mode == tunnelModeTLS {
+		// SNI 只用于决定 MITM 策略与叶子证书的主机名，没有 SNI 时使用原始 IP；上游连接始终发往原始目标
+		if sni := peekSNI(conn, br); sni != "" {
+			target = net.JoinHostPort(sni, strconv.Itoa(dst.Port))
+		}
+	}
+	p.serveTunnel(conn, br, target, mode, dst.String(), handler)
+}
+
+type originalDstKey struct{}
+
+// withOriginalDst 记录透明代理连接的原始目标，经 dialUpstream 建立的连接固定发往该地址
+func withOriginalDst(ctx context.Context, dst string) context.Context {
+	return context.WithValue(ctx, originalDstKey{}, dst)
+}
+
+// originalDstOf 返回 ctx 中记录的原始目标，非透明代理连接返回空
+func originalDstOf(ctx context.Context) string {
+	dst, _ := ctx.Value(originalDstKey{}).(string)
+	return dst
+}
+
+// transparentDst 返回连接的原始目标地址：TPROXY 下即本地地址，REDIRECT 下读取 SO_ORIGINAL_DST
+func transparentDst(conn net.Conn, tproxy bool) (*net.TCPAddr, error) {
+	if tproxy {
+		addr, ok := conn.LocalAddr().(*net.TCPAddr)
+		if !ok {
+			return nil, errors.New("not a tcp connection")
+		}
+		return addr, nil
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil, errors.New("not a tcp connection")
+	}
+	return originalDst(tc)
+}
+
+// peekSNI 在不消费数据的前提下读取 ClientHello 中的 SNI
+func peekSNI(conn net.Conn, br *bufio.Reader) string {
+	conn.SetReadDeadline(time.Now().Add(sniffTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	head, err := br.Peek(5)
+	if err != nil {
+		return ""
+	}
+	record, err := br.Peek(5 + int(binary.BigEndian.Uint16(head[3:5])))
+	if err != nil {
+		return ""
+	}
+	return parseSNI(record[5:])
+}
+
+// parseSNI 解析 ClientHello 握手消息中的 server_name 扩展
+func parseSNI(msg []byte) string {
+	s := cryptobyte.String(msg)
+	var typ uint8
+	var hello cryptobyte.String
+	if !s.ReadUint8(&typ) || typ != 1 || !s.ReadUint24LengthPrefixed(&hello) {
+		return ""
+	}
+	var sessionID, suites, compression, exts cryptobyte.String
+	if !hello.Skip(2+32) || // legacy_version, random
+		!hello.ReadUint8LengthPrefixed(&sessionID) ||
+		!hello.ReadUint16LengthPrefixed(&suites) ||
+		!hello.ReadUint8LengthPrefixed(&compression) ||
+		!hello.ReadUint16LengthPrefixed(&exts) {
+		return ""
+	}
+	for !exts.Empty() {
+		var extType uint16
+		var ext cryptobyte.String
+		if !exts.ReadUint16(&extType) || !exts.ReadUint16LengthPrefixed(&ext) {
+			return ""
+		}
+		if extType != 0 {
+			continue
+		}
+		var names cryptobyte.String
+		if !ext.ReadUint16LengthPrefixed(&names) {
+			return ""
+		}
+		for !names.Empty() {
+			var nameType uint8
+			var name cryptobyte.String
+			if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+				return ""
+			}
+			if nameType == 0 {
+				return string(name)
+			}
+		}
+	}
+	return ""
+}
+
+// 透明代理 nftables 规则使用的表名、TPROXY 的 fwmark 与路由表
+const (
+	transparentTable      = "probe_transparent"
+	transparentMark       = "1"
+	transparentRouteTable = "100"
+)
+
+var interfaceNameRe = regexp.MustCompile(`^[A-Za-z0-9_.:-]{1,15}$`)
+
+// transparentRemoveCommands 撤销 REDIRECT 与 TPROXY 规则的命令
+var transparentRemoveCommands = [][]string{
+	{"nft", "delete", "table", "ip", transparentTable},
+	{"ip", "rule", "del", "fwmark", transparentMark, "lookup", transparentRouteTable},
+	{"ip", "route", "del", "local", "0.0.0.0/0", "dev", "lo", "table", transparentRouteTable},
+}
+
+// TransparentRuleOptions 生成透明代理 nftables 规则的参数
+type TransparentRuleOptions struct {
+	Port      int    `json:"port"`      // 透明代理监听端口
+	Interface string `json:"interface"` // 只转发该网卡进入的流量，为空时转发全部
+	Ports     []int  `json:"ports"`     // 需要转发的目标端口，默认 80、443
+	TProxy    bool   `json:"tproxy"`
+}
+
+// TransparentRules 透明代理所需的 nftables 脚本与额外命令
+type TransparentRules struct {
+	Script   string     `json:"script"`   // nft -f 执行的脚本
+	Commands [][]string `json:"commands"` // TPROXY 所需的策略路由命令
+	Remove   [][]string `json:"remove"`   // 撤销规则的命令
+}
+
+// BuildTransparentRules 生成转发到透明代理的规则，仅处理 PREROUTING，代理自身的出站流量不受影响
+func BuildTransparentRules(opts TransparentRuleOptions) (*TransparentRules, error) {
+	if opts.Port <= 0 || opts.Port > 65535 {
+		return nil, errors.New("invalid proxy port")
+	}
+	if opts.Interface != "" && !interfaceNameRe.MatchString(opts.Interface) {
+		return nil, fmt.Errorf("invalid interface name: %s", opts.Interface)
+	}
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = []int{80, 443}
+	}
+	portList := make([]string, len(ports))
+	for i, port := range ports {
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid port: %d", port)
+		}
+		portList[i] = strconv.Itoa(port)
+	}
+
+	match := "tcp dport { " + strings.Join(portList, ", ") + " }"
+	if opts.Interface != "" {
+		match = fmt.Sprintf("iifname %q %s", opts.Interface, match)
+	}
+	rules := &TransparentRules{Remove: transparentRemoveCommands}
+	var chain string
+	if opts.TProxy {
+		chain = fmt.Sprintf("\t\ttype filter hook prerouting priority mangle; policy accept;\n"+
+			"\t\t%s tproxy to :%d meta mark set %s accept\n", match, opts.Port, transparentMark)
+		rules.Commands = [][]string{
+			{"ip", "rule", "add", "fwmark", transparentMark, "lookup", transparentRouteTable},
+			{"ip", "route", "add", "local", "0.0.0.0/0", "dev", "lo", "table", transparentRouteTable},
+		}
+	} else {
+		chain = fmt.Sprintf("\t\ttype nat hook prerouting priority dstnat; policy accept;\n"+
+			"\t\t%s redirect to :%d\n", match, opts.Port)
+	}
+	rules.Script = fmt.Sprintf("table ip %s {\n\tchain prerouting {\n%s\t}\n}\n", transparentTable, chain)
+	return rules, nil
+}
+
+// String 以 shell 命令的形式输出规则，便于手动执行
+func (r *TransparentRules) String() string {
+	var b strings.Builder
+	b.WriteString("nft -f - <<'EOF'\n" + r.Script + "EOF\n")
+	for _, cmd := range r.Commands {
+		b.WriteString(strings.Join(cmd, " ") + "\n")
+	}
+	return b.String()
+}
+
+// Apply 执行规则，已存在的规则会先撤销
+func (r *TransparentRules) Apply() error {
+	RemoveTransparentRules()
+	nft := exec.Command("nft", "-f", "-")
+	nft.Stdin = strings.NewReader(r.Script)
+	if out, err := nft.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	for _, args := range r.Commands {
+		if out, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// RemoveTransparentRules 撤销透明代理规则，忽略不存在的规则
+func RemoveTransparentRules() {
+	for _, args := range transparentRemoveCommands {
+		exec.Command(args[0], args[1:]...).Run()
+	}
+}
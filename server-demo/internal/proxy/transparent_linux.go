@@ -0,0 +1,78 @@
+//go:build linux
+
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// soOriginalDst netfilter 的 SO_ORIGINAL_DST / IP6T_SO_ORIGINAL_DST
+const soOriginalDst = 80
+
+// originalDst 读取 REDIRECT 前的原始目标地址
+func originalDst(conn *net.TCPConn) (*net.TCPAddr, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	ipv6 := false
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok {
+		ipv6 = local.IP.To4() == nil
+	}
+
+	var addr *net.TCPAddr
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if ipv6 {
+			// sockaddr_in6 恰好容纳在 IPv6MTUInfo 中
+			info, err := unix.GetsockoptIPv6MTUInfo(int(fd), unix.SOL_IPV6, soOriginalDst)
+			if err != nil {
+				sockErr = err
+				return
+			}
+			// Port 为网络字节序
+			port := binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&info.Addr.Port))[:])
+			addr = &net.TCPAddr{IP: net.IP(info.Addr.Addr[:]), Port: int(port)}
+			return
+		}
+		// sockaddr_in 恰好容纳在 IPv6Mreq 中：family(2) port(2) addr(4)
+		mreq, err := unix.GetsockoptIPv6Mreq(int(fd), unix.SOL_IP, soOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		b := mreq.Multiaddr
+		addr = &net.TCPAddr{IP: net.IPv4(b[4], b[5], b[6], b[7]), Port: int(binary.BigEndian.Uint16(b[2:4]))}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addr, sockErr
+}
+
+// listenTransparent 创建透明代理监听，TPROXY 模式需要 IP_TRANSPARENT（CAP_NET_ADMIN）
+func listenTransparent(addr string, tproxy bool) (net.Listener, error) {
+	lc := net.ListenConfig{}
+	if tproxy {
+		lc.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = unix.SetsockoptInt(int(fd), unix.SOL_IP, unix.IP_TRANSPARENT, 1)
+				if sockErr == nil && network == "tcp6" {
+					sockErr = unix.SetsockoptInt(int(fd), unix.SOL_IPV6, unix.IPV6_TRANSPARENT, 1)
+				}
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package proxy
+
+import "net"
+
+func originalDst(conn *net.TCPConn) (*net.TCPAddr, error) {
+	return nil, ErrTransparentUnsupported
+}
+
+func listenTransparent(addr string, tproxy bool) (net.Listener, error) {
+	return nil, ErrTransparentUnsupported
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// TestPeekSNI 测试从 ClientHello 读取 SNI 且不消费数据
+func TestPeekSNI(t *testing.T) {
+	for _, name := range []string{"api.example.com", ""} {
+		client, server := net.Pipe()
+		go tls.Client(client, &tls.Config{ServerName: name, InsecureSkipVerify: true}).Handshake()
+
+		br := bufio.NewReaderSize(server, maxTLSRecord)
+		if mode := sniffTunnel(server, br); mode != tunnelModeTLS {
+			t.Fatalf("expected tls, got %s", mode)
+		}
+		if got := peekSNI(server, br); got != name {
+			t.Fatalf("sni: got %q, want %q", got, name)
+		}
+		if head, _ := br.Peek(1); head[0] != 0x16 {
+			t.Fatal("client hello should not be consumed")
+		}
+		client.Close()
+		server.Close()
+	}
+}
+
+// TestTransparentOriginalDst 测试透明代理的透传隧道与解密后的请求都连到原始目标，SNI 只用作主机名
+func TestTransparentOriginalDst(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer ts.Close()
+	dst := ts.Listener.Addr().String()
+
+	p := newTestProxy(t, "", true, storage.NewMemoryFlowStore())
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	p.transport.TLSClientConfig.RootCAs = pool
+
+	// 透传：CONNECT 目标为无法解析的 SNI 主机名，连接仍发往原始目标
+	req := httptest.NewRequest("CONNECT", "http://unresolvable.invalid:443", nil)
+	req = req.WithContext(withOriginalDst(context.Background(), dst))
+	conn, err := p.dialTunnel(req, "tcp", "unresolvable.invalid:443", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// 解密：按请求主机名（httptest 证书包含 example.com）校验证书，连接发往原始目标
+	cd := &connectCtxData{host: "example.com:443", dst: dst}
+	out, _ := http.NewRequest("GET", "https://example.com/", nil)
+	resp, err := p.upstreamRoundTrip(&models.Flow{}, out, cd.transport(p, "example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "example.com" {
+		t.Fatalf("unexpected upstream host %q", body)
+	}
+}
+
+// TestBuildTransparentRules 测试生成 nftables 规则
+func TestBuildTransparentRules(t *testing.T) {
+	rules, err := BuildTransparentRules(TransparentRuleOptions{Port: 8080, Interface: "wlan0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rules.Script, `iifname "wlan0" tcp dport { 80, 443 } redirect to :8080`) || len(rules.Commands) != 0 {
+		t.Fatalf("unexpected redirect rules:\n%s", rules)
+	}
+
+	rules, err = BuildTransparentRules(TransparentRuleOptions{Port: 8080, Ports: []int{443}, TProxy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rules.Script, "tcp dport { 443 } tproxy to :8080 meta mark set 1") || len(rules.Commands) != 2 {
+		t.Fatalf("unexpected tproxy rules:\n%s", rules)
+	}
+
+	if _, err := BuildTransparentRules(TransparentRuleOptions{Port: 8080, Interface: `eth0"; flush ruleset`}); err == nil {
+		t.Fatal("invalid interface name should be rejected")
+	}
+	if _, err := BuildTransparentRules(TransparentRuleOptions{Port: 8080, Ports: []int{70000}}); err == nil {
+		t.Fatal("invalid port should be rejected")
+	}
+}
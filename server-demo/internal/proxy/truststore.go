@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// Linux 信任库类型
+const (
+	TrustStoreDebian = "debian" // ca-certificates
+	TrustStoreRHEL   = "rhel"   // ca-trust
+	TrustStoreArch   = "arch"   // p11-kit trust anchors
+	TrustStoreNSS    = "nss"    // Firefox/Chromium 使用的 NSS 数据库
+)
+
+// trustCertName 系统信任库中的证书文件名，与旧版安装脚本一致以便识别已有安装
+const trustCertName = "probe-ca.crt"
+
+// trustNickname NSS 数据库中的证书昵称
+const trustNickname = "CetiProbe Root CA"
+
+// ErrNoTrustStore 未检测到可用的信任库
+var ErrNoTrustStore = errors.New("no supported trust store found")
+
+// systemTrustStores 发行版信任库：锚点目录与刷新命令
+var systemTrustStores = []struct {
+	name   string
+	dir    string
+	update []string
+}{
+	{TrustStoreDebian, "usr/local/share/ca-certificates", []string{"update-ca-certificates"}},
+	{TrustStoreRHEL, "etc/pki/ca-trust/source/anchors", []string{"update-ca-trust", "extract"}},
+	{TrustStoreArch, "etc/ca-certificates/trust-source/anchors", []string{"update-ca-trust"}},
+}
+
+// nssProfileGlobs 用户目录下的 NSS 数据库：Chromium、Firefox（含 snap 与 flatpak 版本）
+var nssProfileGlobs = []string{
+	".pki/nssdb",
+	".mozilla/firefox/*",
+	"snap/firefox/common/.mozilla/firefox/*",
+	".var/app/org.mozilla.firefox/.mozilla/firefox/*",
+}
+
+// TrustStoreStatus 单个信任库中根证书的安装状态
+type TrustStoreStatus struct {
+	Type      string `json:"type"`
+	Path      string `json:"path"` // 锚点目录或 NSS 数据库目录
+	Installed bool   `json:"installed"`
+	Outdated  bool   `json:"outdated,omitempty"` // 已安装的是其他证书，如轮换前的根证书
+	Error     string `json:"error,omitempty"`
+}
+
+// LinuxTrustStore 管理 Linux 系统与 NSS 信任库中的根证书。直接写文件并以参数列表执行命令，
+// 不经过 shell；Root 与 Run 可替换，便于针对临时目录测试
+type LinuxTrustStore struct {
+	Root     string // 文件系统根目录，默认 /
+	Home     string // 查找 NSS 数据库的用户目录，相对 Root
+	Run      func(name string, args ...string) ([]byte, error)
+	LookPath func(file string) (string, error)
+}
+
+// NewLinuxTrustStore 创建使用真实文件系统与命令的信任库
+func NewLinuxTrustStore() *LinuxTrustStore {
+	home, _ := os.UserHomeDir()
+	return &LinuxTrustStore{
+		Root: "/",
+		Home: home,
+		Run: func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).CombinedOutput()
+		},
+		LookPath: exec.LookPath,
+	}
+}
+
+// Status 返回各信任库中 cert 的安装状态
+func (s *LinuxTrustStore) Status(cert *x509.Certificate) ([]TrustStoreStatus, error) {
+	var out []TrustStoreStatus
+	for _, st := range systemTrustStores {
+		dir := filepath.Join(s.Root, st.dir)
+		if !isDir(dir) {
+			continue
+		}
+		status := TrustStoreStatus{Type: st.name, Path: dir}
+		if data, err := os.ReadFile(filepath.Join(dir, trustCertName)); err == nil {
+			status.Installed = true
+			status.Outdated = !samePEMCert(data, cert)
+		}
+		out = append(out, status)
+	}
+	for _, db := range s.nssDatabases() {
+		status := TrustStoreStatus{Type: TrustStoreNSS, Path: db}
+		if _, err := s.LookPath("certutil"); err != nil {
+			status.Error = "certutil not found, install libnss3-tools or nss-tools"
+		} else if data, err := s.Run("certutil", "-d", "sql:"+db, "-L", "-n", trustNickname, "-a"); err == nil {
+			status.Installed = true
+			status.Outdated = !samePEMCert(data, cert)
+		}
+		out = append(out, status)
+	}
+	if len(out) == 0 {
+		return nil, ErrNoTrustStore
+	}
+	return out, nil
+}
+
+// Install 将 cert 安装到检测到的全部信任库，已安装的旧证书会被替换，返回安装后的状态
+func (s *LinuxTrustStore) Install(cert *x509.Certificate) ([]TrustStoreStatus, error) {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	statuses, err := s.Status(cert)
+	if err != nil {
+		return nil, err
+	}
+
+	// NSS 的 certutil 需要从文件读取证书
+	var tmpPath string
+	defer func() {
+		if tmpPath != "" {
+			os.Remove(tmpPath)
+		}
+	}()
+
+	for i := range statuses {
+		st := &statuses[i]
+		if st.Error != "" || st.Installed && !st.Outdated {
+			continue
+		}
+		var err error
+		if st.Type == TrustStoreNSS {
+			if tmpPath == "" {
+				if tmpPath, err = writeTempCert(certPEM); err != nil {
+					return nil, err
+				}
+			}
+			if st.Outdated {
+				_, _ = s.Run("certutil", "-d", "sql:"+st.Path, "-D", "-n", trustNickname)
+			}
+			err = s.runCmd("certutil", "-d", "sql:"+st.Path, "-A", "-t", "C,,", "-n", trustNickname, "-i", tmpPath)
+		} else {
+			err = os.WriteFile(filepath.Join(st.Path, trustCertName), certPEM, 0644)
+			if err == nil {
+				err = s.updateSystemStore(st.Type)
+			}
+		}
+		if err != nil {
+			st.Error = err.Error()
+			continue
+		}
+		st.Installed, st.Outdated = true, false
+	}
+	return statuses, nil
+}
+
+// Uninstall 从全部信任库移除本工具安装的根证书（包括轮换前的旧证书），返回移除后的状态
+func (s *LinuxTrustStore) Uninstall(cert *x509.Certificate) ([]TrustStoreStatus, error) {
+	statuses, err := s.Status(cert)
+	if err != nil {
+		return nil, err
+	}
+	for i := range statuses {
+		st := &statuses[i]
+		if !st.Installed {
+			continue
+		}
+		if st.Type == TrustStoreNSS {
+			err = s.runCmd("certutil", "-d", "sql:"+st.Path, "-D", "-n", trustNickname)
+		} else {
+			err = os.Remove(filepath.Join(st.Path, trustCertName))
+			if err == nil {
+				err = s.updateSystemStore(st.Type)
+			}
+		}
+		if err != nil {
+			st.Error = err.Error()
+			continue
+		}
+		st.Installed, st.Outdated = false, false
+	}
+	return statuses, nil
+}
+
+func (s *LinuxTrustStore) updateSystemStore(name string) error {
+	for _, st := range systemTrustStores {
+		if st.name == name {
+			return s.runCmd(st.update[0], st.update[1:]...)
+		}
+	}
+	return nil
+}
+
+// runCmd 执行命令，失败时附带命令输出
+func (s *LinuxTrustStore) runCmd(name string, args ...string) error {
+	out, err := s.Run(name, args...)
+	if err != nil && len(bytes.TrimSpace(out)) > 0 {
+		return errors.New(name + ": " + string(bytes.TrimSpace(out)))
+	}
+	return err
+}
+
+// nssDatabases 查找用户目录下含 cert9.db 的 NSS 数据库
+func (s *LinuxTrustStore) nssDatabases() []string {
+	if s.Home == "" {
+		return nil
+	}
+	var dbs []string
+	for _, pattern := range nssProfileGlobs {
+		matches, _ := filepath.Glob(filepath.Join(s.Root, s.Home, pattern))
+		for _, dir := range matches {
+			if _, err := os.Stat(filepath.Join(dir, "cert9.db")); err == nil {
+				dbs = append(dbs, dir)
+			}
+		}
+	}
+	sort.Strings(dbs)
+	return dbs
+}
+
+// samePEMCert 判断 PEM 数据中的第一个证书是否为 cert
+func samePEMCert(data []byte, cert *x509.Certificate) bool {
+	block, _ := pem.Decode(data)
+	return block != nil && bytes.Equal(block.Bytes, cert.Raw)
+}
+
+func writeTempCert(certPEM []byte) (string, error) {
+	f, err := os.CreateTemp("", "probe-ca-*.pem")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(certPEM); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCertutil 以内存模拟各 NSS 数据库中的证书
+type fakeCertutil struct {
+	dbs  map[string][]byte
+	cmds []string
+}
+
+func (f *fakeCertutil) run(name string, args ...string) ([]byte, error) {
+	f.cmds = append(f.cmds, strings.Join(append([]string{name}, args...), " "))
+	if name != "certutil" {
+		return nil, nil
+	}
+	db := strings.TrimPrefix(args[1], "sql:")
+	switch args[2] {
+	case "-L":
+		if data, ok := f.dbs[db]; ok {
+			return data, nil
+		}
+		return []byte("certutil: Could not find cert"), errors.New("exit status 255")
+	case "-A":
+		data, err := os.ReadFile(args[len(args)-1])
+		f.dbs[db] = data
+		return nil, err
+	case "-D":
+		delete(f.dbs, db)
+	}
+	return nil, nil
+}
+
+// TestLinuxTrustStore 在临时根目录中测试检测、安装、轮换后替换与卸载，不经过 shell
+func TestLinuxTrustStore(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{
+		"usr/local/share/ca-certificates",
+		"etc/pki/ca-trust/source/anchors",
+		"home/u/.pki/nssdb",
+		"home/u/.mozilla/firefox/abc.default-release",
+		"home/u/.mozilla/firefox/empty",
+	} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(root, "home/u/.pki/nssdb/cert9.db"), nil, 0644)
+	os.WriteFile(filepath.Join(root, "home/u/.mozilla/firefox/abc.default-release/cert9.db"), nil, 0644)
+
+	certutil := &fakeCertutil{dbs: map[string][]byte{}}
+	s := &LinuxTrustStore{
+		Root:     root,
+		Home:     "/home/u",
+		Run:      certutil.run,
+		LookPath: func(file string) (string, error) { return "/usr/bin/" + file, nil },
+	}
+	caCert, _ := newTestCA(t)
+
+	statuses, err := s.Status(caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 || statuses[0].Type != TrustStoreDebian || statuses[1].Type != TrustStoreRHEL || statuses[2].Type != TrustStoreNSS {
+		t.Fatalf("unexpected stores: %+v", statuses)
+	}
+
+	if statuses, err = s.Install(caCert); err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if !st.Installed || st.Error != "" {
+			t.Fatalf("not installed: %+v", st)
+		}
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "usr/local/share/ca-certificates", trustCertName)); !samePEMCert(data, caCert) {
+		t.Fatal("debian anchor not written")
+	}
+	for _, want := range []string{"update-ca-certificates", "update-ca-trust extract"} {
+		if !containsString(certutil.cmds, want) {
+			t.Fatalf("missing command %q in %v", want, certutil.cmds)
+		}
+	}
+
+	// 轮换后旧证书显示为过期，重新安装时替换
+	newCert, _ := newTestCA(t)
+	statuses, _ = s.Status(newCert)
+	if !statuses[0].Outdated || !statuses[3].Outdated {
+		t.Fatalf("old certificate should be reported as outdated: %+v", statuses)
+	}
+	s.Install(newCert)
+	if statuses, _ = s.Status(newCert); statuses[0].Outdated || statuses[2].Outdated {
+		t.Fatalf("outdated certificate not replaced: %+v", statuses)
+	}
+
+	if statuses, err = s.Uninstall(newCert); err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if st.Installed {
+			t.Fatalf("not uninstalled: %+v", st)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc/pki/ca-trust/source/anchors", trustCertName)); !os.IsNotExist(err) {
+		t.Fatal("rhel anchor not removed")
+	}
+	if len(certutil.dbs) != 0 {
+		t.Fatalf("nss databases still contain the certificate: %v", certutil.dbs)
+	}
+
+	// 缺少 certutil 时 NSS 数据库报告错误，系统信任库不受影响
+	s.LookPath = func(string) (string, error) { return "", errors.New("not found") }
+	statuses, _ = s.Install(newCert)
+	if !statuses[0].Installed || statuses[2].Installed || statuses[2].Error == "" {
+		t.Fatalf("unexpected statuses without certutil: %+v", statuses)
+	}
+
+	if _, err := (&LinuxTrustStore{Root: t.TempDir(), LookPath: s.LookPath, Run: certutil.run}).Status(newCert); !errors.Is(err, ErrNoTrustStore) {
+		t.Fatalf("expected ErrNoTrustStore, got %v", err)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
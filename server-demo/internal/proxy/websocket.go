@@ -0,0 +1,591 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"probe/internal/models"
+)
+
+// WebSocket 消息的发送方
+const (
+	WSDirectionClient = "client"
+	WSDirectionServer = "server"
+	WSDirectionBoth   = "both" // 仅用于规则
+)
+
+// WebSocket 规则动作
+const (
+	WSActionReplace = "replace" // 按正则替换负载
+	WSActionDrop    = "drop"    // 丢弃消息
+	WSActionBreak   = "break"   // 挂起消息等待用户处理
+)
+
+// WSDecisionDrop 挂起消息的处理结果：丢弃，放行使用 BreakpointActionContinue
+const WSDecisionDrop = "drop"
+
+// 每个连接保留的消息数与单条消息记录的负载长度
+const (
+	MaxWebSocketMessages       = 1000
+	MaxWebSocketRecordedLength = 1 << 20
+)
+
+var (
+	ErrWebSocketRuleNotFound    = errors.New("websocket rule not found")
+	ErrWebSocketSessionNotFound = errors.New("websocket session not found")
+)
+
+// DefaultWebSocketFile WebSocket 规则默认持久化文件
+func DefaultWebSocketFile() string {
+	return filepath.Join(DefaultRulesDir(), "websocket.json")
+}
+
+// WebSocketRule 修改、丢弃或挂起匹配的 WebSocket 消息
+type WebSocketRule struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Enabled   bool   `json:"enabled"`
+	Direction string `json:"direction"`         // client/server/both，默认 both
+	Pattern   string `json:"pattern"`           // 负载正则，为空匹配全部数据消息
+	Action    string `json:"action"`            // replace/drop/break
+	Replace   string `json:"replace,omitempty"` // replace 时的替换内容，支持 $1 引用分组
+	FlowMatcher
+
+	matchRe *regexp.Regexp
+}
+
+func (r *WebSocketRule) compile() error {
+	if r.Direction == "" {
+		r.Direction = WSDirectionBoth
+	}
+	switch r.Direction {
+	case WSDirectionClient, WSDirectionServer, WSDirectionBoth:
+	default:
+		return fmt.Errorf("invalid direction: %s", r.Direction)
+	}
+	switch r.Action {
+	case WSActionReplace, WSActionDrop, WSActionBreak:
+	default:
+		return fmt.Errorf("invalid action: %s", r.Action)
+	}
+	r.matchRe = nil
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return errors.New("invalid match pattern: " + err.Error())
+		}
+		r.matchRe = re
+	} else if r.Action == WSActionReplace {
+		return errors.New("replace action requires a pattern")
+	}
+	return r.FlowMatcher.Compile()
+}
+
+func (r *WebSocketRule) matchMessage(direction string, payload []byte) bool {
+	if r.Direction != WSDirectionBoth && r.Direction != direction {
+		return false
+	}
+	return r.matchRe == nil || r.matchRe.Match(payload)
+}
+
+// PendingWebSocketMessage 命中 break 规则而挂起的消息
+type PendingWebSocketMessage struct {
+	ID        string    `json:"id"`
+	FlowID    string    `json:"flow_id"`
+	RuleID    string    `json:"rule_id"`
+	Direction string    `json:"direction"`
+	Type      string    `json:"type"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	decision chan WebSocketDecision
+}
+
+// WebSocketDecision 对挂起消息的处理结果
+type WebSocketDecision struct {
+	Action        string  `json:"action"` // continue/drop
+	Payload       *string `json:"payload,omitempty"`
+	PayloadBase64 *string `json:"payload_base64,omitempty"` // 二进制内容以base64提交
+}
+
+// decodedPayload 返回修改后的负载，未修改时 ok=false
+func (d *WebSocketDecision) decodedPayload() (payload []byte, ok bool, err error) {
+	if d.PayloadBase64 != nil {
+		payload, err = base64.StdEncoding.DecodeString(*d.PayloadBase64)
+		return payload, err == nil, err
+	}
+	if d.Payload != nil {
+		return []byte(*d.Payload), true, nil
+	}
+	return nil, false, nil
+}
+
+// WebSocketEvent 推送给订阅者的消息
+type WebSocketEvent struct {
+	FlowID  string                   `json:"flow_id"`
+	Message *models.WebSocketMessage `json:"message"`
+}
+
+type wsSubscriber struct {
+	flowID string // 为空时接收全部连接的消息
+	ch     chan WebSocketEvent
+}
+
+// WebSocketManager 管理 WebSocket 规则、活动连接、挂起消息与实时订阅
+type WebSocketManager struct {
+	mu       sync.RWMutex
+	rules    []*WebSocketRule
+	path     string
+	sessions map[string]*wsSession
+	pending  map[string]*PendingWebSocketMessage
+	subs     map[*wsSubscriber]struct{}
+	timeout  time.Duration
+}
+
+// NewWebSocketManager 创建 WebSocket 管理器，path 非空时从文件加载规则并在修改后自动保存
+func NewWebSocketManager(path string) (*WebSocketManager, error) {
+	m := &WebSocketManager{
+		rules:    make([]*WebSocketRule, 0),
+		path:     path,
+		sessions: make(map[string]*wsSession),
+		pending:  make(map[string]*PendingWebSocketMessage),
+		subs:     make(map[*wsSubscriber]struct{}),
+		timeout:  DefaultBreakpointTimeout,
+	}
+	var rules []*WebSocketRule
+	if err := loadJSONFile(path, &rules); err != nil {
+		return m, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return m, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+	}
+	m.rules = append(m.rules, rules...)
+	return m, nil
+}
+
+// Rules 返回全部规则
+func (m *WebSocketManager) Rules() []*WebSocketRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*WebSocketRule, len(m.rules))
+	copy(result, m.rules)
+	return result
+}
+
+// AddRule 添加规则
+func (m *WebSocketManager) AddRule(rule *WebSocketRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.NewString()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.setRulesLocked(append(m.rules[:len(m.rules):len(m.rules)], rule))
+}
+
+// UpdateRule 更新规则
+func (m *WebSocketManager) UpdateRule(id string, rule *WebSocketRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			rule.ID = id
+			rules := append([]*WebSocketRule(nil), m.rules...)
+			rules[i] = rule
+			return m.setRulesLocked(rules)
+		}
+	}
+	return ErrWebSocketRuleNotFound
+}
+
+// RemoveRule 删除规则
+func (m *WebSocketManager) RemoveRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.rules {
+		if r.ID == id {
+			return m.setRulesLocked(append(m.rules[:i:i], m.rules[i+1:]...))
+		}
+	}
+	return ErrWebSocketRuleNotFound
+}
+
+// setRulesLocked 先持久化新的规则列表，写入成功后才替换内存中的规则
+func (m *WebSocketManager) setRulesLocked(rules []*WebSocketRule) error {
+	if err := saveJSONFile(m.path, rules); err != nil {
+		return err
+	}
+	m.rules = rules
+	return nil
+}
+
+// match 查找第一条命中消息的规则
+func (m *WebSocketManager) match(host, path, direction string, payload []byte) *WebSocketRule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.rules {
+		if r.Enabled && r.Match(http.MethodGet, host, path) && r.matchMessage(direction, payload) {
+			return r
+		}
+	}
+	return nil
+}
+
+// Sessions 返回活动连接对应的 Flow ID
+func (m *WebSocketManager) Sessions() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.sessions))
+	for id := range m.sessions {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Info 返回活动连接消息记录的快照，连接已结束时返回 ErrWebSocketSessionNotFound
+func (m *WebSocketManager) Info(flowID string) (*models.WebSocketInfo, error) {
+	m.mu.RLock()
+	s := m.sessions[flowID]
+	m.mu.RUnlock()
+	if s == nil {
+		return nil, ErrWebSocketSessionNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot(), nil
+}
+
+// Inject 向活动连接注入一条消息，direction 为模拟的发送方
+func (m *WebSocketManager) Inject(flowID, direction, typ string, payload []byte) (*models.WebSocketMessage, error) {
+	op, ok := wsOpcodeOf(typ)
+	if !ok {
+		return nil, fmt.Errorf("invalid message type: %s", typ)
+	}
+	if direction != WSDirectionClient && direction != WSDirectionServer {
+		return nil, fmt.Errorf("invalid direction: %s", direction)
+	}
+	m.mu.RLock()
+	s := m.sessions[flowID]
+	m.mu.RUnlock()
+	if s == nil {
+		return nil, ErrWebSocketSessionNotFound
+	}
+	return s.inject(direction, op, payload)
+}
+
+// Pending 返回当前挂起的消息，按挂起时间排序
+func (m *WebSocketManager) Pending() []*PendingWebSocketMessage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]*PendingWebSocketMessage, 0, len(m.pending))
+	for _, p := range m.pending {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Resolve 提交对挂起消息的处理结果
+func (m *WebSocketManager) Resolve(id string, d WebSocketDecision) error {
+	if d.Action == "" {
+		d.Action = BreakpointActionContinue
+	}
+	if d.Action != BreakpointActionContinue && d.Action != WSDecisionDrop {
+		return fmt.Errorf("invalid action: %s", d.Action)
+	}
+	if _, _, err := d.decodedPayload(); err != nil {
+		return err
+	}
+	m.mu.RLock()
+	p := m.pending[id]
+	m.mu.RUnlock()
+	if p == nil {
+		return ErrPendingNotFound
+	}
+	select {
+	case p.decision <- d:
+		return nil
+	default:
+		return ErrPendingNotFound
+	}
+}
+
+// hold 挂起消息直到用户处理或超时，超时原样放行
+func (m *WebSocketManager) hold(p *PendingWebSocketMessage, done <-chan struct{}) WebSocketDecision {
+	p.ID = uuid.NewString()
+	p.CreatedAt = time.Now()
+	p.ExpiresAt = p.CreatedAt.Add(m.timeout)
+	p.decision = make(chan WebSocketDecision, 1)
+
+	m.mu.Lock()
+	m.pending[p.ID] = p
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.pending, p.ID)
+		m.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(m.timeout)
+	defer timer.Stop()
+	select {
+	case d := <-p.decision:
+		return d
+	case <-timer.C:
+	case <-done:
+	}
+	return WebSocketDecision{Action: BreakpointActionContinue}
+}
+
+// Subscribe 订阅消息，flowID 为空时订阅全部连接；返回的函数用于取消订阅
+func (m *WebSocketManager) Subscribe(flowID string) (<-chan WebSocketEvent, func()) {
+	sub := &wsSubscriber{flowID: flowID, ch: make(chan WebSocketEvent, 64)}
+	m.mu.Lock()
+	m.subs[sub] = struct{}{}
+	m.mu.Unlock()
+	return sub.ch, func() {
+		m.mu.Lock()
+		delete(m.subs, sub)
+		m.mu.Unlock()
+	}
+}
+
+// publish 推送消息，订阅者处理不及时时丢弃
+func (m *WebSocketManager) publish(flowID string, msg *models.WebSocketMessage) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for sub := range m.subs {
+		if sub.flowID != "" && sub.flowID != flowID {
+			continue
+		}
+		select {
+		case sub.ch <- WebSocketEvent{FlowID: flowID, Message: msg}:
+		default:
+		}
+	}
+}
+
+// wsSession 单个 WebSocket 连接：作为 goproxy 看到的上游连接，
+// Write 收到客户端发出的字节，Read 返回发给客户端的字节，中间逐条解析并处理消息
+type wsSession struct {
+	m          *WebSocketManager
+	flowID     string
+	host, path string
+	upstream   io.ReadWriteCloser
+
+	clientIn  *io.PipeWriter // 客户端发出的原始字节
+	clientOut *io.PipeReader // 发给客户端的字节
+
+	toServer sync.Mutex // 串行化写往服务端的帧
+	toClient sync.Mutex
+	out      *io.PipeWriter
+
+	mu        sync.Mutex // 保护 info，并保证快照按顺序发布
+	info      models.WebSocketInfo
+	publish   func(info *models.WebSocketInfo) // 将消息记录的快照写入 Flow
+	seq       int
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// startSession 接管升级后的连接，返回交给 goproxy 的替代连接；消息记录变化时以快照调用 publish
+func (m *WebSocketManager) startSession(flowID string, req *http.Request, upstream io.ReadWriteCloser, publish func(info *models.WebSocketInfo)) io.ReadWriteCloser {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := &wsSession{
+		m:         m,
+		flowID:    flowID,
+		host:      req.URL.Host,
+		path:      req.URL.Path,
+		upstream:  upstream,
+		clientIn:  inW,
+		clientOut: outR,
+		out:       outW,
+		done:      make(chan struct{}),
+		info:      models.WebSocketInfo{Messages: make([]*models.WebSocketMessage, 0)},
+		publish:   publish,
+	}
+	publish(s.snapshot())
+
+	m.mu.Lock()
+	m.sessions[flowID] = s
+	m.mu.Unlock()
+
+	go s.relay(WSDirectionClient, inR)
+	go s.relay(WSDirectionServer, upstream)
+	return s
+}
+
+func (s *wsSession) Read(b []byte) (int, error)  { return s.clientOut.Read(b) }
+func (s *wsSession) Write(b []byte) (int, error) { return s.clientIn.Write(b) }
+
+// Close 任一方向结束时关闭整个连接
+func (s *wsSession) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.clientIn.Close()
+		s.out.Close()
+		s.upstream.Close()
+		s.m.mu.Lock()
+		delete(s.m.sessions, s.flowID)
+		s.m.mu.Unlock()
+		s.mu.Lock()
+		s.info.Closed = true
+		s.publish(s.snapshot())
+		s.mu.Unlock()
+	})
+	return nil
+}
+
+// relay 逐条读取 from 方发出的消息，处理后转发给对端
+func (s *wsSession) relay(from string, r io.Reader) {
+	defer s.Close()
+	fr := newWSFrameReader(r)
+	for {
+		op, payload, err := fr.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg := &models.WebSocketMessage{Direction: from, Type: wsOpcodeName(op), Timestamp: time.Now()}
+		if op == wsOpText || op == wsOpBinary {
+			payload = s.applyRules(msg, payload)
+		}
+		if !msg.Dropped {
+			err = s.send(from, op, payload)
+		}
+		s.record(msg, payload)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// applyRules 按规则修改、丢弃或挂起数据消息
+func (s *wsSession) applyRules(msg *models.WebSocketMessage, payload []byte) []byte {
+	rule := s.m.match(s.host, s.path, msg.Direction, payload)
+	if rule == nil {
+		return payload
+	}
+	msg.RuleID = rule.ID
+	switch rule.Action {
+	case WSActionDrop:
+		msg.Dropped = true
+	case WSActionReplace:
+		payload = rule.matchRe.ReplaceAll(payload, []byte(rule.Replace))
+		msg.Edited = true
+	case WSActionBreak:
+		d := s.m.hold(&PendingWebSocketMessage{
+			FlowID:    s.flowID,
+			RuleID:    rule.ID,
+			Direction: msg.Direction,
+			Type:      msg.Type,
+			Payload:   payload,
+		}, s.done)
+		if d.Action == WSDecisionDrop {
+			msg.Dropped = true
+		} else if edited, ok, _ := d.decodedPayload(); ok {
+			payload, msg.Edited = edited, true
+		}
+	}
+	return payload
+}
+
+// send 将消息编码为单帧发给 from 的对端，发往服务端的帧加掩码
+func (s *wsSession) send(from string, op byte, payload []byte) error {
+	if from == WSDirectionClient {
+		s.toServer.Lock()
+		defer s.toServer.Unlock()
+		_, err := s.upstream.Write(encodeWSFrame(op, payload, true))
+		return err
+	}
+	s.toClient.Lock()
+	defer s.toClient.Unlock()
+	_, err := s.out.Write(encodeWSFrame(op, payload, false))
+	return err
+}
+
+// inject 以 from 的身份向对端发送一条消息
+func (s *wsSession) inject(from string, op byte, payload []byte) (*models.WebSocketMessage, error) {
+	msg := &models.WebSocketMessage{Direction: from, Type: wsOpcodeName(op), Timestamp: time.Now(), Injected: true}
+	if err := s.send(from, op, payload); err != nil {
+		return nil, err
+	}
+	s.record(msg, payload)
+	return msg, nil
+}
+
+// record 记录消息到 Flow 并推送给订阅者
+func (s *wsSession) record(msg *models.WebSocketMessage, payload []byte) {
+	msg.Size = len(payload)
+	if len(payload) > MaxWebSocketRecordedLength {
+		payload, msg.Truncated = payload[:MaxWebSocketRecordedLength], true
+	}
+	msg.Payload = append([]byte(nil), payload...)
+
+	s.mu.Lock()
+	info := &s.info
+	s.seq++
+	msg.Seq = s.seq
+	if msg.Type == "close" {
+		msg.CloseCode, msg.CloseReason = parseWSClose(payload)
+		if info.ClosedBy == "" {
+			info.ClosedBy, info.CloseCode, info.CloseReason = msg.Direction, msg.CloseCode, msg.CloseReason
+		}
+	}
+	info.Total++
+	info.Messages = append(info.Messages, msg)
+	if len(info.Messages) > MaxWebSocketMessages {
+		info.Messages = info.Messages[len(info.Messages)-MaxWebSocketMessages:]
+	}
+	s.publish(s.snapshot())
+	s.mu.Unlock()
+
+	s.m.publish(s.flowID, msg)
+}
+
+// snapshot 复制当前的消息记录，调用方需持有 s.mu
+func (s *wsSession) snapshot() *models.WebSocketInfo {
+	info := s.info
+	info.Messages = append([]*models.WebSocketMessage(nil), s.info.Messages...)
+	return &info
+}
+
+// startWebSocket 记录 101 响应并接管升级后的连接
+func (p *EnhancedProxyServer) startWebSocket(flow *models.Flow, req *http.Request, resp *http.Response) {
+	flow.Response = &models.HTTPResponse{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Headers:    models.CopyHeaders(resp.Header),
+		Proto:      resp.Proto,
+	}
+	if flow.Scheme == "https" {
+		flow.TLS = p.collectTLSInfo(resp)
+	}
+	p.networkMonitor.RecordRequest(flow.Request.Host, true, flow.LatencyMs, 0)
+	p.publishFlow(flow)
+	if rw, ok := resp.Body.(io.ReadWriteCloser); ok {
+		resp.Body = p.websocket.startSession(flow.ID, req, rw, func(info *models.WebSocketInfo) {
+			p.store.Update(flow.ID, func(f *models.Flow) { f.WebSocket = info })
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WebSocket 帧操作码（RFC 6455）
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+)
+
+// MaxWebSocketMessageSize 单条消息（合并分片后）的最大长度
+const MaxWebSocketMessageSize = 32 << 20
+
+var errWebSocketTooLarge = errors.New("websocket message too large")
+
+// isWebSocketUpgrade 判断请求或响应头是否为 WebSocket 升级
+func isWebSocketUpgrade(h http.Header) bool {
+	return headerHasToken(h, "Connection", "upgrade") && headerHasToken(h, "Upgrade", "websocket")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, s := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(s), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func wsOpcodeName(op byte) string {
+	switch op {
+	case wsOpText:
+		return "text"
+	case wsOpBinary:
+		return "binary"
+	case wsOpClose:
+		return "close"
+	case wsOpPing:
+		return "ping"
+	case wsOpPong:
+		return "pong"
+	}
+	return "unknown"
+}
+
+func wsOpcodeOf(name string) (byte, bool) {
+	switch name {
+	case "text", "":
+		return wsOpText, true
+	case "binary":
+		return wsOpBinary, true
+	case "ping":
+		return wsOpPing, true
+	case "pong":
+		return wsOpPong, true
+	case "close":
+		return wsOpClose, true
+	}
+	return 0, false
+}
+
+// wsFrameReader 按消息读取 WebSocket 帧，合并数据帧分片，控制帧可穿插在分片之间
+type wsFrameReader struct {
+	r       *bufio.Reader
+	op      byte   // 正在合并的数据消息操作码
+	pending []byte // 已收到的分片
+}
+
+func newWSFrameReader(r io.Reader) *wsFrameReader {
+	return &wsFrameReader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage 返回一条完整消息：控制帧或合并后的数据消息，负载已去除掩码
+func (fr *wsFrameReader) ReadMessage() (op byte, payload []byte, err error) {
+	for {
+		fin, op, payload, err := fr.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		if op >= wsOpClose {
+			return op, payload, nil
+		}
+		if op != wsOpContinuation {
+			fr.op, fr.pending = op, nil
+		}
+		if len(fr.pending)+len(payload) > MaxWebSocketMessageSize {
+			return 0, nil, errWebSocketTooLarge
+		}
+		fr.pending = append(fr.pending, payload...)
+		if fin {
+			msg := fr.pending
+			fr.pending = nil
+			return fr.op, msg, nil
+		}
+	}
+}
+
+func (fr *wsFrameReader) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(fr.r, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(fr.r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(fr.r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > MaxWebSocketMessageSize {
+		err = errWebSocketTooLarge
+		return
+	}
+	var key [4]byte
+	if masked {
+		if _, err = io.ReadFull(fr.r, key[:]); err != nil {
+			return
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(fr.r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return
+}
+
+// encodeWSFrame 编码单个完整帧，客户端发往服务端的帧必须加掩码
+func encodeWSFrame(op byte, payload []byte, mask bool) []byte {
+	b := make([]byte, 0, len(payload)+14)
+	b = append(b, 0x80|op)
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !mask {
+		return append(b, payload...)
+	}
+	var key [4]byte
+	rand.Read(key[:])
+	b = append(b, key[:]...)
+	start := len(b)
+	b = append(b, payload...)
+	for i := range payload {
+		b[start+i] ^= key[i%4]
+	}
+	return b
+}
+
+// parseWSClose 解析 close 帧的状态码与原因
+func parseWSClose(payload []byte) (int, string) {
+	if len(payload) < 2 {
+		return 0, ""
+	}
+	return int(binary.BigEndian.Uint16(payload)), string(payload[2:])
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"probe/internal/models"
+	"probe/pkg/storage"
+)
+
+// newEchoWebSocketServer 回显文本消息的 WebSocket 服务端，close 帧原样回复
+func newEchoWebSocketServer(t *testing.T, extensions chan<- string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensions <- r.Header.Get("Sec-WebSocket-Extensions")
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		fr := newWSFrameReader(brw)
+		for {
+			op, payload, err := fr.ReadMessage()
+			if err != nil {
+				return
+			}
+			if op == wsOpClose {
+				conn.Write(encodeWSFrame(wsOpClose, payload, false))
+				return
+			}
+			conn.Write(encodeWSFrame(op, append([]byte("echo:"), payload...), false))
+		}
+	}))
+}
+
+// TestWebSocketInterception 测试消息记录、规则改写与丢弃、断点、注入与实时推送
+func TestWebSocketInterception(t *testing.T) {
+	extensions := make(chan string, 1)
+	server := newEchoWebSocketServer(t, extensions)
+	defer server.Close()
+
+	store := storage.NewMemoryFlowStore()
+	p := newTestProxy(t, "127.0.0.1:0", false, store)
+	m, _ := NewWebSocketManager("")
+	m.timeout = 5 * time.Second
+	m.AddRule(&WebSocketRule{Enabled: true, Direction: WSDirectionClient, Pattern: "secret", Action: WSActionReplace, Replace: "xxx"})
+	m.AddRule(&WebSocketRule{Enabled: true, Pattern: "^drop", Action: WSActionDrop})
+	m.AddRule(&WebSocketRule{Enabled: true, Pattern: "^hold", Action: WSActionBreak})
+	p.SetWebSocketManager(m)
+	events, cancel := m.Subscribe("")
+	defer cancel()
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	conn, err := net.Dial("tcp", p.srv.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	host := strings.TrimPrefix(server.URL, "http://")
+	conn.Write([]byte("GET ws://" + host + "/chat HTTP/1.1\r\nHost: " + host + "\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Extensions: permessage-deflate\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("handshake failed: %v %s %v", resp.Status, body, err)
+	}
+	if ext := <-extensions; ext != "" {
+		t.Fatalf("permessage-deflate should not be offered upstream, got %q", ext)
+	}
+	fr := newWSFrameReader(br)
+	roundTrip := func(send string) string {
+		conn.Write(encodeWSFrame(wsOpText, []byte(send), true))
+		_, payload, err := fr.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(payload)
+	}
+
+	if got := roundTrip("hello secret"); got != "echo:hello xxx" {
+		t.Fatalf("replace rule not applied: %q", got)
+	}
+	conn.Write(encodeWSFrame(wsOpText, []byte("drop me"), true))
+	if got := roundTrip("next"); got != "echo:next" {
+		t.Fatalf("dropped message reached server: %q", got)
+	}
+
+	flow := waitFlow(t, store, func(f *models.Flow) bool { return f.WebSocket != nil })
+	if _, err := m.Inject(flow.ID, WSDirectionServer, "text", []byte("pushed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, payload, _ := fr.ReadMessage(); string(payload) != "pushed" {
+		t.Fatalf("injected message not received: %q", payload)
+	}
+	if live, err := m.Info(flow.ID); err != nil || live.Closed || live.Total == 0 || len(live.Messages) != live.Total {
+		t.Fatalf("unexpected live snapshot: %+v %v", live, err)
+	}
+
+	// 断点：挂起后以修改后的内容放行
+	conn.Write(encodeWSFrame(wsOpText, []byte("hold this"), true))
+	var pending []*PendingWebSocketMessage
+	for i := 0; i < 100 && len(pending) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		pending = m.Pending()
+	}
+	if len(pending) != 1 || string(pending[0].Payload) != "hold this" {
+		t.Fatalf("message not held: %+v", pending)
+	}
+	released := "released"
+	if err := m.Resolve(pending[0].ID, WebSocketDecision{Payload: &released}); err != nil {
+		t.Fatal(err)
+	}
+	if _, payload, _ := fr.ReadMessage(); string(payload) != "echo:released" {
+		t.Fatalf("edited message not forwarded: %q", payload)
+	}
+
+	closePayload := binary.BigEndian.AppendUint16(nil, 1000)
+	conn.Write(encodeWSFrame(wsOpClose, append(closePayload, "bye"...), true))
+	if op, _, _ := fr.ReadMessage(); op != wsOpClose {
+		t.Fatalf("close frame not relayed, got op %d", op)
+	}
+
+	flow = waitFlow(t, store, func(f *models.Flow) bool { return f.WebSocket != nil && f.WebSocket.Closed })
+	if _, err := m.Info(flow.ID); err != ErrWebSocketSessionNotFound {
+		t.Fatalf("closed session should have no live snapshot: %v", err)
+	}
+	info := flow.WebSocket
+	if info.ClosedBy != WSDirectionClient || info.CloseCode != 1000 || info.CloseReason != "bye" {
+		t.Fatalf("close not recorded: %+v", info)
+	}
+	var dropped, edited, injected int
+	for _, msg := range info.Messages {
+		if msg.Dropped {
+			dropped++
+		}
+		if msg.Edited {
+			edited++
+		}
+		if msg.Injected {
+			injected++
+		}
+	}
+	if dropped != 1 || edited != 2 || injected != 1 {
+		t.Fatalf("unexpected message flags: dropped=%d edited=%d injected=%d", dropped, edited, injected)
+	}
+	if len(events) != info.Total {
+		t.Fatalf("expected %d live events, got %d", info.Total, len(events))
+	}
+}
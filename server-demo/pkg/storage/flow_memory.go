@@ -7,12 +7,19 @@ import (
 	"probe/internal/models"
 )
 
+// FlowStorage 保存代理流量。已保存的 Flow 视为只读快照，
+// 修改必须通过 Update 进行，调用方不得修改读取到的 Flow
 type FlowStorage interface {
 	Add(flow *models.Flow)
+	// Update 在存储锁内修改 Flow 的副本并替换原记录，Flow 不存在时返回 false。
+	// fn 只能给字段赋新值，不得原地修改嵌套的结构体、切片或 map
+	Update(id string, fn func(flow *models.Flow)) bool
 	GetAll(limit int) []*models.Flow
 	GetByID(id string) *models.Flow
 	Clear()
 	Stats() FlowStats
+	// OnEvict 设置 Flow 因容量上限被淘汰时的回调，在存储锁外调用
+	OnEvict(fn func(flow *models.Flow))
 }
 
 type FlowStats struct {
@@ -22,33 +29,59 @@ type FlowStats struct {
 }
 
 type memoryFlowStore struct {
-	mu    sync.RWMutex
-	flows []*models.Flow
-	byID  map[string]*models.Flow
-	stats FlowStats
+	mu      sync.RWMutex
+	flows   []*models.Flow
+	pos     map[string]int // Flow ID 到写入序号的映射，序号减去 evicted 即切片下标
+	evicted int
+	stats   FlowStats
+	onEvict func(flow *models.Flow)
 }
 
 func NewMemoryFlowStore() FlowStorage {
 	return &memoryFlowStore{
 		flows: make([]*models.Flow, 0, 1024),
-		byID:  make(map[string]*models.Flow),
+		pos:   make(map[string]int),
 		stats: FlowStats{StartTime: time.Now()},
 	}
 }
 
+// Add 保存 flow 的副本，之后对 flow 的修改不会影响已保存的记录
 func (m *memoryFlowStore) Add(flow *models.Flow) {
+	cp := *flow
 	m.mu.Lock()
-	defer m.mu.Unlock()
 	const max = 20000
+	var old *models.Flow
 	if len(m.flows) >= max {
-		old := m.flows[0]
-		delete(m.byID, old.ID)
+		old = m.flows[0]
+		delete(m.pos, old.ID)
+		m.flows[0] = nil
 		m.flows = m.flows[1:]
+		m.evicted++
 	}
-	m.flows = append(m.flows, flow)
-	m.byID[flow.ID] = flow
+	m.pos[cp.ID] = m.evicted + len(m.flows)
+	m.flows = append(m.flows, &cp)
 	m.stats.Total++
 	m.stats.LastTime = time.Now()
+	onEvict := m.onEvict
+	m.mu.Unlock()
+
+	if old != nil && onEvict != nil {
+		onEvict(old)
+	}
+}
+
+func (m *memoryFlowStore) Update(id string, fn func(flow *models.Flow)) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.pos[id]
+	if !ok {
+		return false
+	}
+	i := n - m.evicted
+	cp := *m.flows[i]
+	fn(&cp)
+	m.flows[i] = &cp
+	return true
 }
 
 func (m *memoryFlowStore) GetAll(limit int) []*models.Flow {
@@ -58,23 +91,34 @@ func (m *memoryFlowStore) GetAll(limit int) []*models.Flow {
 		limit = len(m.flows)
 	}
 	start := len(m.flows) - limit
-	return m.flows[start:]
+	return append([]*models.Flow(nil), m.flows[start:]...)
 }
 
 func (m *memoryFlowStore) GetByID(id string) *models.Flow {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.byID[id]
+	n, ok := m.pos[id]
+	if !ok {
+		return nil
+	}
+	return m.flows[n-m.evicted]
 }
 
 func (m *memoryFlowStore) Clear() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.flows = make([]*models.Flow, 0, 1024)
-	m.byID = make(map[string]*models.Flow)
+	m.pos = make(map[string]int)
+	m.evicted = 0
 	m.stats = FlowStats{StartTime: time.Now()}
 }
 
+func (m *memoryFlowStore) OnEvict(fn func(flow *models.Flow)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEvict = fn
+}
+
 func (m *memoryFlowStore) Stats() FlowStats {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"strconv"
+	"testing"
+
+	"probe/internal/models"
+)
+
+// TestMemoryFlowStoreUpdate 测试保存副本、按 ID 更新、读取快照不受后续更新影响以及淘汰回调与淘汰后的定位
+func TestMemoryFlowStoreUpdate(t *testing.T) {
+	s := NewMemoryFlowStore()
+	flow := &models.Flow{ID: "a", LatencyMs: 1}
+	s.Add(flow)
+	flow.LatencyMs = 2
+	if got := s.GetByID("a"); got.LatencyMs != 1 {
+		t.Fatalf("stored flow changed with caller copy: %d", got.LatencyMs)
+	}
+
+	before := s.GetAll(0)
+	if !s.Update("a", func(f *models.Flow) { f.LatencyMs = 3 }) {
+		t.Fatal("update of stored flow failed")
+	}
+	if before[0].LatencyMs != 1 || s.GetByID("a").LatencyMs != 3 {
+		t.Fatalf("snapshot %d, stored %d", before[0].LatencyMs, s.GetByID("a").LatencyMs)
+	}
+	if s.Update("missing", func(*models.Flow) {}) {
+		t.Fatal("update of unknown flow should report false")
+	}
+
+	var evicted []string
+	s.OnEvict(func(f *models.Flow) { evicted = append(evicted, f.ID) })
+	for i := 0; i < 20000; i++ {
+		s.Add(&models.Flow{ID: strconv.Itoa(i)})
+	}
+	if s.GetByID("a") != nil || s.Update("a", func(*models.Flow) {}) {
+		t.Fatal("oldest flow should be evicted")
+	}
+	if len(evicted) != 1 || evicted[0] != "a" {
+		t.Fatalf("evict callback got %v", evicted)
+	}
+	s.Update("19999", func(f *models.Flow) { f.LatencyMs = 9 })
+	all := s.GetAll(1)
+	if len(all) != 1 || all[0].ID != "19999" || all[0].LatencyMs != 9 {
+		t.Fatalf("unexpected newest flow after eviction: %+v", all)
+	}
+}
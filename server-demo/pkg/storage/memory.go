@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"probe/internal/capture/layer"
 	"probe/internal/models"
 	"strings"
 	"sync"
@@ -21,7 +22,8 @@ func NewMemoryStorage() *MemoryStorage {
 	return &MemoryStorage{
 		packets: make([]*models.PacketInfo, 0),
 		stats: Stats{
-			StartTime: time.Now(),
+			StartTime:      time.Now(),
+			ProtocolCounts: make(map[string]int),
 		},
 		ipSet:   make(map[string]bool),
 		portSet: make(map[uint16]bool),
@@ -46,14 +48,15 @@ func (m *MemoryStorage) StorePacket(packet *models.PacketInfo) {
 	m.stats.TotalPackets++
 	m.stats.LastPacketTime = packet.Metadata.CaptureTime
 
-	// 统计协议类型
-	if packet.TransportLayer.Protocol == "TCP" {
-		if packet.TransportLayer.DstPort == 80 || packet.TransportLayer.SrcPort == 80 {
-			m.stats.HTTPPackets++
-		}
-		if packet.TransportLayer.DstPort == 443 || packet.TransportLayer.SrcPort == 443 {
-			m.stats.HTTPSPackets++
-		}
+	// 按识别出的应用层协议统计，而不是按 80/443 端口
+	switch packet.AppProtocol {
+	case layer.AppProtocolHTTP, layer.AppProtocolHTTP2:
+		m.stats.HTTPPackets++
+	case layer.AppProtocolTLS:
+		m.stats.HTTPSPackets++
+	}
+	if packet.AppProtocol != "" {
+		m.stats.ProtocolCounts[packet.AppProtocol]++
 	}
 
 	// 统计唯一IP和端口
@@ -105,6 +108,11 @@ func (m *MemoryStorage) matchesFilter(packet *models.PacketInfo, filter Filter)
 		return false
 	}
 
+	// 应用层协议过滤
+	if filter.AppProtocol != "" && !strings.EqualFold(packet.AppProtocol, filter.AppProtocol) {
+		return false
+	}
+
 	// IP过滤
 	if filter.SrcIP != "" && packet.NetworkLayer.SrcIP != filter.SrcIP {
 		return false
@@ -197,7 +205,8 @@ func (m *MemoryStorage) Clear() {
 
 	m.packets = make([]*models.PacketInfo, 0)
 	m.stats = Stats{
-		StartTime: time.Now(),
+		StartTime:      time.Now(),
+		ProtocolCounts: make(map[string]int),
 	}
 	m.ipSet = make(map[string]bool)
 	m.portSet = make(map[uint16]bool)
@@ -208,5 +217,10 @@ func (m *MemoryStorage) GetStats() Stats {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return m.stats
+	stats := m.stats
+	stats.ProtocolCounts = make(map[string]int, len(m.stats.ProtocolCounts))
+	for k, v := range m.stats.ProtocolCounts {
+		stats.ProtocolCounts[k] = v
+	}
+	return stats
 }
@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"probe/internal/models"
+	"sync"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -11,6 +12,9 @@ import (
 // MySQLStorage 是基于 MySQL 的存储实现
 type MySQLStorage struct {
 	db *sql.DB
+
+	mu        sync.Mutex
+	startTime time.Time // 统计起始时间，Clear 时重置
 }
 
 // NewMySQLStorage 创建一个新的 MySQL 存储实例
@@ -20,7 +24,7 @@ func NewMySQLStorage(dataSourceName string) (*MySQLStorage, error) {
 		return nil, err
 	}
 
-	storage := &MySQLStorage{db: db}
+	storage := &MySQLStorage{db: db, startTime: time.Now()}
 
 	// 创建表
 	err = storage.createTables()
@@ -42,6 +46,7 @@ func (s *MySQLStorage) createTables() error {
 		src_port INT,
 		dst_port INT,
 		protocol VARCHAR(10),
+		app_protocol VARCHAR(20),
 		length INT,
 		payload LONGBLOB,
 		http_method VARCHAR(10),
@@ -83,40 +88,59 @@ func (s *MySQLStorage) createTables() error {
 		INDEX idx_src_ip (src_ip),
 		INDEX idx_dst_ip (dst_ip),
 		INDEX idx_protocol (protocol),
+		INDEX idx_app_protocol (app_protocol),
 		INDEX idx_host (host),
 		INDEX idx_domain (domain)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;`
 
-	_, err := s.db.Exec(query)
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+	return s.migrate()
+}
+
+// migrate 为旧版本创建的表补充新增列与索引
+func (s *MySQLStorage) migrate() error {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'packets' AND COLUMN_NAME = 'app_protocol'`).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = s.db.Exec(`ALTER TABLE packets
+		ADD COLUMN app_protocol VARCHAR(20) AFTER protocol,
+		ADD INDEX idx_app_protocol (app_protocol)`)
 	return err
 }
 
 // StorePacket 存储一个数据包
 func (s *MySQLStorage) StorePacket(packet *models.PacketInfo) {
-	// TODO: 实现 MySQL 存储逻辑
+	insertPacket(s.db, packet)
 }
 
 // GetPackets 获取指定数量的最新数据包
 func (s *MySQLStorage) GetPackets(limit int) []*models.PacketInfo {
-	// TODO: 实现 MySQL 查询逻辑
-	return nil
+	return queryPackets(s.db, "", nil, limit)
 }
 
 // GetPacketsByFilter 根据过滤条件获取数据包
 func (s *MySQLStorage) GetPacketsByFilter(filter Filter) []*models.PacketInfo {
-	// TODO: 实现 MySQL 过滤查询逻辑
-	return nil
+	where, args := filterClause(filter)
+	return queryPackets(s.db, where, args, 0)
 }
 
 // Clear 清空所有数据包
 func (s *MySQLStorage) Clear() {
-	// TODO: 实现清空数据逻辑
+	clearPackets(s.db)
+	s.mu.Lock()
+	s.startTime = time.Now()
+	s.mu.Unlock()
 }
 
 // GetStats 获取统计信息
 func (s *MySQLStorage) GetStats() Stats {
-	// TODO: 实现统计信息查询逻辑
-	return Stats{
-		StartTime: time.Now(),
-	}
+	s.mu.Lock()
+	start := s.startTime
+	s.mu.Unlock()
+	return queryStats(s.db, start)
 }
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"probe/internal/capture/layer"
+	"probe/internal/models"
+	"strings"
+	"time"
+)
+
+// SQLite 与 MySQL 共用的读写逻辑，两者的占位符均为 ?
+
+// packetColumns 写入与读取的列，顺序与 packetValues、scanPacket 一致
+const packetColumns = `timestamp, src_ip, dst_ip, src_port, dst_port, protocol, app_protocol, length, payload,
+	http_method, http_url, http_status, user_agent, content_type, host, domain, path, query, referer, server,
+	set_cookie, cookie, authorization, accept, accept_language, accept_encoding, connection`
+
+// packetValues 按 packetColumns 的顺序取出数据包的字段，缺失的层按空值处理
+func packetValues(p *models.PacketInfo) []interface{} {
+	var (
+		ts  time.Time
+		nw  layer.NetworkLayerInfo
+		tp  layer.TransportLayerInfo
+		app layer.ApplicationLayerInfo
+	)
+	if p.Metadata != nil {
+		ts = p.Metadata.CaptureTime
+	}
+	if p.NetworkLayer != nil {
+		nw = *p.NetworkLayer
+	}
+	if p.TransportLayer != nil {
+		tp = *p.TransportLayer
+	}
+	if p.ApplicationLayer != nil {
+		app = *p.ApplicationLayer
+	}
+	payload, _ := base64.StdEncoding.DecodeString(app.Payload)
+	return []interface{}{
+		ts.UTC(), nw.SrcIP, nw.DstIP, tp.SrcPort, tp.DstPort, tp.Protocol, p.AppProtocol, nw.Length, payload,
+		app.HTTPMethod, app.FullURL, app.HTTPStatus, app.UserAgent, app.ContentType, app.Host, app.Domain, app.Path, app.Query, app.Referer, app.Server,
+		app.SetCookie, app.Cookie, app.Authorization, app.Accept, app.AcceptLanguage, app.AcceptEncoding, app.Connection,
+	}
+}
+
+// insertPacket 写入一个数据包
+func insertPacket(db *sql.DB, p *models.PacketInfo) {
+	values := packetValues(p)
+	query := "INSERT INTO packets (" + packetColumns + ") VALUES (?" + strings.Repeat(", ?", len(values)-1) + ")"
+	if _, err := db.Exec(query, values...); err != nil {
+		log.Printf("保存数据包失败: %v", err)
+	}
+}
+
+// scanPacket 读取 id 与 packetColumns 各列，还原为数据包
+func scanPacket(rows *sql.Rows) (*models.PacketInfo, error) {
+	var (
+		p                   = &models.PacketInfo{}
+		ts                  interface{}
+		srcIP, dstIP, proto sql.NullString
+		appProtocol         sql.NullString
+		srcPort, dstPort, n sql.NullInt64
+		payload             []byte
+		headers             [18]sql.NullString
+	)
+	dest := []interface{}{&p.ID, &ts, &srcIP, &dstIP, &srcPort, &dstPort, &proto, &appProtocol, &n, &payload}
+	for i := range headers {
+		dest = append(dest, &headers[i])
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	captured, err := parseSQLTime(ts)
+	if err != nil {
+		return nil, err
+	}
+
+	app := &layer.ApplicationLayerInfo{Timestamp: captured, Headers: make(map[string]string)}
+	if len(payload) > 0 {
+		app.Payload = base64.StdEncoding.EncodeToString(payload)
+	}
+	for i, f := range []*string{
+		&app.HTTPMethod, &app.FullURL, &app.HTTPStatus, &app.UserAgent, &app.ContentType, &app.Host, &app.Domain, &app.Path, &app.Query, &app.Referer, &app.Server,
+		&app.SetCookie, &app.Cookie, &app.Authorization, &app.Accept, &app.AcceptLanguage, &app.AcceptEncoding, &app.Connection,
+	} {
+		*f = headers[i].String
+	}
+
+	p.Metadata = &layer.PacketMetadataInfo{CaptureTime: captured, DataSize: len(payload)}
+	p.NetworkLayer = &layer.NetworkLayerInfo{Timestamp: captured, SrcIP: srcIP.String, DstIP: dstIP.String, Length: int(n.Int64)}
+	p.TransportLayer = &layer.TransportLayerInfo{Timestamp: captured, SrcPort: uint16(srcPort.Int64), DstPort: uint16(dstPort.Int64), Protocol: proto.String}
+	p.ApplicationLayer = app
+	p.AppProtocol = appProtocol.String
+	return p, nil
+}
+
+// parseSQLTime 解析时间列：SQLite 驱动直接返回 time.Time，MySQL 未开启 parseTime 时返回文本
+func parseSQLTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case nil:
+		return time.Time{}, nil
+	case time.Time:
+		return t, nil
+	case []byte:
+		return time.Parse("2006-01-02 15:04:05.999999999", string(t))
+	case string:
+		return time.Parse("2006-01-02 15:04:05.999999999", t)
+	}
+	return time.Time{}, fmt.Errorf("unsupported time value %T", v)
+}
+
+// queryPackets 按条件查询数据包，limit 大于 0 时只返回最新的 limit 个，结果按写入顺序排列
+func queryPackets(db *sql.DB, where string, args []interface{}, limit int) []*models.PacketInfo {
+	query := "SELECT id, " + packetColumns + " FROM packets" + where + " ORDER BY id DESC"
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		log.Printf("查询数据包失败: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	packets := make([]*models.PacketInfo, 0)
+	for rows.Next() {
+		p, err := scanPacket(rows)
+		if err != nil {
+			log.Printf("读取数据包失败: %v", err)
+			return nil
+		}
+		packets = append(packets, p)
+	}
+	for i, j := 0, len(packets)-1; i < j; i, j = i+1, j-1 {
+		packets[i], packets[j] = packets[j], packets[i]
+	}
+	return packets
+}
+
+// filterClause 将过滤条件转换为 WHERE 子句，语义与 MemoryStorage.matchesFilter 一致
+func filterClause(filter Filter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	eq := func(column, value string) {
+		if value != "" {
+			conds = append(conds, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	eq("protocol", filter.Protocol)
+	if filter.AppProtocol != "" {
+		conds = append(conds, "LOWER(app_protocol) = LOWER(?)")
+		args = append(args, filter.AppProtocol)
+	}
+	eq("src_ip", filter.SrcIP)
+	eq("dst_ip", filter.DstIP)
+	if filter.Port != 0 {
+		conds = append(conds, "(src_port = ? OR dst_port = ?)")
+		args = append(args, filter.Port, filter.Port)
+	}
+	eq("http_method", filter.HTTPMethod)
+	if !filter.StartTime.IsZero() {
+		conds = append(conds, "timestamp >= ?")
+		args = append(args, filter.StartTime.UTC())
+	}
+	if !filter.EndTime.IsZero() {
+		conds = append(conds, "timestamp <= ?")
+		args = append(args, filter.EndTime.UTC())
+	}
+	eq("host", filter.Host)
+	eq("domain", filter.Domain)
+	eq("path", filter.Path)
+	eq("user_agent", filter.UserAgent)
+	eq("content_type", filter.ContentType)
+	eq("referer", filter.Referer)
+	eq("server", filter.Server)
+	if filter.SearchText != "" {
+		columns := []string{"src_ip", "dst_ip", "host", "path", "user_agent", "content_type", "referer", "server"}
+		like := make([]string, len(columns))
+		for i, c := range columns {
+			like[i] = "LOWER(" + c + ") LIKE ?"
+			args = append(args, "%"+strings.ToLower(filter.SearchText)+"%")
+		}
+		conds = append(conds, "("+strings.Join(like, " OR ")+")")
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// queryStats 汇总统计信息，HTTP 与 HTTPS 按识别出的应用层协议计数
+func queryStats(db *sql.DB, start time.Time) Stats {
+	stats := Stats{StartTime: start, ProtocolCounts: make(map[string]int)}
+	var httpPackets, httpsPackets sql.NullInt64
+	err := db.QueryRow(`SELECT COUNT(*),
+		SUM(CASE WHEN app_protocol IN (?, ?) THEN 1 ELSE 0 END),
+		SUM(CASE WHEN app_protocol = ? THEN 1 ELSE 0 END) FROM packets`,
+		layer.AppProtocolHTTP, layer.AppProtocolHTTP2, layer.AppProtocolTLS).Scan(&stats.TotalPackets, &httpPackets, &httpsPackets)
+	if err != nil {
+		log.Printf("查询统计信息失败: %v", err)
+		return stats
+	}
+	stats.HTTPPackets, stats.HTTPSPackets = int(httpPackets.Int64), int(httpsPackets.Int64)
+
+	var last interface{}
+	if err := db.QueryRow(`SELECT timestamp FROM packets ORDER BY id DESC LIMIT 1`).Scan(&last); err == nil {
+		stats.LastPacketTime, _ = parseSQLTime(last)
+	}
+	db.QueryRow(`SELECT COUNT(*) FROM (SELECT src_ip FROM packets UNION SELECT dst_ip FROM packets) ips`).Scan(&stats.UniqueIPs)
+	db.QueryRow(`SELECT COUNT(*) FROM (SELECT src_port FROM packets UNION SELECT dst_port FROM packets) ports`).Scan(&stats.UniquePorts)
+
+	rows, err := db.Query(`SELECT app_protocol, COUNT(*) FROM packets WHERE app_protocol <> '' GROUP BY app_protocol`)
+	if err != nil {
+		log.Printf("查询协议统计失败: %v", err)
+		return stats
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var count int
+		if rows.Scan(&name, &count) == nil {
+			stats.ProtocolCounts[name] = count
+		}
+	}
+	return stats
+}
+
+// clearPackets 删除全部数据包
+func clearPackets(db *sql.DB) {
+	if _, err := db.Exec(`DELETE FROM packets`); err != nil {
+		log.Printf("清空数据包失败: %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"probe/internal/models"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -11,6 +12,9 @@ import (
 // SQLiteStorage 是基于 SQLite 的存储实现
 type SQLiteStorage struct {
 	db *sql.DB
+
+	mu        sync.Mutex
+	startTime time.Time // 统计起始时间，Clear 时重置
 }
 
 // NewSQLiteStorage 创建一个新的 SQLite 存储实例
@@ -20,7 +24,7 @@ func NewSQLiteStorage(dataSourceName string) (*SQLiteStorage, error) {
 		return nil, err
 	}
 
-	storage := &SQLiteStorage{db: db}
+	storage := &SQLiteStorage{db: db, startTime: time.Now()}
 
 	// 创建表
 	err = storage.createTables()
@@ -42,6 +46,7 @@ func (s *SQLiteStorage) createTables() error {
 		src_port INTEGER,
 		dst_port INTEGER,
 		protocol TEXT,
+		app_protocol TEXT,
 		length INTEGER,
 		payload BLOB,
 		http_method TEXT,
@@ -81,36 +86,74 @@ func (s *SQLiteStorage) createTables() error {
 		x_requested_with TEXT
 	);`
 
-	_, err := s.db.Exec(query)
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+	return s.migrate()
+}
+
+// migrate 为旧版本创建的表补充新增列
+func (s *SQLiteStorage) migrate() error {
+	rows, err := s.db.Query(`PRAGMA table_info(packets)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	hasAppProtocol := false
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    int
+			dfltValue  sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dfltValue, &primaryKey); err != nil {
+			return err
+		}
+		if name == "app_protocol" {
+			hasAppProtocol = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if hasAppProtocol {
+		return nil
+	}
+	_, err = s.db.Exec(`ALTER TABLE packets ADD COLUMN app_protocol TEXT`)
 	return err
 }
 
 // StorePacket 存储一个数据包
 func (s *SQLiteStorage) StorePacket(packet *models.PacketInfo) {
-	// TODO: 实现 SQLite 存储逻辑
+	insertPacket(s.db, packet)
 }
 
 // GetPackets 获取指定数量的最新数据包
 func (s *SQLiteStorage) GetPackets(limit int) []*models.PacketInfo {
-	// TODO: 实现 SQLite 查询逻辑
-	return nil
+	return queryPackets(s.db, "", nil, limit)
 }
 
 // GetPacketsByFilter 根据过滤条件获取数据包
 func (s *SQLiteStorage) GetPacketsByFilter(filter Filter) []*models.PacketInfo {
-	// TODO: 实现 SQLite 过滤查询逻辑
-	return nil
+	where, args := filterClause(filter)
+	return queryPackets(s.db, where, args, 0)
 }
 
 // Clear 清空所有数据包
 func (s *SQLiteStorage) Clear() {
-	// TODO: 实现清空数据逻辑
+	clearPackets(s.db)
+	s.mu.Lock()
+	s.startTime = time.Now()
+	s.mu.Unlock()
 }
 
 // GetStats 获取统计信息
 func (s *SQLiteStorage) GetStats() Stats {
-	// TODO: 实现统计信息查询逻辑
-	return Stats{
-		StartTime: time.Now(),
-	}
+	s.mu.Lock()
+	start := s.startTime
+	s.mu.Unlock()
+	return queryStats(s.db, start)
 }
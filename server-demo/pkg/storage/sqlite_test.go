@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"probe/internal/capture/layer"
+	"probe/internal/models"
+)
+
+func sqlitePacket(app string, srcPort, dstPort uint16, host string) *models.PacketInfo {
+	now := time.Now()
+	return &models.PacketInfo{
+		Metadata:         &layer.PacketMetadataInfo{CaptureTime: now},
+		NetworkLayer:     &layer.NetworkLayerInfo{SrcIP: "10.0.0.1", DstIP: "10.0.0.2", Length: 60},
+		TransportLayer:   &layer.TransportLayerInfo{SrcPort: srcPort, DstPort: dstPort, Protocol: "TCP"},
+		ApplicationLayer: &layer.ApplicationLayerInfo{Host: host, Payload: "aGVsbG8="},
+		AppProtocol:      app,
+	}
+}
+
+// TestSQLiteStorageAppProtocol 测试应用层协议写入数据库后能读回，并参与过滤与统计
+func TestSQLiteStorageAppProtocol(t *testing.T) {
+	s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "packets.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.StorePacket(sqlitePacket(layer.AppProtocolHTTP, 40000, 8080, "example.com"))
+	s.StorePacket(sqlitePacket(layer.AppProtocolTLS, 40001, 8443, "secure.example.com"))
+	s.StorePacket(sqlitePacket(layer.AppProtocolSSH, 40002, 2222, ""))
+
+	all := s.GetPackets(0)
+	if len(all) != 3 || all[0].AppProtocol != layer.AppProtocolHTTP || all[2].AppProtocol != layer.AppProtocolSSH {
+		t.Fatalf("round trip: got %d packets", len(all))
+	}
+	if all[0].ApplicationLayer.Host != "example.com" || all[0].ApplicationLayer.Payload != "aGVsbG8=" || all[0].TransportLayer.DstPort != 8080 {
+		t.Fatalf("round trip fields: %+v %+v", all[0].ApplicationLayer, all[0].TransportLayer)
+	}
+	if latest := s.GetPackets(1); len(latest) != 1 || latest[0].AppProtocol != layer.AppProtocolSSH {
+		t.Fatalf("latest packet: %+v", latest)
+	}
+
+	if got := s.GetPacketsByFilter(Filter{AppProtocol: "tls"}); len(got) != 1 || got[0].TransportLayer.DstPort != 8443 {
+		t.Fatalf("app protocol filter: got %d packets", len(got))
+	}
+	if got := s.GetPacketsByFilter(Filter{Port: 2222}); len(got) != 1 || got[0].AppProtocol != layer.AppProtocolSSH {
+		t.Fatalf("port filter: got %d packets", len(got))
+	}
+	if got := s.GetPacketsByFilter(Filter{SearchText: "SECURE"}); len(got) != 1 {
+		t.Fatalf("search filter: got %d packets", len(got))
+	}
+
+	stats := s.GetStats()
+	if stats.TotalPackets != 3 || stats.HTTPPackets != 1 || stats.HTTPSPackets != 1 || stats.ProtocolCounts[layer.AppProtocolSSH] != 1 {
+		t.Fatalf("stats: %+v", stats)
+	}
+	if stats.UniqueIPs != 2 || stats.UniquePorts != 6 || stats.LastPacketTime.IsZero() {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	s.Clear()
+	if got := s.GetStats(); got.TotalPackets != 0 || len(s.GetPackets(0)) != 0 {
+		t.Fatalf("after clear: %+v", got)
+	}
+}
@@ -26,6 +26,7 @@ type Storage interface {
 // Filter 用于过滤数据包的条件
 type Filter struct {
 	Protocol    string    `json:"protocol"`
+	AppProtocol string    `json:"app_protocol"`
 	SrcIP       string    `json:"src_ip"`
 	DstIP       string    `json:"dst_ip"`
 	Port        uint16    `json:"port"`
@@ -51,4 +52,6 @@ type Stats struct {
 	LastPacketTime time.Time `json:"last_packet_time"`
 	UniqueIPs      int       `json:"unique_ips"`
 	UniquePorts    int       `json:"unique_ports"`
+	// ProtocolCounts 按识别出的应用层协议统计的数据包数量
+	ProtocolCounts map[string]int `json:"protocol_counts"`
 }
@@ -2,40 +2,83 @@ package utils
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
 	"compress/zlib"
+	"fmt"
 	"io"
 	"mime"
 	"strings"
+
+	"github.com/andybalholm/brotli"
 )
 
+// DecodeBody decompresses body according to the Content-Encoding value.
+// Supports gzip, deflate and br; identity or empty encoding returns body unchanged.
+func DecodeBody(body []byte, encoding string) ([]byte, error) {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			// some servers send raw deflate without zlib header
+			fr := flate.NewReader(bytes.NewReader(body))
+			defer fr.Close()
+			return io.ReadAll(fr)
+		}
+		defer zr.Close()
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+	return io.ReadAll(r)
+}
+
+// EncodeBody compresses body with the given Content-Encoding, the inverse of DecodeBody.
+func EncodeBody(body []byte, encoding string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // DecodeBodyToText tries to decode HTTP body bytes to human-readable text based on headers.
-// Supports gzip and deflate. If charset detected in Content-Type, tries to honor utf-8; other charsets are returned best-effort.
+// Supports gzip, deflate and br. If charset detected in Content-Type, tries to honor utf-8; other charsets are returned best-effort.
 func DecodeBodyToText(body []byte, headers map[string]string) (string, string) {
 	if len(body) == 0 {
 		return "", ""
 	}
-	contentEncoding := strings.ToLower(headers["Content-Encoding"])
 	var raw []byte = body
-	switch contentEncoding {
-	case "gzip":
-		zr, err := gzip.NewReader(bytes.NewReader(body))
-		if err == nil {
-			out, _ := io.ReadAll(zr)
-			_ = zr.Close()
-			if len(out) > 0 {
-				raw = out
-			}
-		}
-	case "deflate":
-		zr, err := zlib.NewReader(bytes.NewReader(body))
-		if err == nil {
-			out, _ := io.ReadAll(zr)
-			_ = zr.Close()
-			if len(out) > 0 {
-				raw = out
-			}
-		}
+	if out, err := DecodeBody(body, headers["Content-Encoding"]); err == nil && len(out) > 0 {
+		raw = out
 	}
 
 	ct := headers["Content-Type"]